@@ -1,11 +1,23 @@
 package main
 
 import (
+	"POS-Golang/internal/auth"
+	"POS-Golang/internal/barcode"
 	"POS-Golang/internal/config"
 	"POS-Golang/internal/database"
 	"POS-Golang/internal/handlers"
+	"POS-Golang/internal/inventory"
+	"POS-Golang/internal/mailer"
 	"POS-Golang/internal/middleware"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/pricing"
+	"POS-Golang/internal/ratelimit"
+	"POS-Golang/internal/search"
+	"POS-Golang/internal/storage"
+	"POS-Golang/internal/trash"
+	"context"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,15 +34,117 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	inventory.SetCostMethod(cfg.CostMethod)
+
+	if err := barcode.SetEmbedded(cfg.WeightBarcodePrefixes, cfg.PriceBarcodePrefixes, cfg.PriceBarcodeDecimals); err != nil {
+		log.Fatal("Invalid scale barcode settings:", err)
+	}
+
+	// Sign-in tokens are signed with the JWT secret; expired refresh tokens
+	// are cleared out in the background
+	auth.Configure(cfg.JWTSecret, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
+	auth.SetIdleLock(cfg.TerminalIdleLock)
+	handlers.SetSetupToken(cfg.SetupToken)
+	handlers.SetInviteTTL(cfg.InviteTTL)
+	go auth.RunCleanup(context.Background(), database.GetDB(), time.Hour)
+
+	// New passwords are checked against the password policy, and reset
+	// links are mailed, or written to the log when no mail server is set up
+	auth.SetPasswordPolicy(auth.PasswordPolicy{
+		MinLength:     cfg.PasswordMinLength,
+		RequireUpper:  cfg.PasswordRequireUpper,
+		RequireLower:  cfg.PasswordRequireLower,
+		RequireDigit:  cfg.PasswordRequireDigit,
+		RequireSymbol: cfg.PasswordRequireSymbol,
+	})
+	var mail mailer.Mailer = mailer.NewLog()
+	if cfg.MailDriver == "smtp" {
+		mail, err = mailer.NewSMTP(mailer.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+		if err != nil {
+			log.Fatal("Failed to set up mail:", err)
+		}
+	}
+	handlers.SetPasswordReset(mail, cfg.PasswordResetURL, cfg.PasswordResetTTL)
+	auth.SetTOTPIssuer(cfg.TwoFactorIssuer)
+
+	// Failed logins and wrong PINs lock out accounts and addresses, counted
+	// in memory or, to share them between instances, in the database
+	accountPolicy := ratelimit.Policy{Attempts: cfg.LoginMaxAttempts, Lockout: cfg.LoginLockout, MaxLockout: cfg.LoginMaxLockout}
+	ipPolicy := ratelimit.Policy{Attempts: cfg.LoginIPMaxAttempts, Lockout: cfg.LoginLockout, MaxLockout: cfg.LoginMaxLockout}
+	pinPolicy := ratelimit.Policy{Attempts: cfg.PINMaxAttempts, Lockout: cfg.PINLockout, MaxLockout: max(cfg.PINLockout, cfg.LoginMaxLockout)}
+	if cfg.RateLimitStore == "db" {
+		accountLimiter := ratelimit.NewDB(database.GetDB(), accountPolicy)
+		ipLimiter := ratelimit.NewDB(database.GetDB(), ipPolicy)
+		pinLimiter := ratelimit.NewDB(database.GetDB(), pinPolicy)
+		// The limiters share a table; the PIN policy forgets failures last
+		go pinLimiter.RunCleanup(context.Background(), time.Hour)
+		handlers.SetLimiters(accountLimiter, ipLimiter, pinLimiter)
+	} else {
+		handlers.SetLimiters(ratelimit.NewMemory(accountPolicy), ratelimit.NewMemory(ipPolicy), ratelimit.NewMemory(pinPolicy))
+	}
+
+	// Discounts over the limit need a supervisor's approval
+	handlers.SetDiscountApprovalLimit(cfg.DiscountApprovalLimit)
+
+	// Scheduled price changes are applied in the background
+	go pricing.RunScheduler(context.Background(), database.GetDB(), cfg.PriceSchedulerInterval)
+
+	// Product images are kept on disk or in an S3-compatible bucket
+	var imageStore storage.Storage
+	if cfg.StorageDriver == "s3" {
+		imageStore, err = storage.NewS3(storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+	} else {
+		imageStore, err = storage.NewLocal(cfg.StorageDir)
+	}
+	if err != nil {
+		log.Fatal("Failed to set up image storage:", err)
+	}
+	handlers.SetImageStorage(imageStore, cfg.ImageBaseURL, int64(cfg.ImageMaxUploadMB)<<20)
+
+	// Product search runs on an in-memory index kept in step with the
+	// products table
+	productIndex := search.New()
+	searchSyncer, err := search.NewSyncer(database.GetDB(), productIndex)
+	if err != nil {
+		log.Fatal("Failed to set up product search:", err)
+	}
+	go searchSyncer.Run(context.Background(), cfg.SearchRefreshInterval)
+	handlers.SetProductSearch(productIndex)
+
+	// Deleted records are purged once past the retention period
+	handlers.SetTrashRetention(cfg.TrashRetention)
+	if cfg.TrashRetention > 0 {
+		go trash.RunPurger(context.Background(), database.GetDB(), imageStore, cfg.TrashRetention, cfg.TrashPurgeInterval)
+	}
+
 	// Setup router
 	r := gin.Default()
 
+	// Client addresses from forwarding headers are only believed from
+	// known proxies, as the login lockout is kept per address
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	// Enable CORS for frontend
 	r.Use(func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
 		c.Header("Access-Control-Allow-Origin", origin)
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Terminal-Key")
 		c.Header("Access-Control-Allow-Credentials", "true")
 
 		if c.Request.Method == "OPTIONS" {
@@ -46,39 +160,220 @@ func main() {
 	{
 		// Auth routes (no middleware)
 		api.POST("/login", handlers.Login)
-		api.POST("/register", handlers.Register)
+		api.POST("/auth/refresh", handlers.RefreshToken)
 
-		// Protected routes
+		// Forgotten passwords are reset through a link sent by email
+		api.GET("/auth/password-policy", handlers.GetPasswordPolicy)
+		api.POST("/auth/forgot-password", handlers.ForgotPassword)
+		api.POST("/auth/reset-password", handlers.ResetPassword)
+
+		// Second login step for accounts with two-factor sign-in, taking
+		// the challenge token the password step hands out
+		api.POST("/auth/2fa/enroll", handlers.EnrollTwoFactorLogin)
+		api.POST("/auth/2fa/verify", handlers.VerifyTwoFactorLogin)
+
+		// First-run setup of the admin account, and joining by invite.
+		// Open sign-up is only there when turned on.
+		api.GET("/setup", handlers.GetSetupStatus)
+		api.POST("/setup", handlers.Setup)
+		api.GET("/invites/:token", handlers.GetInviteByToken)
+		api.POST("/invites/accept", handlers.AcceptInvite)
+		if cfg.AllowRegistration {
+			api.POST("/register", handlers.Register)
+		}
+
+		// PIN login, only from a registered terminal
+		terminal := api.Group("")
+		terminal.Use(middleware.TerminalAuth())
+		{
+			terminal.POST("/auth/pin-login", handlers.PINLogin)
+			terminal.GET("/terminal/users", handlers.GetTerminalUsers)
+		}
+
+		// Product images are public so they can be used in img tags
+		api.GET("/images/*key", handlers.ServeImage)
+
+		// Protected routes, each needing a permission of the user's role
 		protected := api.Group("")
 		protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+		// Users who must change their password can do nothing else first
+		protected.Use(middleware.EnforcePasswordChange("/api/v1/me/password", "/api/v1/logout"))
+		can := middleware.RequirePermission
 		{
+			protected.POST("/logout", handlers.Logout)
+			protected.PUT("/me/pin", handlers.SetMyPIN)
+			protected.PUT("/me/password", handlers.ChangePassword)
+			protected.GET("/me/2fa", handlers.GetMyTwoFactor)
+			protected.POST("/me/2fa/enroll", handlers.EnrollTwoFactor)
+			protected.POST("/me/2fa/confirm", handlers.ConfirmTwoFactor)
+			protected.POST("/me/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+			protected.POST("/me/2fa/disable", handlers.DisableTwoFactor)
+
 			// Product routes
-			protected.GET("/products", handlers.GetProducts)
-			protected.GET("/products/:id", handlers.GetProduct)
-			protected.POST("/products", handlers.CreateProduct)
-			protected.PUT("/products/:id", handlers.UpdateProduct)
-			protected.DELETE("/products/:id", handlers.DeleteProduct)
+			protected.GET("/products", can(models.PermProductView), handlers.GetProducts)
+			protected.GET("/products/barcode/:code", can(models.PermProductView), handlers.GetProductByBarcode)
+			protected.GET("/products/:id", can(models.PermProductView), handlers.GetProduct)
+			protected.POST("/products", can(models.PermProductWrite), handlers.CreateProduct)
+			protected.PUT("/products/:id", can(models.PermProductWrite), handlers.UpdateProduct)
+			protected.DELETE("/products/:id", can(models.PermProductWrite), handlers.DeleteProduct)
+			protected.GET("/products/:id/lots", can(models.PermProductView), handlers.GetProductLots)
+			protected.GET("/products/:id/stock", can(models.PermProductView), handlers.GetProductStock)
+			protected.GET("/products/:id/price", can(models.PermProductView), handlers.GetProductPrice)
+			protected.GET("/products/:id/barcodes", can(models.PermProductView), handlers.GetProductBarcodes)
+			protected.POST("/products/:id/barcodes", can(models.PermProductWrite), handlers.CreateProductBarcode)
+			protected.DELETE("/products/:id/barcodes/:barcodeId", can(models.PermProductWrite), handlers.DeleteProductBarcode)
+			protected.GET("/products/:id/images", can(models.PermProductView), handlers.GetProductImages)
+			protected.POST("/products/:id/images", can(models.PermProductWrite), handlers.UploadProductImages)
+			protected.PUT("/products/:id/images/:imageId", can(models.PermProductWrite), handlers.UpdateProductImage)
+			protected.DELETE("/products/:id/images/:imageId", can(models.PermProductWrite), handlers.DeleteProductImage)
+
+			// Shelf and price labels
+			protected.GET("/labels/layouts", can(models.PermLabelPrint), handlers.GetLabelLayouts)
+			protected.POST("/labels", can(models.PermLabelPrint), handlers.PrintLabels)
+
+			// Serial numbers and warranty lookups
+			protected.GET("/serials", can(models.PermSerialView), handlers.GetSerials)
+			protected.GET("/serials/:serial", can(models.PermSerialView), handlers.GetSerial)
+			protected.POST("/serials/:serial/return", can(models.PermSerialReturn), handlers.ReturnSerial)
 
 			// Transaction routes
-			protected.GET("/transactions", handlers.GetTransactions)
-			protected.POST("/transactions", handlers.CreateTransaction)
-			protected.GET("/transactions/:id", handlers.GetTransaction)
+			protected.GET("/transactions", can(models.PermTransactionView), handlers.GetTransactions)
+			protected.POST("/transactions", can(models.PermTransactionCreate), handlers.CreateTransaction)
+			protected.GET("/transactions/:id", can(models.PermTransactionView), handlers.GetTransaction)
+			protected.POST("/transactions/:id/void", can(models.PermTransactionCreate), handlers.VoidTransaction)
+
+			// Supervisor approvals for voids, price overrides, large
+			// discounts and no-sale drawer opens
+			protected.POST("/drawer/no-sale", can(models.PermTransactionCreate), handlers.OpenDrawerNoSale)
+			protected.GET("/approvals", can(models.PermReportView), handlers.GetApprovals)
 
 			// Dashboard
-			protected.GET("/dashboard", handlers.GetDashboard)
+			protected.GET("/dashboard", can(models.PermDashboardView), handlers.GetDashboard)
 
-			protected.GET("/categories", handlers.GetCategories)
-			protected.POST("/categories", handlers.CreateCategory)
-		}
+			protected.GET("/categories", can(models.PermProductView), handlers.GetCategories)
+			protected.GET("/categories/:id", can(models.PermProductView), handlers.GetCategory)
+			protected.POST("/categories", can(models.PermCategoryWrite), handlers.CreateCategory)
+			protected.PUT("/categories/:id", can(models.PermCategoryWrite), handlers.UpdateCategory)
+			protected.DELETE("/categories/:id", can(models.PermCategoryWrite), handlers.DeleteCategory)
 
-		// Admin only routes
-		admin := protected.Group("")
-		admin.Use(middleware.AdminOnly())
-		{
-			admin.GET("/users", handlers.GetUsers)
-			admin.POST("/users", handlers.CreateUser)
-			admin.PUT("/users/:id", handlers.UpdateUser)
-			admin.DELETE("/users/:id", handlers.DeleteUser)
+			// Product tags and custom attributes
+			protected.GET("/tags", can(models.PermProductView), handlers.GetTags)
+			protected.POST("/tags/:id/products", can(models.PermProductWrite), handlers.AddTagProducts)
+			protected.DELETE("/tags/:id/products", can(models.PermProductWrite), handlers.RemoveTagProducts)
+			protected.GET("/attributes", can(models.PermProductView), handlers.GetAttributeDefinitions)
+
+			protected.GET("/locations", can(models.PermLocationView), handlers.GetLocations)
+
+			// Customers and the price lists they buy on
+			protected.GET("/customers", can(models.PermCustomerView), handlers.GetCustomers)
+			protected.GET("/customers/:id", can(models.PermCustomerView), handlers.GetCustomer)
+			protected.POST("/customers", can(models.PermCustomerWrite), handlers.CreateCustomer)
+			protected.PUT("/customers/:id", can(models.PermCustomerWrite), handlers.UpdateCustomer)
+			protected.DELETE("/customers/:id", can(models.PermCustomerWrite), handlers.DeleteCustomer)
+			protected.GET("/price-lists", can(models.PermPricingView), handlers.GetPriceLists)
+			protected.GET("/price-lists/:id", can(models.PermPricingView), handlers.GetPriceList)
+
+			// Stock transfers between locations
+			protected.GET("/stock-transfers", can(models.PermStockTransfer), handlers.GetStockTransfers)
+			protected.GET("/stock-transfers/:id", can(models.PermStockTransfer), handlers.GetStockTransfer)
+			protected.POST("/stock-transfers", can(models.PermStockTransfer), handlers.CreateStockTransfer)
+			protected.POST("/stock-transfers/:id/ship", can(models.PermStockTransfer), handlers.ShipStockTransfer)
+			protected.POST("/stock-transfers/:id/receive", can(models.PermStockTransfer), handlers.ReceiveStockTransfer)
+			protected.POST("/stock-transfers/:id/cancel", can(models.PermStockTransfer), handlers.CancelStockTransfer)
+
+			// Users, and the roles and permissions they are given
+			protected.GET("/users", can(models.PermUserManage), handlers.GetUsers)
+			protected.POST("/users", can(models.PermUserManage), handlers.CreateUser)
+			protected.PUT("/users/:id", can(models.PermUserManage), handlers.UpdateUser)
+			protected.DELETE("/users/:id", can(models.PermUserManage), handlers.DeleteUser)
+			protected.PUT("/users/:id/pin", can(models.PermUserManage), handlers.SetUserPIN)
+			protected.POST("/users/:id/unlock", can(models.PermUserManage), handlers.UnlockUser)
+			protected.DELETE("/users/:id/2fa", can(models.PermUserManage), handlers.ResetUserTwoFactor)
+			protected.GET("/login-attempts", can(models.PermUserManage), handlers.GetLoginAttempts)
+			protected.GET("/invites", can(models.PermUserManage), handlers.GetInvites)
+			protected.POST("/invites", can(models.PermUserManage), handlers.CreateInvite)
+			protected.DELETE("/invites/:id", can(models.PermUserManage), handlers.RevokeInvite)
+			protected.GET("/permissions", can(models.PermRoleManage), handlers.GetPermissions)
+			protected.GET("/roles", can(models.PermRoleManage), handlers.GetRoles)
+			protected.POST("/roles", can(models.PermRoleManage), handlers.CreateRole)
+			protected.PUT("/roles/:id", can(models.PermRoleManage), handlers.UpdateRole)
+			protected.DELETE("/roles/:id", can(models.PermRoleManage), handlers.DeleteRole)
+
+			// Location routes
+			protected.POST("/locations", can(models.PermLocationManage), handlers.CreateLocation)
+			protected.PUT("/locations/:id", can(models.PermLocationManage), handlers.UpdateLocation)
+			protected.DELETE("/locations/:id", can(models.PermLocationManage), handlers.DeleteLocation)
+
+			// Till terminals cashiers log in on with a PIN
+			protected.GET("/terminals", can(models.PermTerminalManage), handlers.GetTerminals)
+			protected.POST("/terminals", can(models.PermTerminalManage), handlers.CreateTerminal)
+			protected.PUT("/terminals/:id", can(models.PermTerminalManage), handlers.UpdateTerminal)
+			protected.POST("/terminals/:id/rotate-key", can(models.PermTerminalManage), handlers.RotateTerminalKey)
+			protected.DELETE("/terminals/:id", can(models.PermTerminalManage), handlers.DeleteTerminal)
+
+			// Tags and the custom attributes products can have
+			protected.POST("/tags", can(models.PermCatalogManage), handlers.CreateTag)
+			protected.PUT("/tags/:id", can(models.PermCatalogManage), handlers.UpdateTag)
+			protected.DELETE("/tags/:id", can(models.PermCatalogManage), handlers.DeleteTag)
+			protected.POST("/attributes", can(models.PermCatalogManage), handlers.CreateAttributeDefinition)
+			protected.PUT("/attributes/:id", can(models.PermCatalogManage), handlers.UpdateAttributeDefinition)
+			protected.DELETE("/attributes/:id", can(models.PermCatalogManage), handlers.DeleteAttributeDefinition)
+
+			// Price lists and quantity breaks
+			protected.POST("/price-lists", can(models.PermPricingManage), handlers.CreatePriceList)
+			protected.PUT("/price-lists/:id", can(models.PermPricingManage), handlers.UpdatePriceList)
+			protected.DELETE("/price-lists/:id", can(models.PermPricingManage), handlers.DeletePriceList)
+			protected.PUT("/price-lists/:id/prices", can(models.PermPricingManage), handlers.SetPriceListPrices)
+			protected.DELETE("/price-lists/:id/prices/:productId", can(models.PermPricingManage), handlers.DeletePriceListPrices)
+
+			// Scheduled price changes and price history
+			protected.GET("/price-changes", can(models.PermPricingManage), handlers.GetPriceChanges)
+			protected.POST("/price-changes", can(models.PermPricingManage), handlers.CreatePriceChange)
+			protected.POST("/price-changes/:id/cancel", can(models.PermPricingManage), handlers.CancelPriceChange)
+			protected.POST("/price-changes/batches/:batchNo/cancel", can(models.PermPricingManage), handlers.CancelPriceChangeBatch)
+			protected.GET("/products/:id/price-history", can(models.PermPricingManage), handlers.GetPriceHistory)
+
+			// Purchasing routes
+			protected.GET("/suppliers", can(models.PermPurchaseView), handlers.GetSuppliers)
+			protected.POST("/suppliers", can(models.PermPurchaseWrite), handlers.CreateSupplier)
+			protected.PUT("/suppliers/:id", can(models.PermPurchaseWrite), handlers.UpdateSupplier)
+			protected.DELETE("/suppliers/:id", can(models.PermPurchaseWrite), handlers.DeleteSupplier)
+
+			protected.GET("/purchase-orders", can(models.PermPurchaseView), handlers.GetPurchaseOrders)
+			protected.GET("/purchase-orders/:id", can(models.PermPurchaseView), handlers.GetPurchaseOrder)
+			protected.POST("/purchase-orders", can(models.PermPurchaseWrite), handlers.CreatePurchaseOrder)
+			protected.POST("/purchase-orders/from-suggestions", can(models.PermPurchaseWrite), handlers.CreatePurchaseOrdersFromSuggestions)
+			protected.PUT("/purchase-orders/:id", can(models.PermPurchaseWrite), handlers.UpdatePurchaseOrder)
+			protected.POST("/purchase-orders/:id/order", can(models.PermPurchaseWrite), handlers.OrderPurchaseOrder)
+			protected.POST("/purchase-orders/:id/cancel", can(models.PermPurchaseWrite), handlers.CancelPurchaseOrder)
+			protected.POST("/purchase-orders/:id/close", can(models.PermPurchaseWrite), handlers.ClosePurchaseOrder)
+
+			protected.GET("/goods-receipts", can(models.PermPurchaseView), handlers.GetGoodsReceipts)
+			protected.GET("/goods-receipts/:id", can(models.PermPurchaseView), handlers.GetGoodsReceipt)
+			protected.POST("/goods-receipts", can(models.PermPurchaseWrite), handlers.CreateGoodsReceipt)
+
+			// Trash of deleted records and its audit log
+			protected.GET("/trash", can(models.PermTrashManage), handlers.GetTrash)
+			protected.GET("/trash/events", can(models.PermTrashManage), handlers.GetTrashEvents)
+			protected.POST("/trash/purge", can(models.PermTrashManage), handlers.PurgeExpiredTrash)
+			protected.GET("/trash/:type", can(models.PermTrashManage), handlers.GetTrashItems)
+			protected.POST("/trash/:type/:id/restore", can(models.PermTrashManage), handlers.RestoreTrashItem)
+			protected.DELETE("/trash/:type/:id", can(models.PermTrashManage), handlers.PurgeTrashItem)
+
+			// Stock ledger
+			protected.GET("/stock-movements", can(models.PermStockView), handlers.GetStockMovements)
+			protected.POST("/lots/:id/write-off", can(models.PermStockAdjust), handlers.WriteOffLot)
+			protected.POST("/products/:id/serials", can(models.PermStockAdjust), handlers.RegisterProductSerials)
+
+			// Bulk product import and export
+			protected.POST("/products/import", can(models.PermProductImport), handlers.ImportProducts)
+			protected.GET("/products/export", can(models.PermProductImport), handlers.ExportProducts)
+			protected.POST("/products/barcodes/generate", can(models.PermProductImport), handlers.GenerateBarcodes)
+
+			// Reports
+			protected.GET("/reports/profit", can(models.PermReportView), handlers.GetProfitReport)
+			protected.GET("/reports/near-expiry", can(models.PermReportView), handlers.GetNearExpiryReport)
+			protected.GET("/reports/reorder-suggestions", can(models.PermReportView), handlers.GetReorderSuggestions)
 		}
 	}
 
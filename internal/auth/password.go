@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"POS-Golang/internal/models"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicy sets what new passwords must contain. It applies whenever
+// a password is set, not to passwords already in use.
+type PasswordPolicy struct {
+	MinLength     int  `json:"min_length"`
+	RequireUpper  bool `json:"require_upper"`
+	RequireLower  bool `json:"require_lower"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+}
+
+// bcrypt only uses the first 72 bytes of a password
+const maxPasswordBytes = 72
+
+// Policy new passwords are checked against, set at startup
+var passwordPolicy = PasswordPolicy{MinLength: 8}
+
+// SetPasswordPolicy sets the policy new passwords are checked against
+func SetPasswordPolicy(policy PasswordPolicy) {
+	passwordPolicy = policy
+}
+
+// CurrentPasswordPolicy returns the policy new passwords are checked
+// against, for clients to show
+func CurrentPasswordPolicy() PasswordPolicy {
+	return passwordPolicy
+}
+
+// CheckPassword returns why a new password for user does not meet the
+// policy, or nil if it does. A password may not be the user's username or
+// email whatever the policy.
+func CheckPassword(password string, user *models.User) error {
+	policy := passwordPolicy
+	if n := len([]rune(password)); n < policy.MinLength {
+		return fmt.Errorf("password must be at least %d characters", policy.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+	if user != nil && (strings.EqualFold(password, user.Username) || strings.EqualFold(password, user.Email)) {
+		return errors.New("password must not be your username or email")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	var missing []string
+	if policy.RequireUpper && !upper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if policy.RequireLower && !lower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if policy.RequireDigit && !digit {
+		missing = append(missing, "a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("password must contain %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"POS-Golang/internal/models"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// Access is the role of a signed-in user and the permissions it gives them
+type Access struct {
+	Role        string
+	Permissions []string
+	// MustChangePassword is set while the user has to change their password
+	MustChangePassword bool
+}
+
+// Can reports whether the user has a permission. The admin role has every
+// permission, including ones added after its row was created.
+func (a Access) Can(permission string) bool {
+	return a.Role == models.RoleAdmin || slices.Contains(a.Permissions, permission)
+}
+
+// RolePermissions returns the permissions a role gives, or nil for a role
+// that does not exist
+func RolePermissions(db *gorm.DB, role string) ([]string, error) {
+	if role == models.RoleAdmin {
+		return models.PermissionNames(), nil
+	}
+
+	var roles []models.Role
+	if err := db.Where("name = ?", role).Limit(1).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, nil
+	}
+	return roles[0].Permissions, nil
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"POS-Golang/internal/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrUnknownTerminal = errors.New("unknown or inactive terminal")
+
+// NewTerminalKey returns a new terminal key and the hash to store. The key
+// itself is shown once, when the terminal is registered or its key is
+// replaced.
+func NewTerminalKey() (string, string, error) {
+	return NewSecret("trm_")
+}
+
+// FindTerminal returns the active terminal with the key, noting that it was
+// seen from ip
+func FindTerminal(db *gorm.DB, key, ip string) (*models.Terminal, error) {
+	var terminal models.Terminal
+	err := db.Where("key_hash = ? AND is_active = ?", HashSecret(key), true).First(&terminal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownTerminal
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	terminal.LastSeenAt = &now
+	terminal.LastIP = ip
+	if err := db.Model(&terminal).UpdateColumns(map[string]interface{}{
+		"last_seen_at": now,
+		"last_ip":      ip,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &terminal, nil
+}
+
+// RevokeTerminal ends every session started on a terminal
+func RevokeTerminal(tx *gorm.DB, terminalID uint) error {
+	return revoke(tx.Where("terminal_id = ?", terminalID), models.RevokeTerminal)
+}
@@ -0,0 +1,314 @@
+// Package auth issues the tokens users sign in with and keeps track of the
+// sessions they belong to. Access tokens are short-lived JWTs naming their
+// session; refresh tokens are random, single use and stored hashed, and
+// trade for a new pair of tokens. A refresh token used twice means it was
+// stolen, so its whole session is revoked.
+package auth
+
+import (
+	"POS-Golang/internal/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Token settings, set at startup
+var (
+	secret     []byte
+	accessTTL  = 15 * time.Minute
+	refreshTTL = 30 * 24 * time.Hour
+	idleLock   = 5 * time.Minute
+)
+
+// Configure sets the key access tokens are signed with and how long access
+// and refresh tokens last
+func Configure(jwtSecret string, access, refresh time.Duration) {
+	secret = []byte(jwtSecret)
+	accessTTL = access
+	refreshTTL = refresh
+}
+
+// SetIdleLock sets how long a PIN login on a terminal can go unused before
+// it locks
+func SetIdleLock(idle time.Duration) {
+	idleLock = idle
+}
+
+var (
+	ErrInvalidToken = errors.New("invalid or expired refresh token")
+	ErrTokenReused  = errors.New("refresh token was already used, so its session has been revoked")
+	ErrRevoked      = errors.New("session has ended")
+	ErrLocked       = errors.New("terminal locked after going unused, enter your PIN")
+)
+
+// How often a session's last use is written, to save a write per request
+const touchInterval = 15 * time.Second
+
+// Tokens is the pair of tokens handed out on login and refresh
+type Tokens struct {
+	AccessToken      string    `json:"token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresAt        time.Time `json:"expires_at"` // when the access token expires
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// Login starts a new session for the user and returns its first tokens.
+// Sessions started with a PIN on a terminal name it, and lock when left
+// idle.
+func Login(tx *gorm.DB, user *models.User, userAgent, ip string, terminalID *uint) (*Tokens, error) {
+	now := time.Now()
+	session := models.Session{
+		UserID:     user.ID,
+		TerminalID: terminalID,
+		UserAgent:  truncate(userAgent, 255),
+		IP:         ip,
+		ExpiresAt:  now.Add(refreshTTL),
+		LastUsedAt: now,
+	}
+	if err := tx.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return issue(tx, &session, user, now)
+}
+
+// Refresh trades a refresh token for a new pair of tokens. A token that was
+// already traded in revokes its session and returns ErrTokenReused.
+func Refresh(db *gorm.DB, refreshToken, ip string) (*Tokens, *models.User, error) {
+	var tokens *Tokens
+	var user models.User
+	var failure error
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var stored models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", HashSecret(refreshToken)).First(&stored).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			failure = ErrInvalidToken
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var session models.Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, stored.SessionID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if stored.UsedAt != nil {
+			// Revocations are committed even though the refresh fails
+			failure = ErrTokenReused
+			if session.RevokedAt != nil {
+				return nil
+			}
+			return revoke(tx.Where("id = ?", session.ID), models.RevokeTokenReuse)
+		}
+		if session.RevokedAt != nil || now.After(stored.ExpiresAt) {
+			failure = ErrInvalidToken
+			return nil
+		}
+		if idle(&session, now) {
+			failure = ErrLocked
+			return revoke(tx.Where("id = ?", session.ID), models.RevokeIdle)
+		}
+		if err := tx.First(&user, session.UserID).Error; err != nil {
+			// Deleting a user revokes their sessions, but be safe
+			failure = ErrInvalidToken
+			return nil
+		}
+
+		if err := tx.Model(&stored).UpdateColumn("used_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&session).UpdateColumns(map[string]interface{}{
+			"ip":           ip,
+			"expires_at":   now.Add(refreshTTL),
+			"last_used_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		tokens, err = issue(tx, &session, &user, now)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if failure != nil {
+		return nil, nil, failure
+	}
+	return tokens, &user, nil
+}
+
+// Revoke ends a session
+func Revoke(tx *gorm.DB, sessionID uint, reason string) error {
+	return revoke(tx.Where("id = ?", sessionID), reason)
+}
+
+// RevokeUser ends every session of a user, as done when they are deleted,
+// change role or have their password changed
+func RevokeUser(tx *gorm.DB, userID uint, reason string) error {
+	return revoke(tx.Where("user_id = ?", userID), reason)
+}
+
+// RevokeOthers ends every session of a user but one, as done when they
+// change their own password
+func RevokeOthers(tx *gorm.DB, userID, keepSessionID uint, reason string) error {
+	return revoke(tx.Where("user_id = ? AND id != ?", userID, keepSessionID), reason)
+}
+
+func revoke(query *gorm.DB, reason string) error {
+	return query.Model(&models.Session{}).Where("revoked_at IS NULL").
+		UpdateColumns(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": reason}).Error
+}
+
+// CheckSession checks that an access token's session has not been revoked
+// and its user not deleted, returning the user's current role and the
+// permissions it gives. A terminal session left idle too long is locked.
+func CheckSession(db *gorm.DB, userID, sessionID uint) (Access, error) {
+	var row struct {
+		Role               string
+		Permissions        *string
+		MustChangePassword bool
+		TerminalID         *uint
+		LastUsedAt         time.Time
+		RevokedAt          *time.Time
+	}
+	err := db.Table("sessions").
+		Select("users.role, roles.permissions, users.must_change_password, sessions.terminal_id, sessions.last_used_at, sessions.revoked_at").
+		Joins("JOIN users ON users.id = sessions.user_id AND users.deleted_at IS NULL").
+		Joins("LEFT JOIN roles ON roles.name = users.role").
+		Where("sessions.id = ? AND sessions.user_id = ?", sessionID, userID).
+		Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && row.RevokedAt != nil) {
+		return Access{}, ErrRevoked
+	}
+	if err != nil {
+		return Access{}, err
+	}
+
+	now := time.Now()
+	session := models.Session{ID: sessionID, TerminalID: row.TerminalID, LastUsedAt: row.LastUsedAt}
+	if idle(&session, now) {
+		if err := revoke(db.Where("id = ?", sessionID), models.RevokeIdle); err != nil {
+			return Access{}, err
+		}
+		return Access{}, ErrLocked
+	}
+	if now.Sub(row.LastUsedAt) > touchInterval {
+		if err := db.Model(&models.Session{}).Where("id = ?", sessionID).
+			UpdateColumn("last_used_at", now).Error; err != nil {
+			return Access{}, err
+		}
+	}
+
+	access := Access{Role: row.Role, MustChangePassword: row.MustChangePassword}
+	if row.Permissions != nil {
+		if err := json.Unmarshal([]byte(*row.Permissions), &access.Permissions); err != nil {
+			return Access{}, err
+		}
+	}
+	return access, nil
+}
+
+// idle reports whether a terminal session has gone unused long enough to
+// lock
+func idle(session *models.Session, now time.Time) bool {
+	return session.TerminalID != nil && idleLock > 0 && now.Sub(session.LastUsedAt) > idleLock
+}
+
+// RunCleanup deletes expired refresh tokens and login challenges every
+// interval until the context is cancelled. Sessions are kept as a record
+// of sign-ins.
+func RunCleanup(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := db.Where("expires_at < ?", time.Now()).Delete(&models.RefreshToken{}).Error; err != nil {
+			log.Printf("token cleanup: %v", err)
+		}
+		if err := db.Where("expires_at < ?", time.Now()).Delete(&models.LoginChallenge{}).Error; err != nil {
+			log.Printf("token cleanup: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// issue creates an access token and a refresh token for the session
+func issue(tx *gorm.DB, session *models.Session, user *models.User, now time.Time) (*Tokens, error) {
+	expiresAt := now.Add(accessTTL)
+	access, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"role":       user.Role,
+		"session_id": session.ID,
+		"iat":        now.Unix(),
+		"exp":        expiresAt.Unix(),
+	}).SignedString(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, hash, err := NewSecret("")
+	if err != nil {
+		return nil, err
+	}
+	stored := models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hash,
+		ExpiresAt: now.Add(refreshTTL),
+	}
+	if err := tx.Create(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	return &Tokens{
+		AccessToken:      access,
+		TokenType:        "Bearer",
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: stored.ExpiresAt,
+	}, nil
+}
+
+// NewSecret returns a new random token starting with prefix, and the hash
+// to store in its place
+func NewSecret(prefix string) (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := prefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashSecret(token), nil
+}
+
+// HashSecret returns the stored hash of a token made by NewSecret
+func HashSecret(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,174 @@
+// Package barcode validates, generates and encodes EAN-8, EAN-13 and UPC-A
+// barcodes.
+package barcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// InternalPrefix starts the EAN-13 barcodes generated for products that
+// arrive without one. GS1 reserves prefixes 200-299 for use inside a
+// company, so these never clash with a manufacturer's barcode.
+const InternalPrefix = "200"
+
+// Barcode symbologies
+const (
+	EAN8  = "EAN-8"
+	UPCA  = "UPC-A"
+	EAN13 = "EAN-13"
+)
+
+var (
+	ErrInvalidFormat     = errors.New("barcode must be 8 (EAN-8), 12 (UPC-A) or 13 (EAN-13) digits")
+	ErrInvalidCheckDigit = errors.New("barcode check digit is wrong")
+)
+
+// Type returns the symbology of a code by its length, or an empty string
+// when it is not all digits or of no supported length.
+func Type(code string) string {
+	if !isDigits(code) {
+		return ""
+	}
+	switch len(code) {
+	case 8:
+		return EAN8
+	case 12:
+		return UPCA
+	case 13:
+		return EAN13
+	}
+	return ""
+}
+
+// CheckDigit returns the GS1 check digit for the digits before it.
+func CheckDigit(payload string) (int, error) {
+	if payload == "" || !isDigits(payload) {
+		return 0, fmt.Errorf("barcode payload must be digits only")
+	}
+
+	// Weights alternate 3, 1, 3, ... starting from the rightmost digit
+	sum := 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		digit := int(payload[i] - '0')
+		if (len(payload)-1-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return (10 - sum%10) % 10, nil
+}
+
+// Validate checks the check digit of an EAN-8, UPC-A or EAN-13 barcode.
+// Codes of any other format, such as Code 128 or a supplier's own, have no
+// check digit to verify and are accepted as they are.
+func Validate(code string) error {
+	if Type(code) == "" {
+		return nil
+	}
+
+	check, err := CheckDigit(code[:len(code)-1])
+	if err != nil {
+		return err
+	}
+	if int(code[len(code)-1]-'0') != check {
+		return ErrInvalidCheckDigit
+	}
+	return nil
+}
+
+// Internal returns the internal EAN-13 barcode for a sequence number,
+// which is normally the product ID.
+func Internal(n uint) (string, error) {
+	if n == 0 || n > 999999999 {
+		return "", fmt.Errorf("internal barcode number %d is out of range", n)
+	}
+
+	payload := fmt.Sprintf("%s%09d", InternalPrefix, n)
+	check, err := CheckDigit(payload)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d", payload, check), nil
+}
+
+// IsInternal reports whether code is a barcode generated by Internal.
+func IsInternal(code string) bool {
+	return Type(code) == EAN13 && code[:len(InternalPrefix)] == InternalPrefix
+}
+
+// Digit patterns, one module per character: L and G codes for the left half
+// of the symbol and R codes for the right half.
+var (
+	lCodes = [10]string{"0001101", "0011001", "0010011", "0111101", "0100011", "0110001", "0101111", "0111011", "0110111", "0001011"}
+	gCodes = [10]string{"0100111", "0110011", "0011011", "0100001", "0011101", "0111001", "0000101", "0010001", "0001001", "0010111"}
+	rCodes = [10]string{"1110010", "1100110", "1101100", "1000010", "1011100", "1001110", "1010000", "1000100", "1001000", "1110100"}
+
+	// EAN-13 carries its first digit in the mix of L and G codes used for
+	// the next six
+	firstDigitParity = [10]string{"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG", "LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL"}
+)
+
+const (
+	guard       = "101"
+	centreGuard = "01010"
+)
+
+// Modules returns the bar pattern of a valid code, one entry per module
+// with true for a dark bar. Quiet zones are not included.
+func Modules(code string) ([]bool, error) {
+	if Type(code) == "" {
+		return nil, ErrInvalidFormat
+	}
+	if err := Validate(code); err != nil {
+		return nil, err
+	}
+
+	var pattern string
+	switch len(code) {
+	case 8:
+		pattern = guard
+		for _, c := range code[:4] {
+			pattern += lCodes[c-'0']
+		}
+		pattern += centreGuard
+		for _, c := range code[4:] {
+			pattern += rCodes[c-'0']
+		}
+		pattern += guard
+	default:
+		// UPC-A is an EAN-13 whose first digit is 0
+		if len(code) == 12 {
+			code = "0" + code
+		}
+		parity := firstDigitParity[code[0]-'0']
+		pattern = guard
+		for i, c := range code[1:7] {
+			if parity[i] == 'G' {
+				pattern += gCodes[c-'0']
+			} else {
+				pattern += lCodes[c-'0']
+			}
+		}
+		pattern += centreGuard
+		for _, c := range code[7:] {
+			pattern += rCodes[c-'0']
+		}
+		pattern += guard
+	}
+
+	modules := make([]bool, len(pattern))
+	for i, c := range pattern {
+		modules[i] = c == '1'
+	}
+	return modules, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package barcode
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Kinds of value carried by a variable-measure barcode
+const (
+	EmbeddedWeight = "weight"
+	EmbeddedPrice  = "price"
+)
+
+// Embedded is a decoded variable-measure EAN-13 as printed by deli and
+// produce scales: a two-digit prefix starting with 2, the five-digit item
+// code (PLU) of the product, a five-digit value and the check digit.
+type Embedded struct {
+	Prefix string
+	PLU    string
+	Kind   string
+	Value  int // grams for weight, minor currency units for price
+}
+
+var (
+	weightPrefixes = map[string]bool{"21": true, "22": true, "23": true, "24": true, "25": true}
+	pricePrefixes  = map[string]bool{"26": true, "27": true, "28": true, "29": true}
+	priceDecimals  = 2
+)
+
+// SetEmbedded selects which 2x prefixes carry a weight and which a price,
+// and how many of the price digits are decimals. Prefix 20 is left for
+// internal barcodes and cannot be used.
+func SetEmbedded(weight, price []string, decimals int) error {
+	if decimals < 0 || decimals > 3 {
+		return fmt.Errorf("embedded price decimals must be between 0 and 3")
+	}
+
+	w := make(map[string]bool, len(weight))
+	p := make(map[string]bool, len(price))
+	for _, list := range []struct {
+		prefixes []string
+		into     map[string]bool
+	}{{weight, w}, {price, p}} {
+		for _, prefix := range list.prefixes {
+			prefix = strings.TrimSpace(prefix)
+			if prefix == "" {
+				continue
+			}
+			if len(prefix) != 2 || prefix[0] != '2' || !isDigits(prefix) {
+				return fmt.Errorf("invalid embedded barcode prefix %q: must be 21 to 29", prefix)
+			}
+			if strings.HasPrefix(InternalPrefix, prefix) {
+				return fmt.Errorf("embedded barcode prefix %s is used by internal barcodes", prefix)
+			}
+			if w[prefix] || p[prefix] {
+				return fmt.Errorf("embedded barcode prefix %s is listed twice", prefix)
+			}
+			list.into[prefix] = true
+		}
+	}
+
+	weightPrefixes, pricePrefixes, priceDecimals = w, p, decimals
+	return nil
+}
+
+// Kilograms returns the weight carried by a weight barcode.
+func (e Embedded) Kilograms() float64 {
+	return float64(e.Value) / 1000
+}
+
+// Amount returns the price carried by a price barcode.
+func (e Embedded) Amount() float64 {
+	return float64(e.Value) / math.Pow10(priceDecimals)
+}
+
+// DecodeEmbedded decodes a weight- or price-embedded EAN-13. The second
+// result is false when code is not one.
+func DecodeEmbedded(code string) (Embedded, bool) {
+	if Type(code) != EAN13 || Validate(code) != nil {
+		return Embedded{}, false
+	}
+
+	prefix := code[:2]
+	var kind string
+	switch {
+	case weightPrefixes[prefix]:
+		kind = EmbeddedWeight
+	case pricePrefixes[prefix]:
+		kind = EmbeddedPrice
+	default:
+		return Embedded{}, false
+	}
+
+	value, _ := strconv.Atoi(code[7:12])
+	return Embedded{Prefix: prefix, PLU: code[2:7], Kind: kind, Value: value}, true
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -10,6 +14,102 @@ type Config struct {
 	Port      string
 	JWTSecret string
 	DBDSN     string // ganti dari DBpath ke DBDSN
+
+	// Access tokens are short-lived; refresh tokens trade for new ones
+	// until they expire unused
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// CostMethod controls how goods receipts update product cost:
+	// "average" (moving average) or "last" (last landed cost)
+	CostMethod string
+
+	// Scale barcodes: the 2x prefixes that carry a weight or a price, and
+	// how many digits of an embedded price are decimals
+	WeightBarcodePrefixes []string
+	PriceBarcodePrefixes  []string
+	PriceBarcodeDecimals  int
+
+	// How often scheduled price changes are checked and applied
+	PriceSchedulerInterval time.Duration
+
+	// Product image storage: "local" keeps files under StorageDir, "s3"
+	// uses an S3-compatible bucket. Images are served under ImageBaseURL.
+	StorageDriver    string
+	StorageDir       string
+	S3Endpoint       string
+	S3Region         string
+	S3Bucket         string
+	S3AccessKey      string
+	S3SecretKey      string
+	S3PathStyle      bool
+	ImageBaseURL     string
+	ImageMaxUploadMB int
+
+	// How often the product search index is rebuilt in full, on top of
+	// the updates made as products change
+	SearchRefreshInterval time.Duration
+
+	// Public sign-up is off unless AllowRegistration is set; the first admin
+	// is created through setup, which needs SetupToken if one is set, and
+	// everyone else joins through invites valid for InviteTTL
+	AllowRegistration bool
+	SetupToken        string
+	InviteTTL         time.Duration
+
+	// New passwords must be at least PasswordMinLength long and contain
+	// the kinds of characters required
+	PasswordMinLength     int
+	PasswordRequireUpper  bool
+	PasswordRequireLower  bool
+	PasswordRequireDigit  bool
+	PasswordRequireSymbol bool
+
+	// Password reset links are mailed through MailDriver, "log" or "smtp",
+	// point to PasswordResetURL and work for PasswordResetTTL
+	MailDriver       string
+	MailFrom         string
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	PasswordResetURL string
+	PasswordResetTTL time.Duration
+
+	// Name authenticator apps show next to accounts set up for two-factor
+	// sign-in
+	TwoFactorIssuer string
+
+	// Failed logins lock out an account after LoginMaxAttempts and an IP
+	// address after LoginIPMaxAttempts, for LoginLockout doubling with each
+	// further failure up to LoginMaxLockout. RateLimitStore is "memory" or
+	// "db", which shares the counts between instances.
+	RateLimitStore     string
+	LoginMaxAttempts   int
+	LoginIPMaxAttempts int
+	LoginLockout       time.Duration
+	LoginMaxLockout    time.Duration
+
+	// Addresses or CIDR ranges of the reverse proxies whose X-Forwarded-For
+	// and X-Real-IP headers are believed. When empty the client address is
+	// the one the connection comes from, so clients cannot pick their own
+	// address for the IP lockout and the login audit log.
+	TrustedProxies []string
+
+	// PIN logins on terminals lock after TerminalIdleLock unused, and a
+	// user's PIN locks out for PINLockout after PINMaxAttempts wrong tries
+	TerminalIdleLock time.Duration
+	PINMaxAttempts   int
+	PINLockout       time.Duration
+
+	// Largest line discount, in percent, cashiers can give without a
+	// supervisor's approval
+	DiscountApprovalLimit float64
+
+	// Deleted records stay in the trash for TrashRetention before they are
+	// purged, checked every TrashPurgeInterval. Zero keeps them for good.
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
 }
 
 func Load() (*Config, error) {
@@ -19,7 +119,182 @@ func Load() (*Config, error) {
 		Port:      getEnv("PORT", "8080"),
 		JWTSecret: getEnv("JWT_SECRET", "POS_Golang_2024_SuperSecretKey_!@#$%^&*()_+1234567890ABCDEFGHabcdefgh"),
 		DBDSN:     getEnv("DB_DSN", "root:@tcp(localhost:3306)/pos_db?parseTime=true"),
+
+		CostMethod: getEnv("COST_METHOD", "average"),
+
+		WeightBarcodePrefixes: strings.Split(getEnv("WEIGHT_BARCODE_PREFIXES", "21,22,23,24,25"), ","),
+		PriceBarcodePrefixes:  strings.Split(getEnv("PRICE_BARCODE_PREFIXES", "26,27,28,29"), ","),
+	}
+
+	accessTTL, err := time.ParseDuration(getEnv("ACCESS_TOKEN_TTL", "15m"))
+	if err != nil || accessTTL <= 0 {
+		return nil, fmt.Errorf("invalid ACCESS_TOKEN_TTL %q: must be a duration such as 15m", os.Getenv("ACCESS_TOKEN_TTL"))
+	}
+	config.AccessTokenTTL = accessTTL
+
+	refreshTTL, err := time.ParseDuration(getEnv("REFRESH_TOKEN_TTL", "720h"))
+	if err != nil || refreshTTL <= accessTTL {
+		return nil, fmt.Errorf("invalid REFRESH_TOKEN_TTL %q: must be a duration longer than ACCESS_TOKEN_TTL, such as 720h", os.Getenv("REFRESH_TOKEN_TTL"))
+	}
+	config.RefreshTokenTTL = refreshTTL
+
+	decimals, err := strconv.Atoi(getEnv("PRICE_BARCODE_DECIMALS", "2"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PRICE_BARCODE_DECIMALS: %w", err)
+	}
+	config.PriceBarcodeDecimals = decimals
+
+	interval, err := time.ParseDuration(getEnv("PRICE_SCHEDULER_INTERVAL", "1m"))
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid PRICE_SCHEDULER_INTERVAL %q: must be a duration such as 30s or 5m", os.Getenv("PRICE_SCHEDULER_INTERVAL"))
+	}
+	config.PriceSchedulerInterval = interval
+
+	config.StorageDriver = getEnv("STORAGE_DRIVER", "local")
+	config.StorageDir = getEnv("STORAGE_DIR", "./uploads")
+	config.S3Endpoint = getEnv("S3_ENDPOINT", "")
+	config.S3Region = getEnv("S3_REGION", "us-east-1")
+	config.S3Bucket = getEnv("S3_BUCKET", "")
+	config.S3AccessKey = getEnv("S3_ACCESS_KEY", "")
+	config.S3SecretKey = getEnv("S3_SECRET_KEY", "")
+	config.S3PathStyle = getEnv("S3_PATH_STYLE", "true") == "true"
+	config.ImageBaseURL = getEnv("IMAGE_BASE_URL", "/api/v1/images")
+
+	maxUpload, err := strconv.Atoi(getEnv("IMAGE_MAX_UPLOAD_MB", "10"))
+	if err != nil || maxUpload <= 0 {
+		return nil, fmt.Errorf("invalid IMAGE_MAX_UPLOAD_MB %q: must be a positive number", os.Getenv("IMAGE_MAX_UPLOAD_MB"))
+	}
+	config.ImageMaxUploadMB = maxUpload
+
+	refresh, err := time.ParseDuration(getEnv("SEARCH_REFRESH_INTERVAL", "5m"))
+	if err != nil || refresh <= 0 {
+		return nil, fmt.Errorf("invalid SEARCH_REFRESH_INTERVAL %q: must be a duration such as 5m", os.Getenv("SEARCH_REFRESH_INTERVAL"))
+	}
+	config.SearchRefreshInterval = refresh
+
+	config.AllowRegistration = getEnv("ALLOW_REGISTRATION", "false") == "true"
+	config.SetupToken = getEnv("SETUP_TOKEN", "")
+
+	inviteTTL, err := time.ParseDuration(getEnv("INVITE_TTL", "72h"))
+	if err != nil || inviteTTL <= 0 {
+		return nil, fmt.Errorf("invalid INVITE_TTL %q: must be a duration such as 72h", os.Getenv("INVITE_TTL"))
+	}
+	config.InviteTTL = inviteTTL
+
+	minLength, err := strconv.Atoi(getEnv("PASSWORD_MIN_LENGTH", "8"))
+	if err != nil || minLength < 1 || minLength > 72 {
+		return nil, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q: must be a number from 1 to 72", os.Getenv("PASSWORD_MIN_LENGTH"))
+	}
+	config.PasswordMinLength = minLength
+	config.PasswordRequireUpper = getEnv("PASSWORD_REQUIRE_UPPER", "false") == "true"
+	config.PasswordRequireLower = getEnv("PASSWORD_REQUIRE_LOWER", "false") == "true"
+	config.PasswordRequireDigit = getEnv("PASSWORD_REQUIRE_DIGIT", "false") == "true"
+	config.PasswordRequireSymbol = getEnv("PASSWORD_REQUIRE_SYMBOL", "false") == "true"
+
+	config.MailDriver = getEnv("MAIL_DRIVER", "log")
+	config.MailFrom = getEnv("MAIL_FROM", "POS <no-reply@localhost>")
+	config.SMTPHost = getEnv("SMTP_HOST", "")
+	config.SMTPUsername = getEnv("SMTP_USERNAME", "")
+	config.SMTPPassword = getEnv("SMTP_PASSWORD", "")
+	config.PasswordResetURL = getEnv("PASSWORD_RESET_URL", "")
+
+	smtpPort, err := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+	if err != nil || smtpPort <= 0 || smtpPort > 65535 {
+		return nil, fmt.Errorf("invalid SMTP_PORT %q: must be a port number", os.Getenv("SMTP_PORT"))
+	}
+	config.SMTPPort = smtpPort
+
+	resetTTL, err := time.ParseDuration(getEnv("PASSWORD_RESET_TTL", "1h"))
+	if err != nil || resetTTL <= 0 {
+		return nil, fmt.Errorf("invalid PASSWORD_RESET_TTL %q: must be a duration such as 1h", os.Getenv("PASSWORD_RESET_TTL"))
+	}
+	config.PasswordResetTTL = resetTTL
+
+	config.TwoFactorIssuer = getEnv("TWO_FACTOR_ISSUER", "POS")
+
+	config.RateLimitStore = getEnv("RATE_LIMIT_STORE", "memory")
+	for _, proxy := range strings.Split(getEnv("TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			config.TrustedProxies = append(config.TrustedProxies, proxy)
+		}
+	}
+
+	loginAttempts, err := strconv.Atoi(getEnv("LOGIN_MAX_ATTEMPTS", "5"))
+	if err != nil || loginAttempts <= 0 {
+		return nil, fmt.Errorf("invalid LOGIN_MAX_ATTEMPTS %q: must be a positive number", os.Getenv("LOGIN_MAX_ATTEMPTS"))
+	}
+	config.LoginMaxAttempts = loginAttempts
+
+	ipAttempts, err := strconv.Atoi(getEnv("LOGIN_IP_MAX_ATTEMPTS", "20"))
+	if err != nil || ipAttempts <= 0 {
+		return nil, fmt.Errorf("invalid LOGIN_IP_MAX_ATTEMPTS %q: must be a positive number", os.Getenv("LOGIN_IP_MAX_ATTEMPTS"))
+	}
+	config.LoginIPMaxAttempts = ipAttempts
+
+	loginLockout, err := time.ParseDuration(getEnv("LOGIN_LOCKOUT", "1m"))
+	if err != nil || loginLockout <= 0 {
+		return nil, fmt.Errorf("invalid LOGIN_LOCKOUT %q: must be a duration such as 1m", os.Getenv("LOGIN_LOCKOUT"))
+	}
+	config.LoginLockout = loginLockout
+
+	maxLockout, err := time.ParseDuration(getEnv("LOGIN_MAX_LOCKOUT", "1h"))
+	if err != nil || maxLockout < loginLockout {
+		return nil, fmt.Errorf("invalid LOGIN_MAX_LOCKOUT %q: must be a duration no shorter than LOGIN_LOCKOUT, such as 1h", os.Getenv("LOGIN_MAX_LOCKOUT"))
+	}
+	config.LoginMaxLockout = maxLockout
+
+	idleLock, err := time.ParseDuration(getEnv("TERMINAL_IDLE_LOCK", "5m"))
+	if err != nil || idleLock < 0 {
+		return nil, fmt.Errorf("invalid TERMINAL_IDLE_LOCK %q: must be a duration such as 5m, or 0 to never lock", os.Getenv("TERMINAL_IDLE_LOCK"))
+	}
+	config.TerminalIdleLock = idleLock
+
+	pinAttempts, err := strconv.Atoi(getEnv("PIN_MAX_ATTEMPTS", "5"))
+	if err != nil || pinAttempts <= 0 {
+		return nil, fmt.Errorf("invalid PIN_MAX_ATTEMPTS %q: must be a positive number", os.Getenv("PIN_MAX_ATTEMPTS"))
+	}
+	config.PINMaxAttempts = pinAttempts
+
+	pinLockout, err := time.ParseDuration(getEnv("PIN_LOCKOUT", "15m"))
+	if err != nil || pinLockout <= 0 {
+		return nil, fmt.Errorf("invalid PIN_LOCKOUT %q: must be a duration such as 15m", os.Getenv("PIN_LOCKOUT"))
+	}
+	config.PINLockout = pinLockout
+
+	discountLimit, err := strconv.ParseFloat(getEnv("DISCOUNT_APPROVAL_LIMIT", "10"), 64)
+	if err != nil || discountLimit < 0 || discountLimit > 100 {
+		return nil, fmt.Errorf("invalid DISCOUNT_APPROVAL_LIMIT %q: must be a percentage from 0 to 100", os.Getenv("DISCOUNT_APPROVAL_LIMIT"))
+	}
+	config.DiscountApprovalLimit = discountLimit
+
+	retentionDays, err := strconv.Atoi(getEnv("TRASH_RETENTION_DAYS", "30"))
+	if err != nil || retentionDays < 0 {
+		return nil, fmt.Errorf("invalid TRASH_RETENTION_DAYS %q: must be a number of days, or 0 to keep deleted records", os.Getenv("TRASH_RETENTION_DAYS"))
+	}
+	config.TrashRetention = time.Duration(retentionDays) * 24 * time.Hour
+
+	purgeInterval, err := time.ParseDuration(getEnv("TRASH_PURGE_INTERVAL", "1h"))
+	if err != nil || purgeInterval <= 0 {
+		return nil, fmt.Errorf("invalid TRASH_PURGE_INTERVAL %q: must be a duration such as 1h", os.Getenv("TRASH_PURGE_INTERVAL"))
 	}
+	config.TrashPurgeInterval = purgeInterval
+
+	if config.StorageDriver != "local" && config.StorageDriver != "s3" {
+		return nil, fmt.Errorf("invalid STORAGE_DRIVER %q: must be local or s3", config.StorageDriver)
+	}
+
+	if config.MailDriver != "log" && config.MailDriver != "smtp" {
+		return nil, fmt.Errorf("invalid MAIL_DRIVER %q: must be log or smtp", config.MailDriver)
+	}
+
+	if config.RateLimitStore != "memory" && config.RateLimitStore != "db" {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_STORE %q: must be memory or db", config.RateLimitStore)
+	}
+
+	if config.CostMethod != "average" && config.CostMethod != "last" {
+		return nil, fmt.Errorf("invalid COST_METHOD %q: must be average or last", config.CostMethod)
+	}
+
 	return config, nil
 }
 
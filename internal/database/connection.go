@@ -2,6 +2,7 @@ package database
 
 import (
 	"POS-Golang/internal/models"
+	"fmt"
 	"os"
 
 	"gorm.io/driver/mysql"
@@ -29,13 +30,173 @@ func Connect() error {
 	// Auto migrate models
 	err = DB.AutoMigrate(
 		&models.User{},
+		&models.Role{},
 		&models.Category{},
 		&models.Product{},
+		&models.ProductBarcode{},
+		&models.ProductImage{},
+		&models.Tag{},
+		&models.AttributeDefinition{},
+		&models.ProductAttribute{},
 		&models.Transaction{},
 		&models.TransactionItem{},
+		&models.StockMovement{},
+		&models.Supplier{},
+		&models.PurchaseOrder{},
+		&models.PurchaseOrderItem{},
+		&models.GoodsReceipt{},
+		&models.GoodsReceiptItem{},
+		&models.StockLot{},
+		&models.TransactionItemLot{},
+		&models.SerialNumber{},
+		&models.TransactionItemSerial{},
+		&models.Location{},
+		&models.StockLevel{},
+		&models.StockTransfer{},
+		&models.StockTransferItem{},
+		&models.StockTransferItemLot{},
+		&models.StockTransferItemSerial{},
+		&models.PriceList{},
+		&models.PriceListItem{},
+		&models.Customer{},
+		&models.PriceChange{},
+		&models.PriceHistory{},
+		&models.TrashEvent{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.Approval{},
+		&models.Terminal{},
+		&models.Invite{},
+		&models.LoginAttempt{},
+		&models.RateLimit{},
+		&models.PasswordReset{},
+		&models.TwoFactor{},
+		&models.RecoveryCode{},
+		&models.LoginChallenge{},
 	)
+	if err != nil {
+		return err
+	}
+
+	if err := clearEmptyBarcodes(); err != nil {
+		return err
+	}
+
+	if err := migrateLiveUniqueIndexes(); err != nil {
+		return err
+	}
+
+	if err := seedDefaultLocation(); err != nil {
+		return err
+	}
+
+	if err := seedRoles(); err != nil {
+		return err
+	}
+
+	return backfillCategoryPaths()
+}
+
+// Columns that are unique among rows not in the trash, so a deleted
+// product's barcode or a deleted user's email can be used again. Document
+// numbers such as transaction_no stay unique for good.
+var liveUniqueColumns = []struct {
+	table   string
+	columns []string
+}{
+	{"products", []string{"barcode", "sku", "plu"}},
+	{"users", []string{"username", "email"}},
+}
+
+// migrateLiveUniqueIndexes gives each table a generated live column that is
+// 1 for rows not deleted and NULL for deleted ones, and makes the unique
+// indexes span it. MySQL lets NULLs repeat in a unique index, so only rows
+// not deleted have to be unique. The plain unique indexes these replace
+// are dropped by AutoMigrate once the model no longer asks for them.
+func migrateLiveUniqueIndexes() error {
+	migrator := DB.Migrator()
+	for _, table := range liveUniqueColumns {
+		if !migrator.HasColumn(table.table, "live") {
+			sql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN live TINYINT(1) "+
+				"GENERATED ALWAYS AS (IF(deleted_at IS NULL, 1, NULL)) VIRTUAL", table.table)
+			if err := DB.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, column := range table.columns {
+			index := fmt.Sprintf("idx_%s_%s_live", table.table, column)
+			if migrator.HasIndex(table.table, index) {
+				continue
+			}
+			sql := fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s, live)", index, table.table, column)
+			if err := DB.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// clearEmptyBarcodes stores the barcode of products without one as NULL, as
+// it was once saved as an empty string that the unique index refuses twice.
+func clearEmptyBarcodes() error {
+	return DB.Exec("UPDATE products SET barcode = NULL WHERE barcode = ''").Error
+}
+
+// backfillCategoryPaths makes categories created before nesting existed
+// top-level categories.
+func backfillCategoryPaths() error {
+	return DB.Exec("UPDATE categories SET path = CONCAT('/', id, '/'), depth = 0 " +
+		"WHERE (path IS NULL OR path = '') AND parent_id IS NULL").Error
+}
+
+// seedRoles creates any built-in role that is missing. Roles already there
+// are left alone, so changes made to their permissions are kept.
+func seedRoles() error {
+	for _, role := range models.DefaultRoles {
+		if err := DB.Where("name = ?", role.Name).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedDefaultLocation creates the default store on first start and moves
+// any stock and documents recorded before locations existed into it.
+func seedDefaultLocation() error {
+	var count int64
+	if err := DB.Model(&models.Location{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		location := models.Location{
+			Code:     models.DefaultLocationCode,
+			Name:     "Main Store",
+			Type:     models.LocationStore,
+			IsActive: true,
+		}
+		if err := tx.Create(&location).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Exec("INSERT INTO stock_levels (product_id, location_id, quantity, updated_at) "+
+			"SELECT id, ?, stock, NOW() FROM products WHERE stock != 0", location.ID).Error; err != nil {
+			return err
+		}
 
-	return err
+		tables := []string{"transactions", "stock_movements", "stock_lots", "serial_numbers", "purchase_orders", "goods_receipts"}
+		for _, table := range tables {
+			if err := tx.Exec(fmt.Sprintf("UPDATE %s SET location_id = ? WHERE location_id = 0", table), location.ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func GetDB() *gorm.DB {
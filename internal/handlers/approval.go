@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"POS-Golang/internal/auth"
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Largest discount, in percent of a line, given without approval; set at
+// startup
+var discountApprovalLimit = 10.0
+
+// SetDiscountApprovalLimit sets the largest line discount, in percent, that
+// users without the discount permission can give on their own
+func SetDiscountApprovalLimit(percent float64) {
+	discountApprovalLimit = percent
+}
+
+// ApprovalRequest is a supervisor authorising a sensitive action at the
+// cashier's till by entering their PIN, without the cashier logging out
+type ApprovalRequest struct {
+	Username string `json:"username" validate:"required"`
+	PIN      string `json:"pin" validate:"required"`
+}
+
+type SetPINRequest struct {
+	Password string `json:"password" validate:"required"` // current password, to confirm it is the user
+	PIN      string `json:"pin" validate:"required,numeric,min=4,max=6"`
+}
+
+type NoSaleRequest struct {
+	Reason   string           `json:"reason" validate:"required,max=255"`
+	Approval *ApprovalRequest `json:"approval"`
+}
+
+// approvalError is returned when the actions of a request need a
+// supervisor's approval that was missing or not valid
+type approvalError struct {
+	message string
+	actions []string
+}
+
+func (e *approvalError) Error() string {
+	return e.message
+}
+
+// approver returns who authorises the actions: the signed-in user when
+// their role covers them all, otherwise the supervisor named in the
+// approval, whose PIN must match and whose role must cover them all
+func approver(c *gin.Context, db *gorm.DB, approval *ApprovalRequest, actions ...string) (uint, error) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return 0, fmt.Errorf("user not authenticated")
+	}
+
+	var missing []string
+	for _, action := range actions {
+		if !can(c, models.ApprovalPermissions[action]) && !slices.Contains(missing, action) {
+			missing = append(missing, action)
+		}
+	}
+	if len(missing) == 0 {
+		return userID, nil
+	}
+
+	required := fmt.Sprintf("supervisor approval is required for: %s", strings.Join(missing, ", "))
+	if approval == nil {
+		return 0, &approvalError{message: required, actions: missing}
+	}
+	if err := validate.Struct(approval); err != nil {
+		return 0, &approvalError{message: "approval needs a username and PIN", actions: missing}
+	}
+
+	var supervisor models.User
+	if err := db.Where("username = ? OR email = ?", approval.Username, approval.Username).First(&supervisor).Error; err != nil {
+		return 0, &approvalError{message: "invalid supervisor username or PIN", actions: missing}
+	}
+	// Wrong PINs count towards the same lockout as PIN logins
+	ok, wait, err := checkPIN(&supervisor, approval.PIN)
+	if err != nil {
+		return 0, err
+	}
+	if wait > 0 {
+		return 0, &approvalError{message: "too many wrong PINs, try again later", actions: missing}
+	}
+	if !ok {
+		return 0, &approvalError{message: "invalid supervisor username or PIN", actions: missing}
+	}
+	if supervisor.ID == userID {
+		return 0, &approvalError{message: "another user must approve this", actions: missing}
+	}
+
+	permissions, err := auth.RolePermissions(db, supervisor.Role)
+	if err != nil {
+		return 0, err
+	}
+	access := auth.Access{Role: supervisor.Role, Permissions: permissions}
+	for _, action := range missing {
+		if !access.Can(models.ApprovalPermissions[action]) {
+			return 0, &approvalError{message: fmt.Sprintf("%s cannot approve %s", supervisor.Username, action), actions: missing}
+		}
+	}
+	return supervisor.ID, nil
+}
+
+// approvalFailed writes the response for an error from approver
+func approvalFailed(c *gin.Context, err error) {
+	if approvalErr, ok := err.(*approvalError); ok {
+		c.JSON(http.StatusForbidden, utils.Response{
+			Success: false,
+			Message: "Supervisor approval required",
+			Error:   approvalErr.Error(),
+			Data:    gin.H{"actions": approvalErr.actions},
+		})
+		return
+	}
+	utils.InternalServerErrorResponse(c, "Failed to check approval", err)
+}
+
+// Set the signed-in user's supervisor PIN
+func SetMyPIN(c *gin.Context) {
+	var req SetPINRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	userID, _ := currentUserID(c)
+	db := database.GetDB()
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		utils.NotFoundResponse(c, "User not found")
+		return
+	}
+
+	// Wrong passwords count towards the login lockout, so this cannot be
+	// used to guess the password instead
+	if wait, err := accountLimiter.Blocked(accountKey(user.ID)); err != nil || wait > 0 {
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to check login attempts", err)
+			return
+		}
+		lockedOut(c, "Too many wrong passwords, try again later", wait)
+		return
+	}
+	if !user.CheckPassword(req.Password) {
+		loginFailed(ipKey(c.ClientIP()), accountKey(user.ID))
+		utils.ErrorResponse(c, "Password is incorrect", nil)
+		return
+	}
+	if err := accountLimiter.Reset(accountKey(user.ID)); err != nil {
+		log.Printf("login limiter: %v", err)
+	}
+
+	if err := user.SetPIN(req.PIN); err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to set PIN", err)
+		return
+	}
+	if err := db.Model(&user).UpdateColumn("pin_hash", user.PINHash).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to set PIN", err)
+		return
+	}
+	if err := pinLimiter.Reset(pinKey(user.ID)); err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to unlock PIN", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "PIN set successfully", nil)
+}
+
+// Open the cash drawer without a sale. The opening is recorded, with the
+// supervisor who approved it when the user cannot approve it themselves.
+func OpenDrawerNoSale(c *gin.Context) {
+	var req NoSaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	locationID, err := operatingLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	db := database.GetDB()
+	approverID, err := approver(c, db, req.Approval, models.ApprovalNoSale)
+	if err != nil {
+		approvalFailed(c, err)
+		return
+	}
+
+	userID, _ := currentUserID(c)
+	approval := models.Approval{
+		Action:        models.ApprovalNoSale,
+		ApproverID:    approverID,
+		RequestedByID: userID,
+		LocationID:    locationID,
+		Reason:        req.Reason,
+	}
+	if err := db.Create(&approval).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to record drawer opening", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Drawer opening approved", approval)
+}
+
+// Get the log of approved actions, newest first
+func GetApprovals(c *gin.Context) {
+	query := database.GetDB().Preload("Approver").Preload("RequestedBy")
+
+	locationID, err := scopedLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+	if locationID != 0 {
+		query = query.Where("location_id = ?", locationID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if approverID := c.Query("approver_id"); approverID != "" {
+		query = query.Where("approver_id = ?", approverID)
+	}
+	if requestedByID := c.Query("requested_by_id"); requestedByID != "" {
+		query = query.Where("requested_by_id = ?", requestedByID)
+	}
+	if transactionID := c.Query("transaction_id"); transactionID != "" {
+		query = query.Where("transaction_id = ?", transactionID)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		query = query.Where("DATE(created_at) >= ?", startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		query = query.Where("DATE(created_at) <= ?", endDate)
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+
+	var total int64
+	query.Model(&models.Approval{}).Count(&total)
+
+	var approvals []models.Approval
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&approvals).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch approvals", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Approvals fetched successfully", gin.H{
+		"approvals": approvals,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
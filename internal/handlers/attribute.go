@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Attribute codes are used as JSON keys and in attr[code] query filters
+var attributeCodePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+type AttributeDefinitionRequest struct {
+	Code      string   `json:"code" validate:"required,max=50"` // lower case letters, digits and underscores
+	Name      string   `json:"name" validate:"required,max=100"`
+	Type      string   `json:"type" validate:"required,oneof=text number boolean select multiselect"`
+	Options   []string `json:"options" validate:"omitempty,dive,required,max=191"`
+	Unit      string   `json:"unit" validate:"max=20"`
+	Required  bool     `json:"required"`
+	SortOrder int      `json:"sort_order"`
+}
+
+// Get all attribute definitions
+func GetAttributeDefinitions(c *gin.Context) {
+	var definitions []models.AttributeDefinition
+	if err := database.GetDB().Order("sort_order, name").Find(&definitions).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch attributes", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Attributes fetched successfully", definitions)
+}
+
+// Define a custom product attribute
+func CreateAttributeDefinition(c *gin.Context) {
+	req, ok := bindAttributeDefinition(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	var count int64
+	db.Model(&models.AttributeDefinition{}).Where("code = ?", req.Code).Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, "Attribute code already exists", nil)
+		return
+	}
+
+	definition := models.AttributeDefinition{}
+	applyAttributeDefinition(&definition, req)
+	if err := db.Create(&definition).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to create attribute", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Attribute created successfully", definition)
+}
+
+// Update an attribute definition. Its type can only change, and its options
+// only be dropped, while no product uses the values affected.
+func UpdateAttributeDefinition(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid attribute ID", err)
+		return
+	}
+
+	req, ok := bindAttributeDefinition(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	var definition models.AttributeDefinition
+	if err := db.First(&definition, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Attribute not found")
+		return
+	}
+
+	var count int64
+	db.Model(&models.AttributeDefinition{}).Where("code = ? AND id != ?", req.Code, definition.ID).Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, "Attribute code already exists", nil)
+		return
+	}
+
+	values := db.Model(&models.ProductAttribute{}).Where("attribute_id = ?", definition.ID)
+	if req.Type != definition.Type {
+		var used int64
+		values.Session(&gorm.Session{}).Count(&used)
+		if used > 0 {
+			utils.ErrorResponse(c, fmt.Sprintf("Cannot change the type of an attribute %d products use", used), nil)
+			return
+		}
+	} else if isChoiceAttribute(req.Type) {
+		var dropped []string
+		for _, option := range definition.Options {
+			if !slices.Contains(req.Options, option) {
+				dropped = append(dropped, option)
+			}
+		}
+		if len(dropped) > 0 {
+			var used []string
+			values.Session(&gorm.Session{}).Where("value_text IN ?", dropped).Distinct().Pluck("value_text", &used)
+			if len(used) > 0 {
+				utils.ErrorResponse(c, fmt.Sprintf("Options still in use: %s", strings.Join(used, ", ")), nil)
+				return
+			}
+		}
+	}
+
+	applyAttributeDefinition(&definition, req)
+	if err := db.Save(&definition).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to update attribute", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Attribute updated successfully", definition)
+}
+
+// Delete an attribute definition along with every product's value of it
+func DeleteAttributeDefinition(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid attribute ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var definition models.AttributeDefinition
+	if err := db.First(&definition, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Attribute not found")
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("attribute_id = ?", definition.ID).Delete(&models.ProductAttribute{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&definition).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to delete attribute", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Attribute deleted successfully", nil)
+}
+
+func bindAttributeDefinition(c *gin.Context) (AttributeDefinitionRequest, bool) {
+	var req AttributeDefinitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return req, false
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return req, false
+	}
+
+	req.Code = strings.ToLower(strings.TrimSpace(req.Code))
+	if !attributeCodePattern.MatchString(req.Code) {
+		utils.ErrorResponse(c, "Attribute codes may only contain letters, digits and underscores", nil)
+		return req, false
+	}
+	if isChoiceAttribute(req.Type) {
+		if len(req.Options) == 0 {
+			utils.ErrorResponse(c, "Select attributes need at least one option", nil)
+			return req, false
+		}
+		seen := make(map[string]bool, len(req.Options))
+		for _, option := range req.Options {
+			if seen[option] {
+				utils.ErrorResponse(c, fmt.Sprintf("Option %s is listed twice", option), nil)
+				return req, false
+			}
+			seen[option] = true
+		}
+	} else {
+		req.Options = nil
+	}
+	return req, true
+}
+
+func applyAttributeDefinition(definition *models.AttributeDefinition, req AttributeDefinitionRequest) {
+	definition.Code = req.Code
+	definition.Name = req.Name
+	definition.Type = req.Type
+	definition.Options = req.Options
+	definition.Unit = req.Unit
+	definition.Required = req.Required
+	definition.SortOrder = req.SortOrder
+}
+
+func isChoiceAttribute(attributeType string) bool {
+	return attributeType == models.AttributeSelect || attributeType == models.AttributeMultiSelect
+}
+
+// parseAttributeValues checks attribute values sent by code against their
+// definitions and turns them into rows. A null value leaves the attribute
+// unset. The values given replace all of a product's values, so every
+// required attribute must be among them. Required is only enforced when a
+// product's attributes are written: a product created or updated without
+// attributes, or by the product import, is not held back by it.
+func parseAttributeValues(db *gorm.DB, values map[string]interface{}) ([]models.ProductAttribute, error) {
+	var definitions []models.AttributeDefinition
+	if err := db.Find(&definitions).Error; err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]models.AttributeDefinition, len(definitions))
+	for _, definition := range definitions {
+		byCode[definition.Code] = definition
+	}
+	for code := range values {
+		if _, ok := byCode[code]; !ok {
+			return nil, fmt.Errorf("unknown attribute %s", code)
+		}
+	}
+
+	var rows []models.ProductAttribute
+	for _, definition := range definitions {
+		value := values[definition.Code]
+		parsed, err := parseAttributeValue(definition, value)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %w", definition.Code, err)
+		}
+		if len(parsed) == 0 && definition.Required {
+			return nil, fmt.Errorf("attribute %s is required", definition.Code)
+		}
+		rows = append(rows, parsed...)
+	}
+	return rows, nil
+}
+
+func parseAttributeValue(definition models.AttributeDefinition, value interface{}) ([]models.ProductAttribute, error) {
+	if value == nil {
+		return nil, nil
+	}
+	row := models.ProductAttribute{AttributeID: definition.ID}
+
+	switch definition.Type {
+	case models.AttributeNumber:
+		number, ok := value.(float64)
+		if !ok || math.IsInf(number, 0) || math.IsNaN(number) {
+			return nil, fmt.Errorf("must be a number")
+		}
+		row.ValueNumber = &number
+	case models.AttributeBoolean:
+		flag, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		row.ValueBool = &flag
+	case models.AttributeMultiSelect:
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("must be a list of options")
+		}
+		var rows []models.ProductAttribute
+		seen := make(map[string]bool, len(list))
+		for _, item := range list {
+			option, ok := item.(string)
+			if !ok || !slices.Contains(definition.Options, option) {
+				return nil, fmt.Errorf("%v is not one of %s", item, strings.Join(definition.Options, ", "))
+			}
+			if !seen[option] {
+				seen[option] = true
+				rows = append(rows, models.ProductAttribute{AttributeID: definition.ID, ValueText: option})
+			}
+		}
+		return rows, nil
+	default:
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be text")
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil, nil
+		}
+		if definition.Type == models.AttributeSelect && !slices.Contains(definition.Options, text) {
+			return nil, fmt.Errorf("%s is not one of %s", text, strings.Join(definition.Options, ", "))
+		}
+		if len(text) > 191 {
+			return nil, fmt.Errorf("is longer than 191 characters")
+		}
+		row.ValueText = text
+	}
+	return []models.ProductAttribute{row}, nil
+}
+
+// saveProductAttributes replaces all attribute values of a product
+func saveProductAttributes(tx *gorm.DB, productID uint, rows []models.ProductAttribute) error {
+	if err := tx.Where("product_id = ?", productID).Delete(&models.ProductAttribute{}).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	for i := range rows {
+		rows[i].ID = 0
+		rows[i].ProductID = productID
+	}
+	return tx.Create(&rows).Error
+}
+
+// fillProductAttributes sets the attribute values of each product, keyed by
+// attribute code
+func fillProductAttributes(db *gorm.DB, products []models.Product) {
+	if len(products) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+
+	var rows []models.ProductAttribute
+	db.Preload("Attribute").Where("product_id IN ?", ids).Order("id").Find(&rows)
+
+	byProduct := make(map[uint]map[string]interface{}, len(products))
+	for _, row := range rows {
+		values := byProduct[row.ProductID]
+		if values == nil {
+			values = make(map[string]interface{})
+			byProduct[row.ProductID] = values
+		}
+
+		code := row.Attribute.Code
+		switch row.Attribute.Type {
+		case models.AttributeNumber:
+			if row.ValueNumber != nil {
+				values[code] = *row.ValueNumber
+			}
+		case models.AttributeBoolean:
+			if row.ValueBool != nil {
+				values[code] = *row.ValueBool
+			}
+		case models.AttributeMultiSelect:
+			options, _ := values[code].([]string)
+			values[code] = append(options, row.ValueText)
+		default:
+			values[code] = row.ValueText
+		}
+	}
+	for i := range products {
+		products[i].Attributes = byProduct[products[i].ID]
+	}
+}
+
+// filterByAttributes narrows a product query to the attribute values given
+// by code. Numbers match a value or a min..max range (either end may be
+// left out), booleans match true or false, and select and multiselect
+// attributes match any of several comma separated options.
+func filterByAttributes(db, query *gorm.DB, filters map[string]string) (*gorm.DB, error) {
+	if len(filters) == 0 {
+		return query, nil
+	}
+
+	codes := make([]string, 0, len(filters))
+	for code := range filters {
+		codes = append(codes, code)
+	}
+	var definitions []models.AttributeDefinition
+	if err := db.Where("code IN ?", codes).Find(&definitions).Error; err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]models.AttributeDefinition, len(definitions))
+	for _, definition := range definitions {
+		byCode[definition.Code] = definition
+	}
+
+	const matches = "EXISTS (SELECT 1 FROM product_attributes WHERE product_attributes.product_id = products.id " +
+		"AND product_attributes.attribute_id = ? AND "
+	for code, value := range filters {
+		definition, ok := byCode[code]
+		if !ok {
+			return nil, fmt.Errorf("unknown attribute %s", code)
+		}
+
+		switch definition.Type {
+		case models.AttributeNumber:
+			low, high, err := parseNumberRange(value)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %s: %w", code, err)
+			}
+			if low != nil {
+				query = query.Where(matches+"product_attributes.value_number >= ?)", definition.ID, *low)
+			}
+			if high != nil {
+				query = query.Where(matches+"product_attributes.value_number <= ?)", definition.ID, *high)
+			}
+		case models.AttributeBoolean:
+			flag, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %s must be true or false", code)
+			}
+			query = query.Where(matches+"product_attributes.value_bool = ?)", definition.ID, flag)
+		case models.AttributeSelect, models.AttributeMultiSelect:
+			options := strings.Split(value, ",")
+			for i := range options {
+				options[i] = strings.TrimSpace(options[i])
+			}
+			query = query.Where(matches+"product_attributes.value_text IN ?)", definition.ID, options)
+		default:
+			query = query.Where(matches+"product_attributes.value_text = ?)", definition.ID, strings.TrimSpace(value))
+		}
+	}
+	return query, nil
+}
+
+// parseNumberRange reads a number or a min..max range
+func parseNumberRange(value string) (low, high *float64, err error) {
+	parse := func(s string) (*float64, error) {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, nil
+		}
+		number, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a number", s)
+		}
+		return &number, nil
+	}
+
+	from, to, isRange := strings.Cut(value, "..")
+	if !isRange {
+		low, err = parse(value)
+		if low == nil && err == nil {
+			err = fmt.Errorf("a number or min..max range is required")
+		}
+		return low, low, err
+	}
+	if low, err = parse(from); err != nil {
+		return nil, nil, err
+	}
+	high, err = parse(to)
+	return low, high, err
+}
@@ -1,17 +1,16 @@
 package handlers
 
 import (
+	"POS-Golang/internal/auth"
 	"POS-Golang/internal/database"
 	"POS-Golang/internal/models"
 	"POS-Golang/internal/utils"
+	"errors"
+	"log"
 	"net/http"
-	"time"
-
-	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 var validate = validator.New()
@@ -21,11 +20,48 @@ type LoginRequest struct {
 	Password        string `json:"password" validate:"required"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type LogoutRequest struct {
+	// AllDevices signs the user out of every session, not just this one
+	AllDevices bool `json:"all_devices"`
+}
+
+type SignUpRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=20"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"` // checked against the password policy
+}
+
 type RegisterRequest struct {
 	Username string `json:"username" validate:"required,min=3"`
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
-	Role     string `json:"role" validate:"required,oneof=admin cashier"`
+	Password string `json:"password" validate:"required"`    // checked against the password policy
+	Role     string `json:"role" validate:"required,max=50"` // name of a role in the roles table
+	// LocationID assigns the user to a store
+	LocationID *uint `json:"location_id"`
+	// MustChangePassword makes the user change their password when they
+	// next log in; left out, it stays as it is
+	MustChangePassword *bool `json:"must_change_password"`
+}
+
+// currentUserID returns the authenticated user's ID from the JWT claims.
+func currentUserID(c *gin.Context) (uint, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+	id, ok := userID.(float64)
+	return uint(id), ok
+}
+
+// can reports whether the authenticated user's role has a permission
+func can(c *gin.Context, permission string) bool {
+	access, _ := c.Get("access")
+	a, ok := access.(auth.Access)
+	return ok && a.Can(permission)
 }
 
 // Login handler
@@ -41,11 +77,26 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// Too many failed logins from one address lock it out, backing off
+	// exponentially, whichever account is tried
+	ip := c.ClientIP()
+	if wait, err := ipLimiter.Blocked(ipKey(ip)); err != nil || wait > 0 {
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to check login attempts", err)
+			return
+		}
+		recordLoginAttempt(c, models.LoginPassword, req.UsernameOrEmail, nil, nil, models.LoginIPLocked)
+		lockedOut(c, "Too many failed logins from this address, try again later", wait)
+		return
+	}
+
 	var user models.User
 	db := database.GetDB()
 
 	// Find user by username or email
 	if err := db.Where("username = ? OR email = ?", req.UsernameOrEmail, req.UsernameOrEmail).First(&user).Error; err != nil {
+		loginFailed(ipKey(ip))
+		recordLoginAttempt(c, models.LoginPassword, req.UsernameOrEmail, nil, nil, models.LoginInvalid)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"message": "Invalid credentials",
@@ -53,8 +104,21 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// And so do too many on one account, from wherever they come
+	if wait, err := accountLimiter.Blocked(accountKey(user.ID)); err != nil || wait > 0 {
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to check login attempts", err)
+			return
+		}
+		recordLoginAttempt(c, models.LoginPassword, req.UsernameOrEmail, &user, nil, models.LoginAccountLocked)
+		lockedOut(c, "Account locked after too many failed logins, try again later", wait)
+		return
+	}
+
 	// Check password
 	if !user.CheckPassword(req.Password) {
+		loginFailed(ipKey(ip), accountKey(user.ID))
+		recordLoginAttempt(c, models.LoginPassword, req.UsernameOrEmail, &user, nil, models.LoginInvalid)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"message": "Invalid credentials",
@@ -62,15 +126,23 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"role":     user.Role,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(), // 24 hours
-	})
+	// Accounts with two-factor sign-in only get their tokens once a code
+	// has been entered as well, and stay counted towards the lockout until
+	// then
+	if pending, err := startTwoFactor(c, db, &user, req.UsernameOrEmail); err != nil || pending {
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to start two-factor sign-in", err)
+		}
+		return
+	}
+
+	if err := accountLimiter.Reset(accountKey(user.ID)); err != nil {
+		log.Printf("login limiter: %v", err)
+	}
+	recordLoginAttempt(c, models.LoginPassword, req.UsernameOrEmail, &user, nil, "")
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	// Start a session with a short-lived access token and a refresh token
+	tokens, err := auth.Login(db, &user, c.Request.UserAgent(), c.ClientIP(), nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -79,24 +151,122 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// The client uses the permissions to decide what to show
+	permissions, err := auth.RolePermissions(db, user.Role)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to load permissions", err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Login successful",
-		"data": gin.H{
-			"token": tokenString,
-			"user": gin.H{
-				"id":       user.ID,
-				"username": user.Username,
-				"email":    user.Email,
-				"role":     user.Role,
-			},
+		"data":    loginData(&user, tokens, permissions),
+	})
+}
+
+// loginData is what a successful login returns
+func loginData(user *models.User, tokens *auth.Tokens, permissions []string) gin.H {
+	return gin.H{
+		"token":              tokens.AccessToken,
+		"token_type":         tokens.TokenType,
+		"expires_at":         tokens.ExpiresAt,
+		"refresh_token":      tokens.RefreshToken,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+		"user": gin.H{
+			"id":                   user.ID,
+			"username":             user.Username,
+			"email":                user.Email,
+			"role":                 user.Role,
+			"permissions":          permissions,
+			"location_id":          user.LocationID,
+			"must_change_password": user.MustChangePassword,
+		},
+	}
+}
+
+// Trade a refresh token for a new access token and refresh token. Each
+// refresh token works once; using one again ends its session.
+func RefreshToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Invalid request", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation failed", map[string]string{"error": err.Error()})
+		return
+	}
+
+	tokens, user, err := auth.Refresh(database.GetDB(), req.RefreshToken, c.ClientIP())
+	if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenReused) || errors.Is(err, auth.ErrLocked) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to refresh token", err)
+		return
+	}
+
+	permissions, err := auth.RolePermissions(database.GetDB(), user.Role)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to load permissions", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Token refreshed successfully", gin.H{
+		"token":              tokens.AccessToken,
+		"token_type":         tokens.TokenType,
+		"expires_at":         tokens.ExpiresAt,
+		"refresh_token":      tokens.RefreshToken,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+		"user": gin.H{
+			"id":                   user.ID,
+			"username":             user.Username,
+			"email":                user.Email,
+			"role":                 user.Role,
+			"permissions":          permissions,
+			"location_id":          user.LocationID,
+			"must_change_password": user.MustChangePassword,
 		},
 	})
 }
 
-// Register handler
+// Logout ends the current session, or every session of the user, so their
+// access and refresh tokens stop working at once
+func Logout(c *gin.Context) {
+	var req LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ValidationErrorResponse(c, "Invalid request", map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	db := database.GetDB()
+	var err error
+	if req.AllDevices {
+		userID, _ := currentUserID(c)
+		err = auth.RevokeUser(db, userID, models.RevokeLogout)
+	} else {
+		err = auth.Revoke(db, c.GetUint("session_id"), models.RevokeLogout)
+	}
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to log out", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Logged out successfully", nil)
+}
+
+// Register lets anyone sign up, always as a cashier. It is only routed when
+// ALLOW_REGISTRATION is on; otherwise users join through invites.
 func Register(c *gin.Context) {
-	var req RegisterRequest
+	var req SignUpRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -132,7 +302,16 @@ func Register(c *gin.Context) {
 		Username: req.Username,
 		Email:    req.Email,
 		Password: req.Password,
-		Role:     req.Role,
+		Role:     models.RoleCashier,
+	}
+
+	if err := auth.CheckPassword(req.Password, &user); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"success": false,
+			"message": "Password does not meet the password policy",
+			"error":   err.Error(),
+		})
+		return
 	}
 
 	// Hash password
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"POS-Golang/internal/barcode"
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Scan match kinds, besides the variant and unit barcode kinds
+const (
+	scanMatchProduct = "product"
+	scanMatchWeight  = "weight"
+	scanMatchPrice   = "price"
+)
+
+type ProductBarcodeRequest struct {
+	Barcode  string   `json:"barcode" validate:"required,max=64"`
+	Kind     string   `json:"kind" validate:"required,oneof=variant unit"`
+	Name     string   `json:"name"`
+	Quantity int      `json:"quantity" validate:"omitempty,gte=1"`
+	Price    *float64 `json:"price" validate:"omitempty,gt=0"`
+}
+
+type BarcodeLookup struct {
+	Code           string                 `json:"code"`
+	Match          string                 `json:"match"` // product, variant, unit, weight or price
+	Product        models.Product         `json:"product"`
+	ProductBarcode *models.ProductBarcode `json:"product_barcode,omitempty"`
+	Quantity       int                    `json:"quantity"`         // units; a scale barcode is one labelled pack
+	Weight         float64                `json:"weight,omitempty"` // kilograms in a scale barcode's pack
+	UnitPrice      float64                `json:"unit_price"`       // per unit, or per kilogram for scale barcodes
+	Price          float64                `json:"price"`            // for the quantity scanned
+}
+
+// barcodeMatch is one row of the barcode lookup query
+type barcodeMatch struct {
+	models.Product `gorm:"embedded"`
+	CategoryName   string
+	MatchKind      string
+	EntryID        *uint
+	EntryBarcode   *string
+	EntryKind      *string
+	EntryName      *string
+	EntryQuantity  *int
+	EntryPrice     *float64
+}
+
+// Every branch of the lookup selects the same columns: the product, its
+// category name, and the product barcode that matched, if any
+const barcodeLookupColumns = "products.*, categories.name AS category_name, ? AS match_kind"
+
+const barcodeLookupEntryColumns = ", product_barcodes.id AS entry_id, product_barcodes.barcode AS entry_barcode, " +
+	"product_barcodes.kind AS entry_kind, product_barcodes.name AS entry_name, " +
+	"product_barcodes.quantity AS entry_quantity, product_barcodes.price AS entry_price"
+
+const barcodeLookupNoEntry = ", NULL AS entry_id, NULL AS entry_barcode, NULL AS entry_kind, " +
+	"NULL AS entry_name, NULL AS entry_quantity, NULL AS entry_price"
+
+const barcodeLookupActive = "products.is_active = true AND products.deleted_at IS NULL"
+
+// Look up the one active product a scanned barcode stands for
+func GetProductByBarcode(c *gin.Context) {
+	code := strings.TrimSpace(c.Param("code"))
+	if code == "" {
+		utils.ErrorResponse(c, "Barcode is required", nil)
+		return
+	}
+
+	// An exact product or product barcode match comes first; a scale barcode
+	// is matched on the item code of the product it was printed for. All
+	// branches use unique indexes, so this is a single indexed query.
+	sql := "(SELECT " + barcodeLookupColumns + barcodeLookupNoEntry + ", 1 AS priority FROM products " +
+		"LEFT JOIN categories ON categories.id = products.category_id " +
+		"WHERE products.barcode = ? AND " + barcodeLookupActive + ") " +
+		"UNION ALL (SELECT " + barcodeLookupColumns + barcodeLookupEntryColumns + ", 2 AS priority FROM product_barcodes " +
+		"JOIN products ON products.id = product_barcodes.product_id " +
+		"LEFT JOIN categories ON categories.id = products.category_id " +
+		"WHERE product_barcodes.barcode = ? AND " + barcodeLookupActive + ")"
+	args := []interface{}{scanMatchProduct, code, "", code}
+
+	embedded, isEmbedded := barcode.DecodeEmbedded(code)
+	if isEmbedded {
+		sql += " UNION ALL (SELECT " + barcodeLookupColumns + barcodeLookupNoEntry + ", 3 AS priority FROM products " +
+			"LEFT JOIN categories ON categories.id = products.category_id " +
+			"WHERE products.plu = ? AND " + barcodeLookupActive + ")"
+		args = append(args, embedded.Kind, embedded.PLU)
+	}
+	sql += " ORDER BY priority LIMIT 1"
+
+	var matches []barcodeMatch
+	if err := database.GetDB().Raw(sql, args...).Scan(&matches).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to look up barcode", err)
+		return
+	}
+	if len(matches) == 0 {
+		utils.NotFoundResponse(c, "No active product has this barcode")
+		return
+	}
+
+	match := matches[0]
+	product := match.Product
+	if product.CategoryID != 0 {
+		product.Category = models.Category{ID: product.CategoryID, Name: match.CategoryName}
+	}
+
+	lookup := BarcodeLookup{
+		Code:      code,
+		Match:     match.MatchKind,
+		Product:   product,
+		Quantity:  1,
+		UnitPrice: product.Price,
+		Price:     product.Price,
+	}
+
+	switch match.MatchKind {
+	case scanMatchWeight:
+		lookup.Weight = embedded.Kilograms()
+		lookup.Price = roundPrice(lookup.Weight * product.Price)
+	case scanMatchPrice:
+		lookup.Price = embedded.Amount()
+		lookup.Weight = math.Round(lookup.Price/product.Price*1000) / 1000
+	case scanMatchProduct:
+	default:
+		entry := &models.ProductBarcode{
+			ID:        *match.EntryID,
+			ProductID: product.ID,
+			Barcode:   *match.EntryBarcode,
+			Kind:      *match.EntryKind,
+			Quantity:  *match.EntryQuantity,
+			Price:     match.EntryPrice,
+		}
+		if match.EntryName != nil {
+			entry.Name = *match.EntryName
+		}
+		lookup.Match = entry.Kind
+		lookup.ProductBarcode = entry
+		lookup.Quantity = entry.Quantity
+		lookup.Price = roundPrice(product.Price * float64(entry.Quantity))
+		if entry.Price != nil {
+			lookup.Price = *entry.Price
+		}
+	}
+
+	utils.SuccessResponse(c, "Product found", lookup)
+}
+
+// Get the extra barcodes of a product
+func GetProductBarcodes(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var barcodes []models.ProductBarcode
+	if err := database.GetDB().Where("product_id = ?", id).Order("id").Find(&barcodes).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch product barcodes", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Product barcodes fetched successfully", barcodes)
+}
+
+// Add a variant or unit barcode to a product
+func CreateProductBarcode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req ProductBarcodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	var product models.Product
+	if err := db.First(&product, id).Error; err != nil {
+		utils.ErrorResponse(c, "Product not found", err)
+		return
+	}
+
+	if err := barcode.Validate(req.Barcode); err != nil {
+		utils.ErrorResponse(c, "Invalid barcode", err)
+		return
+	}
+
+	if barcodeInUse(db, req.Barcode, 0) {
+		utils.ErrorResponse(c, "Barcode already exists", nil)
+		return
+	}
+
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	entry := models.ProductBarcode{
+		ProductID: product.ID,
+		Barcode:   req.Barcode,
+		Kind:      req.Kind,
+		Name:      req.Name,
+		Quantity:  req.Quantity,
+		Price:     req.Price,
+	}
+
+	if err := db.Create(&entry).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to create product barcode", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Product barcode created successfully", entry)
+}
+
+// Remove a variant or unit barcode from a product
+func DeleteProductBarcode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	db := database.GetDB()
+	var entry models.ProductBarcode
+	if err := db.Where("id = ? AND product_id = ?", c.Param("barcodeId"), id).First(&entry).Error; err != nil {
+		utils.ErrorResponse(c, "Product barcode not found", err)
+		return
+	}
+
+	if err := db.Delete(&entry).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to delete product barcode", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Product barcode deleted successfully", nil)
+}
+
+// barcodeInUse reports whether code is already the barcode of a product
+// other than excludeProductID, or one of any product's extra barcodes.
+// Barcodes are unique across both tables so a scan finds one product.
+func barcodeInUse(db *gorm.DB, code string, excludeProductID uint) bool {
+	var count int64
+	db.Model(&models.Product{}).Where("barcode = ? AND id != ?", code, excludeProductID).Count(&count)
+	if count > 0 {
+		return true
+	}
+	db.Model(&models.ProductBarcode{}).Where("barcode = ?", code).Count(&count)
+	return count > 0
+}
+
+// checkPLU checks that a scale item code is five digits and not used by
+// another product
+func checkPLU(db *gorm.DB, plu string, excludeProductID uint) error {
+	if len(plu) != 5 || strings.Trim(plu, "0123456789") != "" {
+		return fmt.Errorf("PLU must be 5 digits")
+	}
+	var count int64
+	db.Model(&models.Product{}).Where("plu = ? AND id != ?", plu, excludeProductID).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("PLU %s is already used by another product", plu)
+	}
+	return nil
+}
+
+func roundPrice(price float64) float64 {
+	return math.Round(price*100) / 100
+}
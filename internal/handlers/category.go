@@ -3,56 +3,455 @@ package handlers
 import (
 	"POS-Golang/internal/database"
 	"POS-Golang/internal/models"
+	"POS-Golang/internal/trash"
+	"POS-Golang/internal/utils"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// Get all categories
+type CategoryRequest struct {
+	Name     string `json:"name" validate:"required"`
+	ParentID *uint  `json:"parent_id"` // top level when empty
+}
+
+type UpdateCategoryRequest struct {
+	Name     string `json:"name" validate:"required"`
+	ParentID *uint  `json:"parent_id"` // left where it is when empty
+	// MoveToTop makes the category a top-level one
+	MoveToTop bool `json:"move_to_top"`
+}
+
+// Get all categories, as a flat list or as a tree with ?tree=true
 func GetCategories(c *gin.Context) {
 	db := database.GetDB()
 	var categories []models.Category
 
-	if err := db.Find(&categories).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+	if err := db.Order("path").Find(&categories).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch categories", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":    "Categories fetched successfully",
-		"categories": categories,
-	})
+	if c.Query("tree") == "true" {
+		categories = buildCategoryTree(categories)
+	}
+
+	utils.SuccessResponse(c, "Categories fetched successfully", categories)
 }
 
-// Create category
-type CategoryRequest struct {
-	Name string `json:"name" validate:"required"`
+// Get single category with its ancestors, children and product counts
+func GetCategory(c *gin.Context) {
+	db := database.GetDB()
+	category, err := findCategory(db, c.Param("id"))
+	if err != nil {
+		utils.NotFoundResponse(c, "Category not found")
+		return
+	}
+
+	var ancestors []models.Category
+	if ids := categoryAncestorIDs(category); len(ids) > 0 {
+		db.Where("id IN ?", ids).Order("depth").Find(&ancestors)
+	}
+
+	db.Where("parent_id = ?", category.ID).Order("name").Find(&category.Children)
+
+	var productCount, subtreeProductCount int64
+	db.Model(&models.Product{}).Where("category_id = ?", category.ID).Count(&productCount)
+	db.Model(&models.Product{}).Where("category_id IN (?)", categorySubtree(db, category)).Count(&subtreeProductCount)
+
+	utils.SuccessResponse(c, "Category fetched successfully", gin.H{
+		"category":              category,
+		"ancestors":             ancestors,
+		"product_count":         productCount,
+		"subtree_product_count": subtreeProductCount,
+	})
 }
 
+// Create category
 func CreateCategory(c *gin.Context) {
 	var req CategoryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	var category models.Category
+	err := db.Transaction(func(tx *gorm.DB) error {
+		created, err := createCategory(tx, req.Name, req.ParentID)
+		category = created
+		return err
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to create category", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Category created successfully", category)
+}
+
+// Update category: rename it, or move it and its subtree under another
+// parent
+func UpdateCategory(c *gin.Context) {
+	var req UpdateCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
 		return
 	}
 
-	if req.Name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if req.MoveToTop && req.ParentID != nil {
+		utils.ErrorResponse(c, "Give either a parent or move to top, not both", nil)
+		return
+	}
+
+	db := database.GetDB()
+	category, err := findCategory(db, c.Param("id"))
+	if err != nil {
+		utils.NotFoundResponse(c, "Category not found")
+		return
+	}
+
+	parentID := category.ParentID
+	if req.ParentID != nil {
+		parentID = req.ParentID
+	} else if req.MoveToTop {
+		parentID = nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		parent, err := categoryParent(tx, parentID)
+		if err != nil {
+			return err
+		}
+		if parent != nil && strings.HasPrefix(parent.Path, category.Path) {
+			return fmt.Errorf("a category cannot be moved under itself or one of its subcategories")
+		}
+		if err := checkCategoryName(tx, req.Name, parentID, category.ID); err != nil {
+			return err
+		}
+
+		category.Name = req.Name
+		if err := tx.Model(&category).Update("name", category.Name).Error; err != nil {
+			return err
+		}
+
+		if !sameID(category.ParentID, parentID) {
+			return moveCategory(tx, &category, parent)
+		}
+		return nil
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to update category", err)
 		return
 	}
 
+	utils.SuccessResponse(c, "Category updated successfully", category)
+}
+
+// Delete category. A category that still has products or subcategories is
+// only deleted when ?reassign_to names a category to move them to.
+func DeleteCategory(c *gin.Context) {
 	db := database.GetDB()
-	category := models.Category{
-		Name: req.Name,
+	category, err := findCategory(db, c.Param("id"))
+	if err != nil {
+		utils.NotFoundResponse(c, "Category not found")
+		return
 	}
 
-	if err := db.Create(&category).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+	var productCount, childCount int64
+	db.Model(&models.Product{}).Where("category_id = ?", category.ID).Count(&productCount)
+	db.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&childCount)
+
+	reassignTo := c.Query("reassign_to")
+	if reassignTo == "" && (productCount > 0 || childCount > 0) {
+		c.JSON(http.StatusBadRequest, utils.Response{
+			Success: false,
+			Message: "Category still has products or subcategories; pass reassign_to to move them to another category",
+			Data: gin.H{
+				"product_count":     productCount,
+				"subcategory_count": childCount,
+			},
+		})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if reassignTo != "" {
+			target, err := findCategory(tx, reassignTo)
+			if err != nil {
+				return fmt.Errorf("category to reassign to not found")
+			}
+			if strings.HasPrefix(target.Path, category.Path) {
+				return fmt.Errorf("cannot reassign to the category being deleted or one of its subcategories")
+			}
+
+			if err := tx.Model(&models.Product{}).Where("category_id = ?", category.ID).
+				Update("category_id", target.ID).Error; err != nil {
+				return err
+			}
+
+			var children []models.Category
+			if err := tx.Where("parent_id = ?", category.ID).Find(&children).Error; err != nil {
+				return err
+			}
+			for i := range children {
+				if err := checkCategoryName(tx, children[i].Name, &target.ID, children[i].ID); err != nil {
+					return err
+				}
+				if err := moveCategory(tx, &children[i], &target); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := tx.Delete(&category).Error; err != nil {
+			return err
+		}
+		return trash.Record(tx, models.TrashDeleted, trash.Categories, category.ID, category.Name, trashUserID(c))
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to delete category", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "Category created successfully",
-		"category": category,
+	utils.SuccessResponse(c, "Category deleted successfully", gin.H{
+		"products_moved":      productCount,
+		"subcategories_moved": childCount,
 	})
 }
+
+func findCategory(db *gorm.DB, id string) (models.Category, error) {
+	var category models.Category
+	categoryID, err := strconv.Atoi(id)
+	if err != nil {
+		return category, err
+	}
+	err = db.First(&category, categoryID).Error
+	return category, err
+}
+
+// createCategory creates a category under the parent, or at the top level
+// when parentID is nil
+func createCategory(tx *gorm.DB, name string, parentID *uint) (models.Category, error) {
+	parent, err := categoryParent(tx, parentID)
+	if err != nil {
+		return models.Category{}, err
+	}
+	if err := checkCategoryName(tx, name, parentID, 0); err != nil {
+		return models.Category{}, err
+	}
+
+	category := models.Category{Name: name}
+	if parent != nil {
+		category.ParentID = &parent.ID
+		category.Depth = parent.Depth + 1
+	}
+	if err := tx.Create(&category).Error; err != nil {
+		return category, err
+	}
+
+	// The path includes the category's own ID, known only once created
+	parentPath := ""
+	if parent != nil {
+		parentPath = parent.Path
+	}
+	category.Path = models.CategoryPath(parentPath, category.ID)
+	return category, tx.Model(&category).Update("path", category.Path).Error
+}
+
+// categoryParent loads the parent category, or returns nil for top level
+func categoryParent(tx *gorm.DB, parentID *uint) (*models.Category, error) {
+	if parentID == nil || *parentID == 0 {
+		return nil, nil
+	}
+	var parent models.Category
+	if err := tx.First(&parent, *parentID).Error; err != nil {
+		return nil, fmt.Errorf("parent category not found")
+	}
+	return &parent, nil
+}
+
+// checkCategoryName refuses a name already used by a sibling category
+func checkCategoryName(tx *gorm.DB, name string, parentID *uint, excludeID uint) error {
+	query := tx.Model(&models.Category{}).Where("LOWER(name) = ? AND id != ?", strings.ToLower(name), excludeID)
+	if parentID == nil || *parentID == 0 {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+
+	var count int64
+	query.Count(&count)
+	if count > 0 {
+		return fmt.Errorf("a category named %q already exists here", name)
+	}
+	return nil
+}
+
+// moveCategory puts the category under a new parent (nil for the top level)
+// and rewrites the paths and depths of its whole subtree
+func moveCategory(tx *gorm.DB, category *models.Category, parent *models.Category) error {
+	oldPath := category.Path
+	parentPath, depth := "", 0
+	if parent != nil {
+		parentPath, depth = parent.Path, parent.Depth+1
+		category.ParentID = &parent.ID
+	} else {
+		category.ParentID = nil
+	}
+	newPath := models.CategoryPath(parentPath, category.ID)
+	depthChange := depth - category.Depth
+
+	if err := tx.Model(category).Update("parent_id", category.ParentID).Error; err != nil {
+		return err
+	}
+
+	// Soft-deleted descendants are moved too, so a restore lands them in
+	// the right place
+	if err := tx.Exec("UPDATE categories SET path = CONCAT(?, SUBSTRING(path, ?)), depth = depth + ? WHERE path LIKE ?",
+		newPath, len(oldPath)+1, depthChange, oldPath+"%").Error; err != nil {
+		return err
+	}
+
+	category.Path = newPath
+	category.Depth = depth
+	return nil
+}
+
+// categorySubtree returns a subquery selecting the IDs of the category and
+// all categories below it
+func categorySubtree(db *gorm.DB, category models.Category) *gorm.DB {
+	return db.Model(&models.Category{}).Select("id").Where("path LIKE ?", category.Path+"%")
+}
+
+// categoryAncestorIDs returns the IDs above the category, from the root down
+func categoryAncestorIDs(category models.Category) []uint {
+	var ids []uint
+	for _, part := range strings.Split(strings.Trim(category.Path, "/"), "/") {
+		id, err := strconv.Atoi(part)
+		if err == nil && uint(id) != category.ID {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// buildCategoryTree nests the categories under their parents. Categories
+// whose parent is not in the list are returned at the top.
+func buildCategoryTree(categories []models.Category) []models.Category {
+	present := make(map[uint]bool, len(categories))
+	children := make(map[uint][]models.Category)
+	for _, category := range categories {
+		present[category.ID] = true
+	}
+
+	var roots []models.Category
+	for _, category := range categories {
+		if category.ParentID != nil && present[*category.ParentID] {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		} else {
+			roots = append(roots, category)
+		}
+	}
+
+	var attach func(list []models.Category) []models.Category
+	attach = func(list []models.Category) []models.Category {
+		for i := range list {
+			list[i].Children = attach(children[list[i].ID])
+		}
+		return list
+	}
+	return attach(roots)
+}
+
+// categoryPathSeparator separates the levels of a category named by its
+// path, as in product import files: "Drinks > Soft drinks"
+const categoryPathSeparator = " > "
+
+// splitCategoryPath splits a category path into the names of its levels
+func splitCategoryPath(path string) []string {
+	var names []string
+	for _, name := range strings.Split(path, ">") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// categoryNamePaths returns the ID of every category by its lower-cased
+// name path, and the display name path of every category by ID
+func categoryNamePaths(db *gorm.DB) (map[string]uint, map[uint]string, error) {
+	var categories []models.Category
+	if err := db.Order("depth").Find(&categories).Error; err != nil {
+		return nil, nil, err
+	}
+
+	names := make(map[uint]string, len(categories))
+	ids := make(map[string]uint, len(categories))
+	for _, category := range categories {
+		name := category.Name
+		if category.ParentID != nil {
+			if parent, ok := names[*category.ParentID]; ok {
+				name = parent + categoryPathSeparator + name
+			}
+		}
+		names[category.ID] = name
+		ids[strings.ToLower(name)] = category.ID
+	}
+	return ids, names, nil
+}
+
+// ensureCategoryPath returns the category at the name path, creating any
+// missing levels. known maps lower-cased name paths to IDs and is updated
+// with the categories created.
+func ensureCategoryPath(tx *gorm.DB, names []string, known map[string]uint) (uint, error) {
+	var parentID *uint
+	key := ""
+	for _, name := range names {
+		if key != "" {
+			key += categoryPathSeparator
+		}
+		key += strings.ToLower(name)
+
+		id, ok := known[key]
+		if !ok {
+			category, err := createCategory(tx, name, parentID)
+			if err != nil {
+				return 0, err
+			}
+			id = category.ID
+			known[key] = id
+		}
+		parentID = &id
+	}
+	if parentID == nil {
+		return 0, fmt.Errorf("category name is empty")
+	}
+	return *parentID, nil
+}
+
+// sameID reports whether two optional IDs are the same, taking nil and zero
+// as none
+func sameID(a, b *uint) bool {
+	if a == nil || *a == 0 {
+		return b == nil || *b == 0
+	}
+	return b != nil && *a == *b
+}
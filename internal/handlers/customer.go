@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CustomerRequest struct {
+	Code        string `json:"code" validate:"max=30"`
+	Name        string `json:"name" validate:"required"`
+	Phone       string `json:"phone"`
+	Email       string `json:"email" validate:"omitempty,email"`
+	Address     string `json:"address"`
+	PriceListID *uint  `json:"price_list_id"`
+	IsActive    *bool  `json:"is_active"`
+}
+
+// Get all customers
+func GetCustomers(c *gin.Context) {
+	db := database.GetDB()
+	var customers []models.Customer
+
+	query := db.Preload("PriceList").Order("name")
+	if search := c.Query("search"); search != "" {
+		query = query.Where("name LIKE ? OR code LIKE ? OR phone LIKE ?", "%"+search+"%", "%"+search+"%", "%"+search+"%")
+	}
+	if priceListID := c.Query("price_list_id"); priceListID != "" {
+		query = query.Where("price_list_id = ?", priceListID)
+	}
+
+	if err := query.Find(&customers).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch customers", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Customers fetched successfully", customers)
+}
+
+// Get single customer
+func GetCustomer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid customer ID", err)
+		return
+	}
+
+	var customer models.Customer
+	if err := database.GetDB().Preload("PriceList").First(&customer, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Customer not found")
+		return
+	}
+
+	utils.SuccessResponse(c, "Customer fetched successfully", customer)
+}
+
+// Create customer
+func CreateCustomer(c *gin.Context) {
+	var req CustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	customer := models.Customer{IsActive: true}
+	if !applyCustomerRequest(c, &customer, req) {
+		return
+	}
+
+	db := database.GetDB()
+	if err := db.Create(&customer).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to create customer", err)
+		return
+	}
+
+	db.Preload("PriceList").First(&customer, customer.ID)
+
+	utils.SuccessResponse(c, "Customer created successfully", customer)
+}
+
+// Update customer
+func UpdateCustomer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid customer ID", err)
+		return
+	}
+
+	var req CustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	var customer models.Customer
+	if err := db.First(&customer, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Customer not found")
+		return
+	}
+
+	if !applyCustomerRequest(c, &customer, req) {
+		return
+	}
+
+	if err := db.Omit("PriceList").Save(&customer).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to update customer", err)
+		return
+	}
+
+	db.Preload("PriceList").First(&customer, customer.ID)
+
+	utils.SuccessResponse(c, "Customer updated successfully", customer)
+}
+
+// Delete customer
+func DeleteCustomer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid customer ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var customer models.Customer
+	if err := db.First(&customer, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Customer not found")
+		return
+	}
+
+	if err := db.Delete(&customer).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to delete customer", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Customer deleted successfully", nil)
+}
+
+// applyCustomerRequest copies the request onto the customer, checking the
+// code and price list. It writes the error response and returns false when
+// they are not valid.
+func applyCustomerRequest(c *gin.Context, customer *models.Customer, req CustomerRequest) bool {
+	db := database.GetDB()
+
+	if req.Code != "" {
+		var count int64
+		db.Model(&models.Customer{}).Where("code = ? AND id != ?", req.Code, customer.ID).Count(&count)
+		if count > 0 {
+			utils.ErrorResponse(c, "Customer code already exists", nil)
+			return false
+		}
+	}
+
+	var priceListID *uint
+	if req.PriceListID != nil && *req.PriceListID != 0 {
+		var list models.PriceList
+		if err := db.First(&list, *req.PriceListID).Error; err != nil {
+			utils.ErrorResponse(c, "Price list not found", err)
+			return false
+		}
+		priceListID = req.PriceListID
+	}
+
+	// A customer's price list decides what they pay, so only those who
+	// manage pricing may give or change it
+	if !sameID(customer.PriceListID, priceListID) && !can(c, models.PermPricingManage) {
+		utils.ForbiddenResponse(c, "Setting a customer's price list needs the "+models.PermPricingManage+" permission")
+		return false
+	}
+	customer.PriceListID = priceListID
+
+	customer.Code = optionalString(req.Code)
+	customer.Name = req.Name
+	customer.Phone = req.Phone
+	customer.Email = req.Email
+	customer.Address = req.Address
+	if req.IsActive != nil {
+		customer.IsActive = *req.IsActive
+	}
+	return true
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type DashboardStats struct {
@@ -15,6 +16,9 @@ type DashboardStats struct {
 	TodayTransactions int64   `json:"today_transactions"`
 	TodayRevenue      float64 `json:"today_revenue"`
 	MonthlyRevenue    float64 `json:"monthly_revenue"`
+	TodayProfit       float64 `json:"today_profit"`
+	MonthlyProfit     float64 `json:"monthly_profit"`
+	MonthlyMargin     float64 `json:"monthly_margin"`
 	LowStockProducts  int64   `json:"low_stock_products"`
 }
 
@@ -22,6 +26,7 @@ type TopProduct struct {
 	ProductName string  `json:"product_name"`
 	TotalSold   int     `json:"total_sold"`
 	Revenue     float64 `json:"revenue"`
+	Profit      float64 `json:"profit"`
 }
 
 type RevenueData struct {
@@ -36,33 +41,66 @@ func GetDashboard(c *gin.Context) {
 	today := now.Format("2006-01-02")
 	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).Format("2006-01-02")
 
+	// Figures are for the user's store, or every store for head office
+	locationID, err := scopedLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	transactions := func() *gorm.DB {
+		query := db.Model(&models.Transaction{})
+		if locationID != 0 {
+			query = query.Where("location_id = ?", locationID)
+		}
+		return query
+	}
+
 	var stats DashboardStats
 
 	// Total products
 	db.Model(&models.Product{}).Count(&stats.TotalProducts)
 
 	// Total transactions
-	db.Model(&models.Transaction{}).Where("status = ?", "completed").Count(&stats.TotalTransactions)
+	transactions().Where("status = ?", "completed").Count(&stats.TotalTransactions)
 
 	// Today's transactions
-	db.Model(&models.Transaction{}).Where("DATE(created_at) = ? AND status = ?", today, "completed").Count(&stats.TodayTransactions)
+	transactions().Where("DATE(created_at) = ? AND status = ?", today, "completed").Count(&stats.TodayTransactions)
 
 	// Today's revenue
-	db.Model(&models.Transaction{}).Where("DATE(created_at) = ? AND status = ?", today, "completed").Select("COALESCE(SUM(total_amount), 0)").Scan(&stats.TodayRevenue)
+	transactions().Where("DATE(created_at) = ? AND status = ?", today, "completed").Select("COALESCE(SUM(total_amount), 0)").Scan(&stats.TodayRevenue)
 
 	// Monthly revenue
-	db.Model(&models.Transaction{}).Where("DATE(created_at) >= ? AND status = ?", monthStart, "completed").Select("COALESCE(SUM(total_amount), 0)").Scan(&stats.MonthlyRevenue)
-
-	// Low stock products (stock <= 10)
-	db.Model(&models.Product{}).Where("stock <= ? AND is_active = ?", 10, true).Count(&stats.LowStockProducts)
+	transactions().Where("DATE(created_at) >= ? AND status = ?", monthStart, "completed").Select("COALESCE(SUM(total_amount), 0)").Scan(&stats.MonthlyRevenue)
+
+	// Today's and monthly gross profit
+	completedSalesLines(db, locationID, today, today).Select("COALESCE(SUM(" + lineProfitSQL + "), 0)").Scan(&stats.TodayProfit)
+	// The margin takes revenue from the same sale lines as the profit, so
+	// both are net of the same discounts
+	var monthly struct {
+		Revenue float64
+		Profit  float64
+	}
+	completedSalesLines(db, locationID, monthStart, "").
+		Select("COALESCE(SUM(transaction_items.subtotal), 0) AS revenue, COALESCE(SUM(" + lineProfitSQL + "), 0) AS profit").
+		Scan(&monthly)
+	stats.MonthlyProfit = monthly.Profit
+	stats.MonthlyMargin = calculateMargin(monthly.Revenue, monthly.Profit)
+
+	// Low stock products (at or below their reorder point)
+	if locationID != 0 {
+		db.Model(&models.Product{}).
+			Joins("LEFT JOIN stock_levels ON stock_levels.product_id = products.id AND stock_levels.location_id = ?", locationID).
+			Where("COALESCE(stock_levels.quantity, 0) <= products.reorder_point AND products.is_active = ?", true).
+			Count(&stats.LowStockProducts)
+	} else {
+		db.Model(&models.Product{}).Where("stock <= reorder_point AND is_active = ?", true).Count(&stats.LowStockProducts)
+	}
 
 	// Top products this month
 	var topProducts []TopProduct
-	db.Table("transaction_items").
-		Select("products.name as product_name, SUM(transaction_items.quantity) as total_sold, SUM(transaction_items.subtotal) as revenue").
-		Joins("JOIN products ON transaction_items.product_id = products.id").
-		Joins("JOIN transactions ON transaction_items.transaction_id = transactions.id").
-		Where("DATE(transactions.created_at) >= ? AND transactions.status = ?", monthStart, "completed").
+	completedSalesLines(db, locationID, monthStart, "").
+		Select("products.name as product_name, SUM(transaction_items.quantity) as total_sold, SUM(transaction_items.subtotal) as revenue, SUM(" + lineProfitSQL + ") as profit").
 		Group("products.id, products.name").
 		Order("total_sold DESC").
 		Limit(5).
@@ -73,7 +111,7 @@ func GetDashboard(c *gin.Context) {
 	for i := 6; i >= 0; i-- {
 		date := now.AddDate(0, 0, -i).Format("2006-01-02")
 		var revenue float64
-		db.Model(&models.Transaction{}).
+		transactions().
 			Where("DATE(created_at) = ? AND status = ?", date, "completed").
 			Select("COALESCE(SUM(total_amount), 0)").
 			Scan(&revenue)
@@ -86,13 +124,14 @@ func GetDashboard(c *gin.Context) {
 
 	// Recent transactions
 	var recentTransactions []models.Transaction
-	db.Preload("User").Preload("Items.Product").
-		Where("status = ?", "completed").
-		Order("created_at DESC").
-		Limit(5).
-		Find(&recentTransactions)
+	recent := db.Preload("User").Preload("Items.Product").Where("status = ?", "completed")
+	if locationID != 0 {
+		recent = recent.Where("location_id = ?", locationID)
+	}
+	recent.Order("created_at DESC").Limit(5).Find(&recentTransactions)
 
 	utils.SuccessResponse(c, "Dashboard data fetched successfully", gin.H{
+		"location_id":         locationID,
 		"stats":               stats,
 		"top_products":        topProducts,
 		"revenue_data":        revenueData,
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"POS-Golang/internal/auth"
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// How long an invite can be accepted for, set at startup
+var inviteTTL = 72 * time.Hour
+
+// SetInviteTTL sets how long invites stay valid
+func SetInviteTTL(ttl time.Duration) {
+	inviteTTL = ttl
+}
+
+type InviteRequest struct {
+	Email      string `json:"email" validate:"required,email"`
+	Role       string `json:"role" validate:"required,max=50"`
+	LocationID *uint  `json:"location_id"`
+}
+
+type AcceptInviteRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Username string `json:"username" validate:"required,min=3,max=20"`
+	Password string `json:"password" validate:"required"` // checked against the password policy
+}
+
+// Get invites, newest first
+func GetInvites(c *gin.Context) {
+	var invites []models.Invite
+	if err := database.GetDB().Preload("CreatedBy").Preload("Location").Order("id DESC").Find(&invites).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch invites", err)
+		return
+	}
+
+	now := time.Now()
+	status := c.Query("status")
+	filtered := make([]models.Invite, 0, len(invites))
+	for _, invite := range invites {
+		invite.Status = invite.CurrentStatus(now)
+		if status == "" || invite.Status == status {
+			filtered = append(filtered, invite)
+		}
+	}
+
+	utils.SuccessResponse(c, "Invites fetched successfully", filtered)
+}
+
+// Invite someone to create an account with a given role. The invite token
+// is only shown in this response, for passing on to the invitee.
+func CreateInvite(c *gin.Context) {
+	var req InviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	if !roleExists(db, req.Role) {
+		utils.ErrorResponse(c, "Role not found", nil)
+		return
+	}
+	allowed, err := canGrantRole(c, db, req.Role)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to check role", err)
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, utils.Response{
+			Success: false,
+			Message: "You cannot invite users to a role with permissions you do not have",
+		})
+		return
+	}
+	if !locationExists(req.LocationID) {
+		utils.ErrorResponse(c, "Location not found", nil)
+		return
+	}
+
+	var count int64
+	db.Model(&models.User{}).Where("email = ?", req.Email).Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, "A user with this email already exists", nil)
+		return
+	}
+
+	token, hash, err := auth.NewSecret("inv_")
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to create invite token", err)
+		return
+	}
+
+	userID, _ := currentUserID(c)
+	invite := models.Invite{
+		TokenHash:   hash,
+		Email:       req.Email,
+		Role:        req.Role,
+		LocationID:  req.LocationID,
+		CreatedByID: userID,
+		ExpiresAt:   time.Now().Add(inviteTTL),
+	}
+	if err := db.Create(&invite).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to create invite", err)
+		return
+	}
+	invite.Status = invite.CurrentStatus(time.Now())
+
+	utils.SuccessResponse(c, "Invite created successfully", gin.H{
+		"invite": invite,
+		"token":  token,
+	})
+}
+
+// Revoke an invite that has not been accepted yet
+func RevokeInvite(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid invite ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var invite models.Invite
+	if err := db.First(&invite, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Invite not found")
+		return
+	}
+
+	if invite.AcceptedAt != nil {
+		utils.ErrorResponse(c, "Invite was already accepted", nil)
+		return
+	}
+
+	if invite.RevokedAt == nil {
+		if err := db.Model(&invite).UpdateColumn("revoked_at", time.Now()).Error; err != nil {
+			utils.ErrorResponse(c, "Failed to revoke invite", err)
+			return
+		}
+	}
+
+	utils.SuccessResponse(c, "Invite revoked successfully", nil)
+}
+
+// Check an invite token before showing the sign-up form
+func GetInviteByToken(c *gin.Context) {
+	var invite models.Invite
+	err := database.GetDB().Where("token_hash = ?", auth.HashSecret(c.Param("token"))).First(&invite).Error
+	if err != nil || invite.CurrentStatus(time.Now()) != "pending" {
+		utils.NotFoundResponse(c, "Invite not found or no longer valid")
+		return
+	}
+
+	utils.SuccessResponse(c, "Invite is valid", gin.H{
+		"email":      invite.Email,
+		"role":       invite.Role,
+		"expires_at": invite.ExpiresAt,
+	})
+}
+
+var errInviteInvalid = errors.New("invite not found or no longer valid")
+
+// Accept an invite, creating the invitee's account with the invite's email,
+// role and store and the password they choose
+func AcceptInvite(c *gin.Context) {
+	var req AcceptInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Invalid request", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation failed", map[string]string{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	var policyErr error
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var invite models.Invite
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", auth.HashSecret(req.Token)).First(&invite).Error; err != nil {
+			return errInviteInvalid
+		}
+		if invite.CurrentStatus(time.Now()) != "pending" {
+			return errInviteInvalid
+		}
+
+		var count int64
+		tx.Model(&models.User{}).Where("username = ? OR email = ?", req.Username, invite.Email).Count(&count)
+		if count > 0 {
+			return errUserExists
+		}
+
+		user = models.User{
+			Username:   req.Username,
+			Email:      invite.Email,
+			Password:   req.Password,
+			Role:       invite.Role,
+			LocationID: invite.LocationID,
+		}
+		if policyErr = auth.CheckPassword(req.Password, &user); policyErr != nil {
+			return policyErr
+		}
+		if err := user.HashPassword(); err != nil {
+			return err
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&invite).UpdateColumns(map[string]interface{}{
+			"accepted_at":      time.Now(),
+			"accepted_user_id": user.ID,
+		}).Error
+	})
+	switch {
+	case errors.Is(err, errInviteInvalid):
+		utils.NotFoundResponse(c, err.Error())
+		return
+	case policyErr != nil:
+		utils.ValidationErrorResponse(c, "Password does not meet the password policy", map[string]string{"password": policyErr.Error()})
+		return
+	case errors.Is(err, errUserExists):
+		c.JSON(http.StatusConflict, utils.Response{
+			Success: false,
+			Message: "Username or email already taken",
+		})
+		return
+	case err != nil:
+		utils.InternalServerErrorResponse(c, "Failed to create user", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, utils.Response{
+		Success: true,
+		Message: "Account created successfully",
+		Data: gin.H{
+			"user": gin.H{
+				"id":          user.ID,
+				"username":    user.Username,
+				"email":       user.Email,
+				"role":        user.Role,
+				"location_id": user.LocationID,
+			},
+		},
+	})
+}
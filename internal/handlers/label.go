@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"POS-Golang/internal/barcode"
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/labels"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type LabelRequest struct {
+	ProductIDs []uint `json:"product_ids" validate:"required,min=1"`
+	Layout     string `json:"layout" validate:"required"`
+	Format     string `json:"format" validate:"omitempty,oneof=pdf svg"`
+	Copies     int    `json:"copies" validate:"omitempty,gte=1,lte=500"` // labels per product, default 1
+	Skip       int    `json:"skip" validate:"gte=0"`                     // positions already used on the first sheet
+}
+
+type GenerateBarcodesRequest struct {
+	// Products to give an internal barcode; every product without a barcode
+	// when empty
+	ProductIDs []uint `json:"product_ids"`
+}
+
+// Get the available label layouts
+func GetLabelLayouts(c *gin.Context) {
+	utils.SuccessResponse(c, "Label layouts fetched successfully", labels.Layouts())
+}
+
+// Render shelf or price labels for a list of products as a PDF or SVG sheet
+func PrintLabels(c *gin.Context) {
+	var req LabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if req.Format == "" {
+		req.Format = labels.FormatPDF
+	}
+	if req.Copies == 0 {
+		req.Copies = 1
+	}
+
+	layout, err := labels.FindLayout(req.Layout)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid label layout", err)
+		return
+	}
+
+	var products []models.Product
+	if err := database.GetDB().Where("id IN ?", req.ProductIDs).Find(&products).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch products", err)
+		return
+	}
+
+	byID := make(map[uint]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	// Labels come out in the order the products were asked for
+	var items []labels.Label
+	for _, id := range req.ProductIDs {
+		product, ok := byID[id]
+		if !ok {
+			utils.ErrorResponse(c, fmt.Sprintf("Product with ID %d not found", id), nil)
+			return
+		}
+
+		label := labels.Label{
+			Name:  product.Name,
+			Price: formatLabelPrice(product.Price),
+		}
+		if product.Barcode != nil {
+			label.Barcode = *product.Barcode
+		}
+		if product.SKU != nil {
+			label.SKU = *product.SKU
+		}
+		for i := 0; i < req.Copies; i++ {
+			items = append(items, label)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := labels.Render(&buf, req.Format, layout, items, req.Skip); err != nil {
+		utils.ErrorResponse(c, "Failed to render labels", err)
+		return
+	}
+
+	filename := fmt.Sprintf("labels-%s-%s.%s", layout.Name, time.Now().Format("20060102"), req.Format)
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	c.Data(http.StatusOK, labels.ContentType(req.Format), buf.Bytes())
+}
+
+// Give products without a barcode an internal EAN-13 barcode
+func GenerateBarcodes(c *gin.Context) {
+	var req GenerateBarcodesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	query := db.Where("barcode IS NULL")
+	if len(req.ProductIDs) > 0 {
+		query = query.Where("id IN ?", req.ProductIDs)
+	}
+
+	var products []models.Product
+	if err := query.Find(&products).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch products", err)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range products {
+			if err := assignInternalBarcode(tx, &products[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to generate barcodes", err)
+		return
+	}
+
+	generated := make([]gin.H, 0, len(products))
+	for _, product := range products {
+		generated = append(generated, gin.H{
+			"product_id": product.ID,
+			"name":       product.Name,
+			"barcode":    product.Barcode,
+		})
+	}
+
+	utils.SuccessResponse(c, fmt.Sprintf("Generated %d barcodes", len(generated)), generated)
+}
+
+// assignInternalBarcode gives the product the internal EAN-13 barcode made
+// from its ID
+func assignInternalBarcode(tx *gorm.DB, product *models.Product) error {
+	code, err := barcode.Internal(product.ID)
+	if err != nil {
+		return err
+	}
+
+	if barcodeInUse(tx, code, product.ID) {
+		return fmt.Errorf("barcode %s is already used by another product", code)
+	}
+
+	if err := tx.Model(product).Update("barcode", code).Error; err != nil {
+		return err
+	}
+	product.Barcode = &code
+	return nil
+}
+
+// formatLabelPrice formats a price with thousands separators, showing cents
+// only when there are any
+func formatLabelPrice(price float64) string {
+	formatted := strconv.FormatFloat(price, 'f', 2, 64)
+	whole, cents, _ := strings.Cut(formatted, ".")
+
+	var b strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	if cents != "00" {
+		b.WriteString("." + cents)
+	}
+	return b.String()
+}
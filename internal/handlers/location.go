@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/inventory"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LocationRequest struct {
+	Code     string `json:"code" validate:"required,max=20"`
+	Name     string `json:"name" validate:"required"`
+	Type     string `json:"type" validate:"required,oneof=store warehouse"`
+	Address  string `json:"address"`
+	IsActive *bool  `json:"is_active"`
+}
+
+// scopedLocationID returns the location a request is limited to. Store staff
+// are always limited to their assigned store. Users who can work at any
+// location default to their own store, if any, and may pick another with
+// ?location_id. Zero means every
+// location.
+func scopedLocationID(c *gin.Context) (uint, error) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return 0, fmt.Errorf("user not authenticated")
+	}
+
+	db := database.GetDB()
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return 0, fmt.Errorf("user not found")
+	}
+
+	if !can(c, models.PermLocationAll) && user.LocationID != nil {
+		return *user.LocationID, nil
+	}
+
+	if param := c.Query("location_id"); param != "" {
+		if !can(c, models.PermLocationAll) {
+			return 0, fmt.Errorf("choosing a location needs the %s permission", models.PermLocationAll)
+		}
+		id, err := strconv.Atoi(param)
+		if err != nil {
+			return 0, fmt.Errorf("invalid location ID")
+		}
+		if id == 0 {
+			return 0, nil
+		}
+
+		var location models.Location
+		if err := db.First(&location, id).Error; err != nil {
+			return 0, fmt.Errorf("location not found")
+		}
+		return location.ID, nil
+	}
+
+	if user.LocationID != nil {
+		return *user.LocationID, nil
+	}
+	return 0, nil
+}
+
+// operatingLocationID returns the location where stock moves for a request,
+// falling back to the default location for head office users.
+func operatingLocationID(c *gin.Context) (uint, error) {
+	locationID, err := scopedLocationID(c)
+	if err != nil || locationID != 0 {
+		return locationID, err
+	}
+	return inventory.DefaultLocationID(database.GetDB())
+}
+
+// fillLocationStock sets LocationStock on each product to its stock at the
+// given location.
+func fillLocationStock(products []models.Product, locationID uint) {
+	if locationID == 0 || len(products) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+
+	var levels []models.StockLevel
+	database.GetDB().Where("location_id = ? AND product_id IN ?", locationID, ids).Find(&levels)
+
+	quantities := make(map[uint]int, len(levels))
+	for _, level := range levels {
+		quantities[level.ProductID] = level.Quantity
+	}
+
+	for i := range products {
+		qty := quantities[products[i].ID]
+		products[i].LocationStock = &qty
+	}
+}
+
+// Get all locations
+func GetLocations(c *gin.Context) {
+	var locations []models.Location
+
+	query := database.GetDB().Order("name")
+	if c.Query("include_inactive") != "true" {
+		query = query.Where("is_active = ?", true)
+	}
+	if c.Query("include_transit") != "true" {
+		query = query.Where("type != ?", models.LocationTransit)
+	}
+
+	if err := query.Find(&locations).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch locations", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Locations fetched successfully", locations)
+}
+
+// Create location
+func CreateLocation(c *gin.Context) {
+	var req LocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+
+	var existing models.Location
+	if err := db.Where("code = ?", req.Code).First(&existing).Error; err == nil {
+		utils.ErrorResponse(c, "Location code already exists", nil)
+		return
+	}
+
+	location := models.Location{
+		Code:     req.Code,
+		Name:     req.Name,
+		Type:     req.Type,
+		Address:  req.Address,
+		IsActive: true,
+	}
+	if req.IsActive != nil {
+		location.IsActive = *req.IsActive
+	}
+
+	if err := db.Create(&location).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to create location", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Location created successfully", location)
+}
+
+// Update location
+func UpdateLocation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location ID", err)
+		return
+	}
+
+	var req LocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	var location models.Location
+	if err := db.First(&location, id).Error; err != nil || location.Type == models.LocationTransit {
+		utils.NotFoundResponse(c, "Location not found")
+		return
+	}
+
+	var existing models.Location
+	if err := db.Where("code = ? AND id != ?", req.Code, id).First(&existing).Error; err == nil {
+		utils.ErrorResponse(c, "Location code already exists", nil)
+		return
+	}
+
+	location.Code = req.Code
+	location.Name = req.Name
+	location.Type = req.Type
+	location.Address = req.Address
+	if req.IsActive != nil {
+		location.IsActive = *req.IsActive
+	}
+
+	if err := db.Save(&location).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to update location", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Location updated successfully", location)
+}
+
+// Delete location, only once it holds no stock
+func DeleteLocation(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var location models.Location
+	if err := db.First(&location, id).Error; err != nil || location.Type == models.LocationTransit {
+		utils.NotFoundResponse(c, "Location not found")
+		return
+	}
+
+	var stocked int64
+	db.Model(&models.StockLevel{}).Where("location_id = ? AND quantity != 0", location.ID).Count(&stocked)
+	if stocked > 0 {
+		utils.ErrorResponse(c, "Location still holds stock", nil)
+		return
+	}
+
+	if err := db.Delete(&location).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to delete location", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Location deleted successfully", nil)
+}
+
+// Get a product's stock at every location
+func GetProductStock(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid product ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var product models.Product
+	if err := db.First(&product, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Product not found")
+		return
+	}
+
+	var levels []models.StockLevel
+	if err := db.Preload("Location").Where("product_id = ?", product.ID).Find(&levels).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch stock levels", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Stock levels fetched successfully", gin.H{
+		"product_id":   product.ID,
+		"total_stock":  product.Stock,
+		"stock_levels": levels,
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/inventory"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type NearExpiryLot struct {
+	models.StockLot
+	DaysToExpiry int     `json:"days_to_expiry"`
+	Expired      bool    `json:"expired"`
+	StockValue   float64 `json:"stock_value"`
+}
+
+// Get lots of a product, in the order they will be sold
+func GetProductLots(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid product ID", err)
+		return
+	}
+
+	query := database.GetDB().Where("product_id = ?", id)
+	if locationID, err := scopedLocationID(c); err == nil && locationID != 0 {
+		query = query.Where("location_id = ?", locationID)
+	}
+	if c.Query("include_empty") != "true" {
+		query = query.Where("quantity > 0")
+	}
+
+	var lots []models.StockLot
+	if err := query.Order("expiry_date IS NULL, expiry_date ASC, received_date ASC, id ASC").Find(&lots).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch lots", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Lots fetched successfully", lots)
+}
+
+// Write off the remaining quantity of a lot, e.g. once it has expired
+func WriteOffLot(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid lot ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var lot models.StockLot
+	if err := db.First(&lot, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Lot not found")
+		return
+	}
+
+	userID, _ := currentUserID(c)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		_, err := inventory.WriteOffLot(tx, lot.ID, userID, c.Query("reason"))
+		return err
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to write off lot", err)
+		return
+	}
+
+	db.First(&lot, lot.ID)
+
+	utils.SuccessResponse(c, "Lot written off successfully", lot)
+}
+
+// Get lots expiring within the given number of days, including expired ones
+func GetNearExpiryReport(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 0 {
+		utils.ErrorResponse(c, "Invalid days parameter", err)
+		return
+	}
+
+	now := time.Now()
+	until := now.AddDate(0, 0, days).Format("2006-01-02")
+
+	var lots []models.StockLot
+	query := database.GetDB().Preload("Product").
+		Where("quantity > 0 AND expiry_date IS NOT NULL AND expiry_date <= ?", until)
+	if locationID, err := scopedLocationID(c); err == nil && locationID != 0 {
+		query = query.Where("location_id = ?", locationID)
+	}
+	if c.Query("include_expired") == "false" {
+		query = query.Where("expiry_date >= ?", now.Format("2006-01-02"))
+	}
+
+	if err := query.Order("expiry_date ASC").Find(&lots).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch near-expiry lots", err)
+		return
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	report := make([]NearExpiryLot, 0, len(lots))
+	var totalValue float64
+	for _, lot := range lots {
+		expiry := time.Date(lot.ExpiryDate.Year(), lot.ExpiryDate.Month(), lot.ExpiryDate.Day(), 0, 0, 0, 0, time.UTC)
+		entry := NearExpiryLot{
+			StockLot:     lot,
+			DaysToExpiry: int(expiry.Sub(today).Hours() / 24),
+			Expired:      lot.IsExpired(now),
+			StockValue:   float64(lot.Quantity) * lot.UnitCost,
+		}
+		totalValue += entry.StockValue
+		report = append(report, entry)
+	}
+
+	utils.SuccessResponse(c, "Near-expiry report fetched successfully", gin.H{
+		"days":        days,
+		"lots":        report,
+		"total_value": totalValue,
+	})
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"POS-Golang/internal/auth"
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/mailer"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Password reset settings, set at startup
+var (
+	mail             mailer.Mailer = mailer.NewLog()
+	passwordResetURL string
+	passwordResetTTL = time.Hour
+)
+
+// SetPasswordReset sets the mailer reset links are sent through, the page
+// they point to, which gets the token in its token query parameter, and
+// how long they work for
+func SetPasswordReset(m mailer.Mailer, resetURL string, ttl time.Duration) {
+	mail = m
+	passwordResetURL = resetURL
+	passwordResetTTL = ttl
+}
+
+// A user is sent at most one reset link a minute, so the form cannot be
+// used to flood their inbox
+const passwordResetCooldown = time.Minute
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+var errResetInvalid = errors.New("reset link is invalid or has expired")
+
+// badPassword writes a validation error and returns true if password does
+// not meet the password policy
+func badPassword(c *gin.Context, password string, user *models.User) bool {
+	if err := auth.CheckPassword(password, user); err != nil {
+		utils.ValidationErrorResponse(c, "Password does not meet the password policy", map[string]string{"password": err.Error()})
+		return true
+	}
+	return false
+}
+
+// Get the password policy, for the client to show when a password is set
+func GetPasswordPolicy(c *gin.Context) {
+	utils.SuccessResponse(c, "Password policy fetched successfully", auth.CurrentPasswordPolicy())
+}
+
+// Send a password reset link to a user's email. The response is the same
+// whether or not the email belongs to a user, so it cannot be used to find
+// out who has an account.
+func ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Invalid request", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation failed", map[string]string{"error": err.Error()})
+		return
+	}
+
+	const message = "If the email belongs to an account, a reset link has been sent to it"
+
+	db := database.GetDB()
+	var user models.User
+	if err := db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		utils.SuccessResponse(c, message, nil)
+		return
+	}
+
+	var recent int64
+	db.Model(&models.PasswordReset{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-passwordResetCooldown)).
+		Count(&recent)
+	if recent > 0 {
+		utils.SuccessResponse(c, message, nil)
+		return
+	}
+
+	token, hash, err := auth.NewSecret("pwr_")
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to create reset token", err)
+		return
+	}
+
+	// A new link replaces any the user was sent before
+	reset := models.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hash,
+		IP:        c.ClientIP(),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordReset{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&reset).Error
+	})
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to create reset token", err)
+		return
+	}
+
+	// Sent in the background so how long the response takes does not give
+	// away that the account exists
+	msg := passwordResetMessage(&user, token)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := mail.Send(ctx, msg); err != nil {
+			log.Printf("password reset mail to user %d: %v", user.ID, err)
+		}
+	}()
+
+	utils.SuccessResponse(c, message, nil)
+}
+
+// passwordResetMessage returns the email carrying a user's reset token
+func passwordResetMessage(user *models.User, token string) mailer.Message {
+	link := token
+	if passwordResetURL != "" {
+		if u, err := url.Parse(passwordResetURL); err == nil {
+			query := u.Query()
+			query.Set("token", token)
+			u.RawQuery = query.Encode()
+			link = u.String()
+		}
+	}
+
+	return mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password of your account. If it was you, use this to choose a new one:\n\n"+
+			"%s\n\n"+
+			"It works once and expires in %s. If you did not ask for it, you can ignore this email.\n",
+			user.Username, link, passwordResetTTL),
+	}
+}
+
+// Set a new password with a reset token. The token is used up, and every
+// session of the user ends.
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Invalid request", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation failed", map[string]string{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	var policyErr error
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordReset
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", auth.HashSecret(req.Token)).First(&reset).Error; err != nil {
+			return errResetInvalid
+		}
+		if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+			return errResetInvalid
+		}
+		if err := tx.First(&user, reset.UserID).Error; err != nil {
+			return errResetInvalid
+		}
+
+		if policyErr = auth.CheckPassword(req.Password, &user); policyErr != nil {
+			return policyErr
+		}
+
+		user.Password = req.Password
+		if err := user.HashPassword(); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).UpdateColumns(map[string]interface{}{
+			"password":             user.Password,
+			"must_change_password": false,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&reset).UpdateColumn("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return auth.RevokeUser(tx, user.ID, models.RevokePasswordChanged)
+	})
+	switch {
+	case errors.Is(err, errResetInvalid):
+		utils.ErrorResponse(c, "Reset link is invalid or has expired", nil)
+		return
+	case policyErr != nil:
+		utils.ValidationErrorResponse(c, "Password does not meet the password policy", map[string]string{"password": policyErr.Error()})
+		return
+	case err != nil:
+		utils.InternalServerErrorResponse(c, "Failed to reset password", err)
+		return
+	}
+
+	// Having proved they own the email, the user is let back in at once
+	if err := accountLimiter.Reset(accountKey(user.ID)); err != nil {
+		log.Printf("login limiter: %v", err)
+	}
+
+	utils.SuccessResponse(c, "Password reset successfully, please log in", nil)
+}
+
+// Change the signed-in user's own password. Their other sessions end; this
+// one carries on.
+func ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Invalid request", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation failed", map[string]string{"error": err.Error()})
+		return
+	}
+
+	userID, _ := currentUserID(c)
+	db := database.GetDB()
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		utils.NotFoundResponse(c, "User not found")
+		return
+	}
+
+	// Wrong current passwords count towards the login lockout, so this
+	// cannot be used to guess it instead
+	if wait, err := accountLimiter.Blocked(accountKey(user.ID)); err != nil || wait > 0 {
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to check login attempts", err)
+			return
+		}
+		lockedOut(c, "Too many wrong passwords, try again later", wait)
+		return
+	}
+	if !user.CheckPassword(req.CurrentPassword) {
+		loginFailed(ipKey(c.ClientIP()), accountKey(user.ID))
+		c.JSON(http.StatusUnauthorized, utils.Response{
+			Success: false,
+			Message: "Current password is wrong",
+		})
+		return
+	}
+
+	if badPassword(c, req.NewPassword, &user) {
+		return
+	}
+	if user.CheckPassword(req.NewPassword) {
+		utils.ValidationErrorResponse(c, "Password does not meet the password policy", map[string]string{"password": "new password must differ from the current one"})
+		return
+	}
+
+	user.Password = req.NewPassword
+	if err := user.HashPassword(); err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to hash password", err)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).UpdateColumns(map[string]interface{}{
+			"password":             user.Password,
+			"must_change_password": false,
+		}).Error; err != nil {
+			return err
+		}
+		return auth.RevokeOthers(tx, user.ID, c.GetUint("session_id"), models.RevokePasswordChanged)
+	})
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to change password", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Password changed successfully", nil)
+}
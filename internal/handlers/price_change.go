@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/pricing"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PriceChangeRequest struct {
+	// Products to reprice, given by ID, by category, by tag, or any mix
+	ProductIDs           []uint `json:"product_ids"`
+	CategoryID           uint   `json:"category_id"`
+	IncludeSubcategories bool   `json:"include_subcategories"`
+	Tag                  string `json:"tag"`
+	// Either a new price, or a percentage to raise (or, when negative,
+	// lower) the current prices by
+	Price      *float64 `json:"price" validate:"omitempty,gt=0"`
+	Percentage *float64 `json:"percentage" validate:"omitempty,gt=-100,ne=0"`
+	// When the change takes effect; right away when empty or in the past
+	EffectiveAt *time.Time `json:"effective_at"`
+	Note        string     `json:"note"`
+}
+
+// Get price changes, scheduled and past
+func GetPriceChanges(c *gin.Context) {
+	query := database.GetDB().Preload("Product")
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+	if batchNo := c.Query("batch_no"); batchNo != "" {
+		query = query.Where("batch_no = ?", batchNo)
+	}
+
+	var changes []models.PriceChange
+	if err := query.Order("effective_at DESC, id").Find(&changes).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch price changes", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Price changes fetched successfully", changes)
+}
+
+// Schedule a price change for one or more products. New prices are worked
+// out when the change is scheduled, so they can be reviewed before they take
+// effect; a percentage change is worked out again from the price at the time
+// it takes effect.
+func CreatePriceChange(c *gin.Context) {
+	var req PriceChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if (req.Price == nil) == (req.Percentage == nil) {
+		utils.ErrorResponse(c, "Give either a price or a percentage", nil)
+		return
+	}
+	if len(req.ProductIDs) == 0 && req.CategoryID == 0 && req.Tag == "" {
+		utils.ErrorResponse(c, "Give the products, a category or a tag to reprice", nil)
+		return
+	}
+
+	db := database.GetDB()
+	products, err := priceChangeProducts(db, req)
+	if err != nil {
+		utils.ErrorResponse(c, err.Error(), nil)
+		return
+	}
+	if len(products) == 0 {
+		utils.ErrorResponse(c, "No products to reprice", nil)
+		return
+	}
+
+	userID, _ := currentUserID(c)
+	now := time.Now()
+	effectiveAt := now
+	if req.EffectiveAt != nil && req.EffectiveAt.After(now) {
+		effectiveAt = *req.EffectiveAt
+	}
+
+	batchNo := generateDocumentNo("PCH")
+	changes := make([]models.PriceChange, 0, len(products))
+	for _, product := range products {
+		newPrice := 0.0
+		if req.Price != nil {
+			newPrice = *req.Price
+		} else {
+			newPrice = roundPrice(product.Price * (1 + *req.Percentage/100))
+		}
+		if newPrice <= 0 {
+			utils.ErrorResponse(c, fmt.Sprintf("New price of product %s would not be above zero", product.Name), nil)
+			return
+		}
+
+		changes = append(changes, models.PriceChange{
+			BatchNo:     batchNo,
+			ProductID:   product.ID,
+			OldPrice:    product.Price,
+			NewPrice:    newPrice,
+			Percentage:  req.Percentage,
+			EffectiveAt: effectiveAt,
+			Status:      models.PriceChangeScheduled,
+			Note:        req.Note,
+			CreatedBy:   userID,
+		})
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&changes).Error; err != nil {
+			return err
+		}
+		if effectiveAt.After(now) {
+			return nil
+		}
+
+		// Changes effective now are applied straight away
+		for _, change := range changes {
+			if _, err := pricing.Apply(tx, change.ID, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to schedule price change", err)
+		return
+	}
+
+	db.Preload("Product").Where("batch_no = ?", batchNo).Order("id").Find(&changes)
+
+	message := fmt.Sprintf("Scheduled %d price changes", len(changes))
+	if !effectiveAt.After(now) {
+		message = fmt.Sprintf("Applied %d price changes", len(changes))
+	}
+	utils.SuccessResponse(c, message, gin.H{
+		"batch_no": batchNo,
+		"changes":  changes,
+	})
+}
+
+// Cancel a scheduled price change
+func CancelPriceChange(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid price change ID", err)
+		return
+	}
+
+	cancelPriceChanges(c, database.GetDB().Where("id = ?", id))
+}
+
+// Cancel the scheduled changes left in a bulk price change
+func CancelPriceChangeBatch(c *gin.Context) {
+	cancelPriceChanges(c, database.GetDB().Where("batch_no = ?", c.Param("batchNo")))
+}
+
+// Get the price history of a product
+func GetPriceHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid product ID", err)
+		return
+	}
+
+	var history []models.PriceHistory
+	err = database.GetDB().Preload("User").
+		Where("product_id = ?", id).
+		Order("created_at DESC, id DESC").
+		Find(&history).Error
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch price history", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Price history fetched successfully", history)
+}
+
+// cancelPriceChanges cancels the scheduled changes the query matches
+func cancelPriceChanges(c *gin.Context, query *gorm.DB) {
+	userID, _ := currentUserID(c)
+
+	result := query.Model(&models.PriceChange{}).
+		Where("status = ?", models.PriceChangeScheduled).
+		Updates(map[string]interface{}{
+			"status":       models.PriceChangeCancelled,
+			"cancelled_by": userID,
+		})
+	if result.Error != nil {
+		utils.ErrorResponse(c, "Failed to cancel price change", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.NotFoundResponse(c, "No scheduled price change found")
+		return
+	}
+
+	utils.SuccessResponse(c, fmt.Sprintf("Cancelled %d price changes", result.RowsAffected), nil)
+}
+
+// priceChangeProducts loads the products a price change applies to
+func priceChangeProducts(db *gorm.DB, req PriceChangeRequest) ([]models.Product, error) {
+	// A product is repriced when it matches any of the targets given
+	targets := db.Session(&gorm.Session{NewDB: true})
+	if req.CategoryID != 0 {
+		var category models.Category
+		if err := db.First(&category, req.CategoryID).Error; err != nil {
+			return nil, fmt.Errorf("Category not found")
+		}
+		if req.IncludeSubcategories {
+			targets = targets.Or("category_id IN (?)", categorySubtree(db, category))
+		} else {
+			targets = targets.Or("category_id = ?", category.ID)
+		}
+	}
+	if req.Tag != "" {
+		var tag models.Tag
+		if err := db.Where("name = ?", req.Tag).First(&tag).Error; err != nil {
+			return nil, fmt.Errorf("Tag not found")
+		}
+		targets = targets.Or(productHasTagSQL, tag.Name)
+	}
+	if len(req.ProductIDs) > 0 {
+		targets = targets.Or("id IN ?", req.ProductIDs)
+	}
+	query := db.Order("id").Where(targets)
+
+	var products []models.Product
+	if err := query.Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[uint]bool, len(products))
+	for _, product := range products {
+		found[product.ID] = true
+	}
+	for _, id := range req.ProductIDs {
+		if !found[id] {
+			return nil, fmt.Errorf("Product with ID %d not found", id)
+		}
+	}
+	return products, nil
+}
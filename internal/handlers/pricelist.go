@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/pricing"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PriceListRequest struct {
+	Code        string `json:"code" validate:"required,max=30"`
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+	IsDefault   bool   `json:"is_default"`
+	IsActive    *bool  `json:"is_active"`
+}
+
+type PriceTierRequest struct {
+	MinQuantity int     `json:"min_quantity" validate:"required,gte=1"`
+	Price       float64 `json:"price" validate:"required,gt=0"`
+}
+
+type ProductPricesRequest struct {
+	ProductID uint `json:"product_id" validate:"required"`
+	// Tiers replace the product's prices on the list; the first should
+	// usually start at 1
+	Tiers []PriceTierRequest `json:"tiers" validate:"required,min=1,dive"`
+}
+
+// Get all price lists
+func GetPriceLists(c *gin.Context) {
+	var lists []models.PriceList
+	if err := database.GetDB().Order("name").Find(&lists).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch price lists", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Price lists fetched successfully", lists)
+}
+
+// Get single price list with its prices
+func GetPriceList(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid price list ID", err)
+		return
+	}
+
+	var list models.PriceList
+	err = database.GetDB().
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("product_id, min_quantity") }).
+		Preload("Items.Product").
+		First(&list, id).Error
+	if err != nil {
+		utils.NotFoundResponse(c, "Price list not found")
+		return
+	}
+
+	utils.SuccessResponse(c, "Price list fetched successfully", list)
+}
+
+// Create price list
+func CreatePriceList(c *gin.Context) {
+	var req PriceListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	list := models.PriceList{
+		Code:        req.Code,
+		Name:        req.Name,
+		Description: req.Description,
+		IsDefault:   req.IsDefault,
+		IsActive:    true,
+	}
+	if req.IsActive != nil {
+		list.IsActive = *req.IsActive
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&list).Error; err != nil {
+			return err
+		}
+		return keepSingleDefaultPriceList(tx, list)
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to create price list", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Price list created successfully", list)
+}
+
+// Update price list
+func UpdatePriceList(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid price list ID", err)
+		return
+	}
+
+	var req PriceListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	var list models.PriceList
+	if err := db.First(&list, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Price list not found")
+		return
+	}
+
+	list.Code = req.Code
+	list.Name = req.Name
+	list.Description = req.Description
+	list.IsDefault = req.IsDefault
+	if req.IsActive != nil {
+		list.IsActive = *req.IsActive
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Items").Save(&list).Error; err != nil {
+			return err
+		}
+		return keepSingleDefaultPriceList(tx, list)
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to update price list", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Price list updated successfully", list)
+}
+
+// Delete price list. Customers on it go back to the default prices.
+func DeletePriceList(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid price list ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var list models.PriceList
+	if err := db.First(&list, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Price list not found")
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Customer{}).Where("price_list_id = ?", list.ID).
+			Update("price_list_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&list).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to delete price list", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Price list deleted successfully", nil)
+}
+
+// Set a product's prices and quantity breaks on a price list
+func SetPriceListPrices(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid price list ID", err)
+		return
+	}
+
+	var req ProductPricesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	var list models.PriceList
+	if err := db.First(&list, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Price list not found")
+		return
+	}
+
+	var product models.Product
+	if err := db.First(&product, req.ProductID).Error; err != nil {
+		utils.ErrorResponse(c, fmt.Sprintf("Product with ID %d not found", req.ProductID), err)
+		return
+	}
+
+	seen := make(map[int]bool, len(req.Tiers))
+	items := make([]models.PriceListItem, 0, len(req.Tiers))
+	for _, tier := range req.Tiers {
+		if seen[tier.MinQuantity] {
+			utils.ErrorResponse(c, fmt.Sprintf("Minimum quantity %d is listed twice", tier.MinQuantity), nil)
+			return
+		}
+		seen[tier.MinQuantity] = true
+		items = append(items, models.PriceListItem{
+			PriceListID: list.ID,
+			ProductID:   product.ID,
+			MinQuantity: tier.MinQuantity,
+			Price:       tier.Price,
+		})
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("price_list_id = ? AND product_id = ?", list.ID, product.ID).
+			Delete(&models.PriceListItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&items).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to set prices", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Prices set successfully", items)
+}
+
+// Remove a product's prices from a price list
+func DeletePriceListPrices(c *gin.Context) {
+	result := database.GetDB().
+		Where("price_list_id = ? AND product_id = ?", c.Param("id"), c.Param("productId")).
+		Delete(&models.PriceListItem{})
+	if result.Error != nil {
+		utils.ErrorResponse(c, "Failed to remove prices", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.NotFoundResponse(c, "Product has no prices on this price list")
+		return
+	}
+
+	utils.SuccessResponse(c, "Prices removed successfully", nil)
+}
+
+// Get the price a product sells at for a quantity, customer and price list,
+// as CreateTransaction will charge it
+func GetProductPrice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid product ID", err)
+		return
+	}
+
+	quantity, err := strconv.Atoi(c.DefaultQuery("quantity", "1"))
+	if err != nil || quantity < 1 {
+		utils.ErrorResponse(c, "Invalid quantity", nil)
+		return
+	}
+
+	db := database.GetDB()
+	var product models.Product
+	if err := db.First(&product, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Product not found")
+		return
+	}
+
+	customer, priceListID, err := saleCustomerAndList(db, c.Query("customer_id"), c.Query("price_list_id"))
+	if err != nil {
+		utils.ErrorResponse(c, err.Error(), nil)
+		return
+	}
+
+	list, err := pricing.ActiveList(db, priceListID, customer)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid price list", err)
+		return
+	}
+
+	unitPrice, err := pricing.UnitPrice(db, list, product, quantity)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to work out price", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Price fetched successfully", gin.H{
+		"product_id": product.ID,
+		"quantity":   quantity,
+		"price_list": list,
+		"base_price": product.Price,
+		"unit_price": unitPrice,
+		"subtotal":   unitPrice * float64(quantity),
+	})
+}
+
+// saleCustomerAndList parses the customer and price list IDs given for a
+// sale, loading the customer
+func saleCustomerAndList(db *gorm.DB, customerID, priceListID string) (*models.Customer, *uint, error) {
+	var customer *models.Customer
+	if customerID != "" {
+		id, err := strconv.Atoi(customerID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid customer ID")
+		}
+		customer, err = findSaleCustomer(db, uint(id))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var listID *uint
+	if priceListID != "" {
+		id, err := strconv.Atoi(priceListID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid price list ID")
+		}
+		value := uint(id)
+		listID = &value
+	}
+	return customer, listID, nil
+}
+
+// findSaleCustomer loads a customer that can be sold to
+func findSaleCustomer(db *gorm.DB, id uint) (*models.Customer, error) {
+	var customer models.Customer
+	if err := db.First(&customer, id).Error; err != nil {
+		return nil, fmt.Errorf("Customer with ID %d not found", id)
+	}
+	if !customer.IsActive {
+		return nil, fmt.Errorf("Customer %s is not active", customer.Name)
+	}
+	return &customer, nil
+}
+
+// keepSingleDefaultPriceList clears the default flag on every other list
+// when this one is the default
+func keepSingleDefaultPriceList(tx *gorm.DB, list models.PriceList) error {
+	if !list.IsDefault {
+		return nil
+	}
+	return tx.Model(&models.PriceList{}).Where("id != ? AND is_default = ?", list.ID, true).
+		Update("is_default", false).Error
+}
@@ -1,23 +1,71 @@
 package handlers
 
 import (
+	"POS-Golang/internal/barcode"
 	"POS-Golang/internal/database"
+	"POS-Golang/internal/inventory"
 	"POS-Golang/internal/models"
+	"POS-Golang/internal/pricing"
+	"POS-Golang/internal/search"
+	"POS-Golang/internal/trash"
 	"POS-Golang/internal/utils"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// Full-text product index used by GetProducts, set at startup
+var productSearch *search.Index
+
+var (
+	errLotsHoldStock = errors.New("lots still hold stock")
+	errSerialStock   = errors.New("stock of a serial-tracked product changes through its serial numbers")
+)
+
+// Searches rank at most this many products
+const maxSearchResults = 1000
+
+// SetProductSearch sets the index product searches use
+func SetProductSearch(index *search.Index) {
+	productSearch = index
+}
+
 type ProductRequest struct {
-	Name        string  `json:"name" validate:"required"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price" validate:"required,gt=0"`
-	Stock       int     `json:"stock" validate:"required,gte=0"`
-	CategoryID  uint    `json:"category_id"`
-	Barcode     string  `json:"barcode"`
-	IsActive    *bool   `json:"is_active"`
+	Name        string   `json:"name" validate:"required"`
+	Description string   `json:"description"`
+	Price       float64  `json:"price" validate:"required,gt=0"`
+	Cost        *float64 `json:"cost" validate:"omitempty,gte=0"`
+	Stock       int      `json:"stock" validate:"required,gte=0"`
+	CategoryID  uint     `json:"category_id"`
+	Barcode     string   `json:"barcode"`
+	SKU         string   `json:"sku" validate:"max=64"`
+	PLU         string   `json:"plu"` // five-digit item code for scale barcodes
+	IsActive    *bool    `json:"is_active"`
+	TrackLots   *bool    `json:"track_lots"`
+	// Serial tracking for high-value items such as electronics
+	TrackSerials   *bool `json:"track_serials"`
+	WarrantyMonths *int  `json:"warranty_months" validate:"omitempty,gte=0"`
+	// Replenishment settings used by the reorder suggestions
+	MinStock     *int  `json:"min_stock" validate:"omitempty,gte=0"`
+	ReorderPoint *int  `json:"reorder_point" validate:"omitempty,gte=0"`
+	MaxStock     *int  `json:"max_stock" validate:"omitempty,gte=0"`
+	SupplierID   *uint `json:"supplier_id"`
+	// GenerateBarcode gives a product created without a barcode an internal
+	// EAN-13 barcode
+	GenerateBarcode bool `json:"generate_barcode"`
+	// Tags by name, created when new; left as they are when omitted on
+	// update
+	Tags []string `json:"tags"`
+	// Custom attribute values by attribute code. They replace all of the
+	// product's values, and are left as they are when omitted; required
+	// attributes are only checked when they are given.
+	Attributes map[string]interface{} `json:"attributes"`
 }
 
 // Get all products
@@ -31,17 +79,69 @@ func GetProducts(c *gin.Context) {
 	search := c.Query("search")
 	category := c.Query("category")
 
-	query := db.Preload("Category")
+	// Stock is reported for the user's store, or a location an admin picks
+	locationID, err := scopedLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	query := db.Preload("Category").Preload("Tags")
 
-	// Apply filters
+	// Apply filters. Searches go to the full-text index, ranked best match
+	// first, and to a plain LIKE while the index is still being built.
 	if search != "" {
-		query = query.Where("name LIKE ? OR barcode LIKE ?", "%"+search+"%", "%"+search+"%")
+		if productSearch != nil && productSearch.Ready() {
+			results := productSearch.Search(search, maxSearchResults)
+			ids := make([]uint, len(results))
+			for i, result := range results {
+				ids[i] = result.ID
+			}
+			if len(ids) == 0 {
+				query = query.Where("1 = 0")
+			} else {
+				query = query.Where("id IN ?", ids).Order(clause.Expr{SQL: "FIELD(id, ?)", Vars: []interface{}{ids}})
+			}
+		} else {
+			query = query.Where("name LIKE ? OR barcode LIKE ? OR sku LIKE ?", "%"+search+"%", "%"+search+"%", "%"+search+"%")
+		}
 	}
 
 	if category != "" {
 		categoryID, _ := strconv.Atoi(category)
 		if categoryID > 0 {
-			query = query.Where("category_id = ?", categoryID)
+			// include_subcategories=true also matches products anywhere
+			// below the category
+			var selected models.Category
+			if c.Query("include_subcategories") == "true" && db.First(&selected, categoryID).Error == nil {
+				query = query.Where("category_id IN (?)", categorySubtree(db, selected))
+			} else {
+				query = query.Where("category_id = ?", categoryID)
+			}
+		}
+	}
+
+	// tags=a,b matches products carrying every tag listed
+	if tags := c.Query("tags"); tags != "" {
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				query = query.Where(productHasTagSQL, tag)
+			}
+		}
+	}
+
+	// attr[code]=value filters on custom attributes
+	query, err = filterByAttributes(db, query, c.QueryMap("attr"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid attribute filter", err)
+		return
+	}
+
+	if c.Query("in_stock") == "true" {
+		if locationID != 0 {
+			query = query.Where("EXISTS (SELECT 1 FROM stock_levels WHERE stock_levels.product_id = products.id AND stock_levels.location_id = ? AND stock_levels.quantity > 0)", locationID)
+		} else {
+			query = query.Where("stock > 0")
 		}
 	}
 
@@ -56,8 +156,13 @@ func GetProducts(c *gin.Context) {
 		return
 	}
 
+	fillLocationStock(products, locationID)
+	fillPrimaryImages(db, products)
+	fillProductAttributes(db, products)
+
 	utils.SuccessResponse(c, "Products fetched successfully", gin.H{
-		"products": products,
+		"products":    products,
+		"location_id": locationID,
 		"pagination": gin.H{
 			"page":  page,
 			"limit": limit,
@@ -78,11 +183,24 @@ func GetProduct(c *gin.Context) {
 	db := database.GetDB()
 	var product models.Product
 
-	if err := db.Preload("Category").First(&product, id).Error; err != nil {
+	if err := db.Preload("Category").Preload("Tags").First(&product, id).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
+	products := []models.Product{product}
+	if locationID, err := scopedLocationID(c); err == nil {
+		fillLocationStock(products, locationID)
+	}
+	fillProductAttributes(db, products)
+	product = products[0]
+
+	product.Images, _ = productImages(db, product.ID)
+	if len(product.Images) > 0 && product.Images[0].IsPrimary {
+		product.ImageURL = product.Images[0].URL
+		product.ThumbnailURL = product.Images[0].ThumbnailURL
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Product fetched successfully",
 		"data":    product,
@@ -118,20 +236,42 @@ func CreateProduct(c *gin.Context) {
 
 	// Check if barcode already exists (if provided)
 	if req.Barcode != "" {
-		var existingProduct models.Product
-		if err := db.Where("barcode = ?", req.Barcode).First(&existingProduct).Error; err == nil {
+		if err := barcode.Validate(req.Barcode); err != nil {
+			utils.ErrorResponse(c, "Invalid barcode", err)
+			return
+		}
+
+		if barcodeInUse(db, req.Barcode, 0) {
 			utils.ErrorResponse(c, "Barcode already exists", nil)
 			return
 		}
 	}
 
+	// Check the scale item code (if provided)
+	if req.PLU != "" {
+		if err := checkPLU(db, req.PLU, 0); err != nil {
+			utils.ErrorResponse(c, "Invalid PLU", err)
+			return
+		}
+	}
+
+	// Check if SKU already exists (if provided)
+	if req.SKU != "" {
+		var existingProduct models.Product
+		if err := db.Where("sku = ?", req.SKU).First(&existingProduct).Error; err == nil {
+			utils.ErrorResponse(c, "SKU already exists", nil)
+			return
+		}
+	}
+
 	product := models.Product{
 		Name:        req.Name,
 		Description: req.Description,
 		Price:       req.Price,
-		Stock:       req.Stock,
 		CategoryID:  req.CategoryID,
-		Barcode:     req.Barcode,
+		Barcode:     optionalString(req.Barcode),
+		SKU:         optionalString(req.SKU),
+		PLU:         optionalString(req.PLU),
 		IsActive:    true,
 	}
 
@@ -139,17 +279,159 @@ func CreateProduct(c *gin.Context) {
 		product.IsActive = *req.IsActive
 	}
 
-	if err := db.Create(&product).Error; err != nil {
+	if req.Cost != nil {
+		product.Cost = *req.Cost
+	}
+
+	if req.TrackLots != nil {
+		product.TrackLots = *req.TrackLots
+	}
+
+	applySerialSettings(&product, req)
+
+	// Each unit of a serial-tracked product needs its serial, so stock only
+	// comes in through goods receipts or serial registration
+	if product.TrackSerials && req.Stock != 0 {
+		utils.ErrorResponse(c, "Serial-tracked products cannot be created with opening stock", nil)
+		return
+	}
+
+	if err := applyReorderSettings(&product, req); err != nil {
+		utils.ErrorResponse(c, "Invalid reorder settings", err)
+		return
+	}
+
+	var attributes []models.ProductAttribute
+	if req.Attributes != nil {
+		var err error
+		if attributes, err = parseAttributeValues(db, req.Attributes); err != nil {
+			utils.ErrorResponse(c, "Invalid attributes", err)
+			return
+		}
+	}
+
+	userID, _ := currentUserID(c)
+
+	// Opening stock is placed at the user's store
+	locationID, err := operatingLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := createProduct(tx, &product); err != nil {
+			return err
+		}
+
+		if product.Barcode == nil && req.GenerateBarcode {
+			if err := assignInternalBarcode(tx, &product); err != nil {
+				return err
+			}
+		}
+
+		if err := setProductTags(tx, &product, req.Tags); err != nil {
+			return err
+		}
+		if req.Attributes != nil {
+			if err := saveProductAttributes(tx, product.ID, attributes); err != nil {
+				return err
+			}
+		}
+
+		if req.Stock == 0 {
+			return nil
+		}
+
+		// Opening stock is booked through the stock ledger
+		_, err := inventory.Move(tx, inventory.Movement{
+			ProductID:     product.ID,
+			LocationID:    locationID,
+			Type:          models.MovementOpening,
+			Quantity:      req.Stock,
+			ReferenceType: "product",
+			ReferenceID:   product.ID,
+			UserID:        userID,
+			LotNumber:     "OPENING",
+		})
+		return err
+	})
+	if err != nil {
 		utils.ErrorResponse(c, "Failed to create product", err)
 		return
 	}
 
 	// Load the category relation
-	db.Preload("Category").First(&product, product.ID)
+	db.Preload("Category").Preload("Tags").First(&product, product.ID)
+	products := []models.Product{product}
+	fillProductAttributes(db, products)
+	product = products[0]
 
 	utils.SuccessResponse(c, "Product created successfully", product)
 }
 
+// createProduct inserts the product. GORM leaves out zero values of columns
+// with a default when creating, so those are written again afterwards to
+// keep an inactive product or a reorder point of zero.
+func createProduct(tx *gorm.DB, product *models.Product) error {
+	if err := tx.Create(product).Error; err != nil {
+		return err
+	}
+	return tx.Model(product).Select("is_active", "reorder_point").Updates(product).Error
+}
+
+// optionalString stores an empty code such as a barcode, SKU or customer
+// code as NULL so that rows without one do not collide on the unique index
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func applySerialSettings(product *models.Product, req ProductRequest) {
+	if req.TrackSerials != nil {
+		product.TrackSerials = *req.TrackSerials
+	}
+	if req.WarrantyMonths != nil {
+		product.WarrantyMonths = *req.WarrantyMonths
+	}
+}
+
+// applyReorderSettings copies the replenishment settings that were given
+// onto the product and checks that they are consistent
+func applyReorderSettings(product *models.Product, req ProductRequest) error {
+	if req.MinStock != nil {
+		product.MinStock = *req.MinStock
+	}
+	if req.ReorderPoint != nil {
+		product.ReorderPoint = *req.ReorderPoint
+	}
+	if req.MaxStock != nil {
+		product.MaxStock = *req.MaxStock
+	}
+
+	if product.ReorderPoint < product.MinStock {
+		return fmt.Errorf("reorder point cannot be below minimum stock")
+	}
+	if product.MaxStock != 0 && product.MaxStock < product.ReorderPoint {
+		return fmt.Errorf("maximum stock cannot be below the reorder point")
+	}
+
+	if req.SupplierID != nil {
+		if *req.SupplierID == 0 {
+			product.SupplierID = nil
+			return nil
+		}
+		var supplier models.Supplier
+		if err := database.GetDB().First(&supplier, *req.SupplierID).Error; err != nil {
+			return fmt.Errorf("supplier not found")
+		}
+		product.SupplierID = req.SupplierID
+	}
+	return nil
+}
+
 // Update product
 func UpdateProduct(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -190,34 +472,188 @@ func UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	// Check if barcode already exists (if changed and provided)
-	if req.Barcode != "" && req.Barcode != product.Barcode {
-		var existingProduct models.Product
-		if err := db.Where("barcode = ? AND id != ?", req.Barcode, id).First(&existingProduct).Error; err == nil {
+	// Check if barcode already exists (if changed and provided). Barcodes
+	// saved before validation existed are kept as they are.
+	if req.Barcode != "" && (product.Barcode == nil || req.Barcode != *product.Barcode) {
+		if err := barcode.Validate(req.Barcode); err != nil {
+			utils.ErrorResponse(c, "Invalid barcode", err)
+			return
+		}
+
+		if barcodeInUse(db, req.Barcode, product.ID) {
 			utils.ErrorResponse(c, "Barcode already exists", nil)
 			return
 		}
 	}
 
+	// Check the scale item code (if provided)
+	if req.PLU != "" {
+		if err := checkPLU(db, req.PLU, product.ID); err != nil {
+			utils.ErrorResponse(c, "Invalid PLU", err)
+			return
+		}
+	}
+
+	// Check if SKU already exists (if provided)
+	if req.SKU != "" {
+		var existingProduct models.Product
+		if err := db.Where("sku = ? AND id != ?", req.SKU, id).First(&existingProduct).Error; err == nil {
+			utils.ErrorResponse(c, "SKU already exists", nil)
+			return
+		}
+	}
+
 	// Update fields
+	oldPrice := product.Price
 	product.Name = req.Name
 	product.Description = req.Description
 	product.Price = req.Price
-	product.Stock = req.Stock
 	product.CategoryID = req.CategoryID
-	product.Barcode = req.Barcode
+	product.Barcode = optionalString(req.Barcode)
+	product.SKU = optionalString(req.SKU)
+	product.PLU = optionalString(req.PLU)
 
 	if req.IsActive != nil {
 		product.IsActive = *req.IsActive
 	}
 
-	if err := db.Save(&product).Error; err != nil {
+	// Cost is normally maintained by goods receipts, but can be corrected
+	// by hand when provided
+	omit := []string{"stock"}
+	if req.Cost != nil {
+		product.Cost = *req.Cost
+	} else {
+		omit = append(omit, "cost")
+	}
+
+	// Units already in stock have no serials, so tracking can only start
+	// from empty
+	if req.TrackSerials != nil && *req.TrackSerials && !product.TrackSerials && product.Stock != 0 {
+		utils.ErrorResponse(c, "Cannot start tracking serials while the product has stock", nil)
+		return
+	}
+
+	applySerialSettings(&product, req)
+
+	if err := applyReorderSettings(&product, req); err != nil {
+		utils.ErrorResponse(c, "Invalid reorder settings", err)
+		return
+	}
+
+	startLotTracking, stopLotTracking := false, false
+	if req.TrackLots != nil && *req.TrackLots != product.TrackLots {
+		startLotTracking = *req.TrackLots
+		stopLotTracking = !*req.TrackLots
+		product.TrackLots = *req.TrackLots
+	}
+
+	var attributes []models.ProductAttribute
+	if req.Attributes != nil {
+		if attributes, err = parseAttributeValues(db, req.Attributes); err != nil {
+			utils.ErrorResponse(c, "Invalid attributes", err)
+			return
+		}
+	}
+
+	userID, _ := currentUserID(c)
+
+	// The stock given is the stock at the user's store
+	locationID, err := operatingLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if stopLotTracking {
+			// Lock the product so no sale or receipt moves lot stock between
+			// the check and the save
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Product{}, product.ID).Error; err != nil {
+				return err
+			}
+			var lotStock int64
+			if err := tx.Model(&models.StockLot{}).Where("product_id = ?", product.ID).Select("COALESCE(SUM(quantity), 0)").Scan(&lotStock).Error; err != nil {
+				return err
+			}
+			if lotStock > 0 {
+				return errLotsHoldStock
+			}
+		}
+
+		// Stock is owned by the stock ledger, so it is excluded here and any
+		// difference is booked as an adjustment below
+		if err := tx.Omit(omit...).Save(&product).Error; err != nil {
+			return err
+		}
+
+		if err := pricing.RecordPrice(tx, product.ID, oldPrice, pricing.PriceUpdate{
+			Price:  product.Price,
+			Source: models.PriceSourceManual,
+			UserID: userID,
+		}); err != nil {
+			return err
+		}
+
+		if startLotTracking {
+			if err := inventory.StartLotTracking(tx, &product); err != nil {
+				return err
+			}
+		}
+
+		if req.Tags != nil {
+			if err := setProductTags(tx, &product, req.Tags); err != nil {
+				return err
+			}
+		}
+		if req.Attributes != nil {
+			if err := saveProductAttributes(tx, product.ID, attributes); err != nil {
+				return err
+			}
+		}
+
+		onHand, err := inventory.StockAt(tx, product.ID, locationID)
+		if err != nil {
+			return err
+		}
+		if diff := req.Stock - onHand; diff != 0 {
+			if product.TrackSerials {
+				return errSerialStock
+			}
+			if _, err := inventory.Move(tx, inventory.Movement{
+				ProductID:     product.ID,
+				LocationID:    locationID,
+				Type:          models.MovementAdjustment,
+				Quantity:      diff,
+				ReferenceType: "product",
+				ReferenceID:   product.ID,
+				UserID:        userID,
+				Note:          "Stock edited on product",
+				// Corrections may remove expired stock from lots
+				IncludeExpired: true,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errLotsHoldStock) {
+		utils.ErrorResponse(c, "Cannot stop lot tracking while lots still hold stock", nil)
+		return
+	}
+	if errors.Is(err, errSerialStock) {
+		utils.ErrorResponse(c, "Stock of a serial-tracked product changes through its serial numbers", nil)
+		return
+	}
+	if err != nil {
 		utils.ErrorResponse(c, "Failed to update product", err)
 		return
 	}
 
 	// Load the category relation
-	db.Preload("Category").First(&product, product.ID)
+	db.Preload("Category").Preload("Tags").First(&product, product.ID)
+	products := []models.Product{product}
+	fillProductAttributes(db, products)
+	product = products[0]
 
 	utils.SuccessResponse(c, "Product updated successfully", product)
 }
@@ -239,7 +675,13 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	if err := db.Delete(&product).Error; err != nil {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&product).Error; err != nil {
+			return err
+		}
+		return trash.Record(tx, models.TrashDeleted, trash.Products, product.ID, product.Name, trashUserID(c))
+	})
+	if err != nil {
 		utils.ErrorResponse(c, "Failed to delete product", err)
 		return
 	}
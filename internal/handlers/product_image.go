@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/imaging"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/storage"
+	"POS-Golang/internal/utils"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Where product images are kept and served from, set at startup
+var (
+	imageStorage   storage.Storage
+	imageBaseURL         = "/api/v1/images"
+	imageMaxUpload int64 = 10 << 20
+)
+
+// SetImageStorage sets the store product images are kept in, the URL they
+// are served under, and the largest upload accepted in bytes
+func SetImageStorage(store storage.Storage, baseURL string, maxUpload int64) {
+	imageStorage = store
+	imageBaseURL = strings.TrimSuffix(baseURL, "/")
+	imageMaxUpload = maxUpload
+}
+
+const maxImagesPerUpload = 10
+
+type ProductImageRequest struct {
+	IsPrimary *bool `json:"is_primary"`
+	SortOrder *int  `json:"sort_order" validate:"omitempty,gte=0"`
+}
+
+// Get the images of a product
+func GetProductImages(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid product ID", err)
+		return
+	}
+
+	images, err := productImages(database.GetDB(), uint(id))
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch product images", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Product images fetched successfully", images)
+}
+
+// Upload one or more images of a product, sent as multipart "images" files.
+// The first image of a product becomes its primary image, as does the first
+// one uploaded with primary=true.
+func UploadProductImages(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid product ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var product models.Product
+	if err := db.First(&product, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Product not found")
+		return
+	}
+
+	// Room for a full batch of images plus the form overhead
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImagesPerUpload*imageMaxUpload+(1<<20))
+	form, err := c.MultipartForm()
+	if err != nil {
+		utils.ErrorResponse(c, "Images must be sent as multipart form data", err)
+		return
+	}
+	files := append(form.File["images"], form.File["image"]...)
+	if len(files) == 0 {
+		utils.ErrorResponse(c, "At least one image is required", nil)
+		return
+	}
+	if len(files) > maxImagesPerUpload {
+		utils.ErrorResponse(c, fmt.Sprintf("At most %d images can be uploaded at once", maxImagesPerUpload), nil)
+		return
+	}
+
+	// Every file is checked before any is stored
+	processed := make([]*imaging.Image, 0, len(files))
+	for _, file := range files {
+		img, err := readImageUpload(file)
+		if err != nil {
+			utils.ErrorResponse(c, fmt.Sprintf("Invalid image %s", file.Filename), err)
+			return
+		}
+		processed = append(processed, img)
+	}
+
+	ctx := c.Request.Context()
+	var stored []string
+	removeStored := func() {
+		for _, key := range stored {
+			imageStorage.Delete(ctx, key)
+		}
+	}
+
+	images := make([]models.ProductImage, 0, len(processed))
+	for _, img := range processed {
+		name, err := randomImageName()
+		if err != nil {
+			removeStored()
+			utils.InternalServerErrorResponse(c, "Failed to store image", err)
+			return
+		}
+
+		image := models.ProductImage{
+			ProductID:    product.ID,
+			Key:          fmt.Sprintf("products/%d/%s%s", product.ID, name, img.Extension),
+			ThumbnailKey: fmt.Sprintf("products/%d/%s_thumb%s", product.ID, name, img.ThumbnailExtension),
+			ContentType:  img.ContentType,
+			Width:        img.Width,
+			Height:       img.Height,
+			Size:         int64(len(img.Data)),
+		}
+
+		if err := imageStorage.Put(ctx, image.Key, img.Data, img.ContentType); err != nil {
+			removeStored()
+			utils.InternalServerErrorResponse(c, "Failed to store image", err)
+			return
+		}
+		stored = append(stored, image.Key)
+
+		if err := imageStorage.Put(ctx, image.ThumbnailKey, img.Thumbnail, img.ThumbnailContentType); err != nil {
+			removeStored()
+			utils.InternalServerErrorResponse(c, "Failed to store image", err)
+			return
+		}
+		stored = append(stored, image.ThumbnailKey)
+
+		images = append(images, image)
+	}
+
+	makePrimary := c.PostForm("primary") == "true"
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		var lastOrder int
+		tx.Model(&models.ProductImage{}).Where("product_id = ?", product.ID).Count(&count)
+		tx.Model(&models.ProductImage{}).Where("product_id = ?", product.ID).
+			Select("COALESCE(MAX(sort_order), 0)").Scan(&lastOrder)
+
+		for i := range images {
+			images[i].SortOrder = lastOrder + i + 1
+		}
+		if err := tx.Create(&images).Error; err != nil {
+			return err
+		}
+
+		if count == 0 || makePrimary {
+			return setPrimaryImage(tx, product.ID, images[0].ID)
+		}
+		return nil
+	})
+	if err != nil {
+		removeStored()
+		utils.ErrorResponse(c, "Failed to save product images", err)
+		return
+	}
+
+	all, _ := productImages(db, product.ID)
+	utils.SuccessResponse(c, fmt.Sprintf("Uploaded %d images", len(images)), all)
+}
+
+// Change the order of a product image or make it the primary image
+func UpdateProductImage(c *gin.Context) {
+	var req ProductImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	image, ok := findProductImage(c, db)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if req.SortOrder != nil {
+			if err := tx.Model(&image).UpdateColumn("sort_order", *req.SortOrder).Error; err != nil {
+				return err
+			}
+		}
+		if req.IsPrimary != nil && *req.IsPrimary {
+			return setPrimaryImage(tx, image.ProductID, image.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to update product image", err)
+		return
+	}
+
+	images, _ := productImages(db, image.ProductID)
+	utils.SuccessResponse(c, "Product image updated successfully", images)
+}
+
+// Delete a product image. When it was the primary image the next image
+// takes its place.
+func DeleteProductImage(c *gin.Context) {
+	db := database.GetDB()
+	image, ok := findProductImage(c, db)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&image).Error; err != nil {
+			return err
+		}
+		if !image.IsPrimary {
+			return nil
+		}
+
+		var next models.ProductImage
+		err := tx.Where("product_id = ?", image.ProductID).Order("sort_order, id").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return setPrimaryImage(tx, image.ProductID, next.ID)
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to delete product image", err)
+		return
+	}
+
+	// The files go once the record is gone; one left behind by a storage
+	// error is only wasted space
+	ctx := c.Request.Context()
+	imageStorage.Delete(ctx, image.Key)
+	imageStorage.Delete(ctx, image.ThumbnailKey)
+
+	utils.SuccessResponse(c, "Product image deleted successfully", nil)
+}
+
+// Serve a stored image. Image keys are never reused, so clients and proxies
+// may cache them for good.
+func ServeImage(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if storage.CheckKey(key) != nil {
+		utils.NotFoundResponse(c, "Image not found")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", etag)
+	if match := c.GetHeader("If-None-Match"); match == etag || match == "*" {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	object, err := imageStorage.Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.Header("Cache-Control", "no-store")
+		utils.NotFoundResponse(c, "Image not found")
+		return
+	}
+	if err != nil {
+		c.Header("Cache-Control", "no-store")
+		utils.InternalServerErrorResponse(c, "Failed to read image", err)
+		return
+	}
+	defer object.Body.Close()
+
+	headers := map[string]string{"X-Content-Type-Options": "nosniff"}
+	if !object.ModTime.IsZero() {
+		headers["Last-Modified"] = object.ModTime.UTC().Format(http.TimeFormat)
+	}
+	c.DataFromReader(http.StatusOK, object.Size, object.ContentType, object.Body, headers)
+}
+
+// productImages loads the images of a product, primary first, with their
+// URLs
+func productImages(db *gorm.DB, productID uint) ([]models.ProductImage, error) {
+	var images []models.ProductImage
+	err := db.Where("product_id = ?", productID).Order("is_primary DESC, sort_order, id").Find(&images).Error
+	for i := range images {
+		setImageURLs(&images[i])
+	}
+	return images, err
+}
+
+// fillPrimaryImages sets the image URLs of each product from its primary
+// image
+func fillPrimaryImages(db *gorm.DB, products []models.Product) {
+	if len(products) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+
+	var images []models.ProductImage
+	db.Where("product_id IN ? AND is_primary = ?", ids, true).Find(&images)
+
+	byProduct := make(map[uint]models.ProductImage, len(images))
+	for _, image := range images {
+		setImageURLs(&image)
+		byProduct[image.ProductID] = image
+	}
+	for i := range products {
+		if image, ok := byProduct[products[i].ID]; ok {
+			products[i].ImageURL = image.URL
+			products[i].ThumbnailURL = image.ThumbnailURL
+		}
+	}
+}
+
+func setImageURLs(image *models.ProductImage) {
+	image.URL = imageBaseURL + "/" + image.Key
+	image.ThumbnailURL = imageBaseURL + "/" + image.ThumbnailKey
+}
+
+// setPrimaryImage makes the image the product's only primary image
+func setPrimaryImage(tx *gorm.DB, productID, imageID uint) error {
+	return tx.Model(&models.ProductImage{}).Where("product_id = ?", productID).
+		UpdateColumn("is_primary", gorm.Expr("id = ?", imageID)).Error
+}
+
+// findProductImage loads the image named in the URL, writing the error
+// response when it does not exist
+func findProductImage(c *gin.Context, db *gorm.DB) (models.ProductImage, bool) {
+	var image models.ProductImage
+	if err := db.Where("id = ? AND product_id = ?", c.Param("imageId"), c.Param("id")).First(&image).Error; err != nil {
+		utils.NotFoundResponse(c, "Product image not found")
+		return image, false
+	}
+	return image, true
+}
+
+// readImageUpload reads an uploaded file and checks it is an image
+func readImageUpload(file *multipart.FileHeader) (*imaging.Image, error) {
+	if file.Size > imageMaxUpload {
+		return nil, fmt.Errorf("image is larger than %d MB", imageMaxUpload>>20)
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, imageMaxUpload+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > imageMaxUpload {
+		return nil, fmt.Errorf("image is larger than %d MB", imageMaxUpload>>20)
+	}
+	return imaging.Process(data)
+}
+
+// randomImageName returns a new random file name, so stored images are never
+// overwritten and can be cached for good
+func randomImageName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
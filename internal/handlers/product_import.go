@@ -0,0 +1,656 @@
+package handlers
+
+import (
+	"POS-Golang/internal/barcode"
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/inventory"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/pricing"
+	"POS-Golang/internal/utils"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// productColumns are the columns of product import and export files. An
+// import file needs a header row naming its columns; columns left out keep
+// the product's current values.
+var productColumns = []string{
+	"sku", "barcode", "name", "description", "category", "price", "cost",
+	"stock", "min_stock", "reorder_point", "max_stock", "is_active",
+}
+
+// Largest file accepted by the product import
+const maxImportFileSize = 10 << 20
+
+type ProductImportRow struct {
+	Row       int      `json:"row"` // line in the file, counting the header
+	Action    string   `json:"action"`
+	ProductID uint     `json:"product_id,omitempty"`
+	SKU       string   `json:"sku,omitempty"`
+	Barcode   string   `json:"barcode,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// Import row actions
+const (
+	importActionCreate = "create"
+	importActionUpdate = "update"
+	importActionError  = "error"
+)
+
+// productImportPlan is a validated import row ready to be written
+type productImportPlan struct {
+	result   *ProductImportRow
+	product  models.Product
+	category []string // category name path, created when it does not exist yet
+	costSet  bool
+	oldPrice float64 // of an existing product, for the price history
+	stock    *int    // stock at the import location, when given
+}
+
+// Import products from a CSV or XLSX file, creating new products and
+// updating existing ones matched by SKU or barcode
+func ImportProducts(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(c, "A CSV or XLSX file is required", err)
+		return
+	}
+	if fileHeader.Size > maxImportFileSize {
+		utils.ErrorResponse(c, "File is too large", nil)
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to read file", err)
+		return
+	}
+	defer file.Close()
+
+	records, err := readSpreadsheet(file, fileHeader.Filename)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to read file", err)
+		return
+	}
+	if len(records) < 2 {
+		utils.ErrorResponse(c, "File has no product rows", nil)
+		return
+	}
+
+	columns, err := importColumns(records[0])
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid header row", err)
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true" || c.PostForm("dry_run") == "true"
+
+	userID, _ := currentUserID(c)
+
+	// Stock given in the file is the stock at the user's store
+	locationID, err := operatingLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	db := database.GetDB()
+	plans, results, newCategories, err := planProductImport(db, columns, records[1:], locationID)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to check import", err)
+		return
+	}
+
+	report := gin.H{
+		"dry_run":            dryRun,
+		"location_id":        locationID,
+		"rows":               results,
+		"categories_created": newCategories,
+	}
+	created, updated, failed := 0, 0, 0
+	for _, result := range results {
+		switch result.Action {
+		case importActionCreate:
+			created++
+		case importActionUpdate:
+			updated++
+		default:
+			failed++
+		}
+	}
+	report["created"] = created
+	report["updated"] = updated
+	report["failed"] = failed
+
+	// Nothing is written unless every row is valid
+	if failed > 0 {
+		c.JSON(http.StatusUnprocessableEntity, utils.Response{
+			Success: false,
+			Message: fmt.Sprintf("%d of %d rows have errors; nothing was imported", failed, len(results)),
+			Error:   "Validation failed",
+			Data:    report,
+		})
+		return
+	}
+
+	if dryRun {
+		utils.SuccessResponse(c, "Import checked successfully", report)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return applyProductImport(tx, plans, locationID, userID)
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to import products", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Products imported successfully", report)
+}
+
+// Export products as CSV or XLSX with the same columns the import takes
+func ExportProducts(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		utils.ErrorResponse(c, fmt.Sprintf("Invalid format %q: must be csv or xlsx", format), nil)
+		return
+	}
+
+	// Stock is exported for the same location an import would write to
+	locationID, err := operatingLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	db := database.GetDB()
+	var products []models.Product
+	if err := db.Order("id").Find(&products).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch products", err)
+		return
+	}
+	fillLocationStock(products, locationID)
+
+	// Categories are written as their full path, as the import reads them
+	_, categoryNames, err := categoryNamePaths(db)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to fetch categories", err)
+		return
+	}
+
+	records := [][]string{productColumns}
+	for _, product := range products {
+		sku, code := "", ""
+		if product.SKU != nil {
+			sku = *product.SKU
+		}
+		if product.Barcode != nil {
+			code = *product.Barcode
+		}
+		stock := product.Stock
+		if product.LocationStock != nil {
+			stock = *product.LocationStock
+		}
+		records = append(records, []string{
+			sku,
+			code,
+			product.Name,
+			product.Description,
+			categoryNames[product.CategoryID],
+			strconv.FormatFloat(product.Price, 'f', -1, 64),
+			strconv.FormatFloat(product.Cost, 'f', -1, 64),
+			strconv.Itoa(stock),
+			strconv.Itoa(product.MinStock),
+			strconv.Itoa(product.ReorderPoint),
+			strconv.Itoa(product.MaxStock),
+			strconv.FormatBool(product.IsActive),
+		})
+	}
+
+	var buf bytes.Buffer
+	contentType := "text/csv"
+	if format == "xlsx" {
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+		err = writeXLSX(&buf, records)
+	} else {
+		err = writeCSV(&buf, records)
+	}
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to export products", err)
+		return
+	}
+
+	filename := fmt.Sprintf("products-%s.%s", time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// readSpreadsheet reads every row of a CSV file, or of the first sheet of an
+// XLSX file, chosen by the file extension
+func readSpreadsheet(r io.Reader, filename string) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		return reader.ReadAll()
+	case ".xlsx":
+		workbook, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer workbook.Close()
+		return workbook.GetRows(workbook.GetSheetName(0))
+	default:
+		return nil, fmt.Errorf("unsupported file type %q: must be .csv or .xlsx", filepath.Ext(filename))
+	}
+}
+
+func writeCSV(w io.Writer, records [][]string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func writeXLSX(w io.Writer, records [][]string) error {
+	workbook := excelize.NewFile()
+	defer workbook.Close()
+
+	sheet := workbook.GetSheetName(0)
+	for i, record := range records {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		row := make([]interface{}, len(record))
+		for j, value := range record {
+			row[j] = value
+		}
+		if err := workbook.SetSheetRow(sheet, cell, &row); err != nil {
+			return err
+		}
+	}
+	return workbook.Write(w)
+}
+
+// importColumns maps each known column in the header row to its index
+func importColumns(header []string) (map[string]int, error) {
+	known := make(map[string]bool, len(productColumns))
+	for _, column := range productColumns {
+		known[column] = true
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if _, dup := columns[name]; dup {
+			return nil, fmt.Errorf("column %q appears more than once", name)
+		}
+		columns[name] = i
+	}
+
+	if _, ok := columns["sku"]; !ok {
+		if _, ok := columns["barcode"]; !ok {
+			return nil, fmt.Errorf("a sku or barcode column is required to match products")
+		}
+	}
+	return columns, nil
+}
+
+// planProductImport checks every row against the database and the rest of
+// the file. It returns the plans for valid rows, a result for every row, and
+// the names of categories that will be created.
+func planProductImport(db *gorm.DB, columns map[string]int, records [][]string, locationID uint) ([]productImportPlan, []*ProductImportRow, []string, error) {
+	categoryIDs, _, err := categoryNamePaths(db)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// A bare name also matches a nested category when only one has it
+	var categories []models.Category
+	if err := db.Find(&categories).Error; err != nil {
+		return nil, nil, nil, err
+	}
+	byName := make(map[string][]uint)
+	for _, category := range categories {
+		key := strings.ToLower(category.Name)
+		byName[key] = append(byName[key], category.ID)
+	}
+
+	pendingCategories := make(map[string]bool)
+	newCategories := []string{}
+
+	seenSKUs := make(map[string]int)
+	seenBarcodes := make(map[string]int)
+
+	var plans []productImportPlan
+	results := make([]*ProductImportRow, 0, len(records))
+	for i, record := range records {
+		line := i + 2
+		if isBlankRecord(record) {
+			continue
+		}
+
+		value := func(column string) (string, bool) {
+			index, ok := columns[column]
+			if !ok || index >= len(record) {
+				return "", ok
+			}
+			return strings.TrimSpace(record[index]), true
+		}
+
+		result := &ProductImportRow{Row: line, Action: importActionError}
+		results = append(results, result)
+		fail := func(format string, args ...interface{}) {
+			result.Errors = append(result.Errors, fmt.Sprintf(format, args...))
+		}
+
+		sku, _ := value("sku")
+		barcode, _ := value("barcode")
+		result.SKU = sku
+		result.Barcode = barcode
+
+		if sku == "" && barcode == "" {
+			fail("sku or barcode is required")
+			continue
+		}
+		if len(sku) > 64 {
+			fail("sku must be at most 64 characters")
+		}
+		if sku != "" {
+			if first, dup := seenSKUs[sku]; dup {
+				fail("sku %s is also used on row %d", sku, first)
+			}
+			seenSKUs[sku] = line
+		}
+		if barcode != "" {
+			if err := checkImportBarcode(db, barcode); err != nil {
+				fail("%s", err)
+			}
+			if first, dup := seenBarcodes[barcode]; dup {
+				fail("barcode %s is also used on row %d", barcode, first)
+			}
+			seenBarcodes[barcode] = line
+		}
+
+		// Match an existing product by SKU first, then by barcode
+		var bySKU, byBarcode models.Product
+		foundBySKU := sku != "" && db.Where("sku = ?", sku).First(&bySKU).Error == nil
+		foundByBarcode := barcode != "" && db.Where("barcode = ?", barcode).First(&byBarcode).Error == nil
+		if foundBySKU && foundByBarcode && bySKU.ID != byBarcode.ID {
+			fail("barcode %s already belongs to another product", barcode)
+			continue
+		}
+
+		plan := productImportPlan{result: result}
+		isNew := false
+		switch {
+		case foundBySKU:
+			plan.product = bySKU
+			plan.oldPrice = bySKU.Price
+		case foundByBarcode:
+			plan.product = byBarcode
+			plan.oldPrice = byBarcode.Price
+		default:
+			isNew = true
+			plan.product = models.Product{IsActive: true, ReorderPoint: 10}
+		}
+
+		if sku != "" {
+			plan.product.SKU = optionalString(sku)
+		}
+		if barcode != "" {
+			plan.product.Barcode = optionalString(barcode)
+		}
+
+		if name, ok := value("name"); ok && name != "" {
+			plan.product.Name = name
+		} else if isNew {
+			fail("name is required")
+		}
+		result.Name = plan.product.Name
+
+		if description, ok := value("description"); ok {
+			plan.product.Description = description
+		}
+
+		// Categories are matched by name path ("Drinks > Soft drinks");
+		// missing ones are created once and shared by every row naming them
+		if raw, ok := value("category"); ok && len(splitCategoryPath(raw)) > 0 {
+			names := splitCategoryPath(raw)
+			key := strings.ToLower(strings.Join(names, categoryPathSeparator))
+			if id, exists := categoryIDs[key]; exists {
+				plan.product.CategoryID = id
+			} else if ids := byName[key]; len(names) == 1 && len(ids) == 1 {
+				plan.product.CategoryID = ids[0]
+			} else {
+				plan.category = names
+				if !pendingCategories[key] {
+					pendingCategories[key] = true
+					newCategories = append(newCategories, strings.Join(names, categoryPathSeparator))
+				}
+			}
+		} else if ok || isNew {
+			fail("category is required")
+		}
+
+		if raw, ok := value("price"); ok && raw != "" {
+			price, err := strconv.ParseFloat(raw, 64)
+			if err != nil || price <= 0 {
+				fail("price must be a number greater than 0")
+			}
+			plan.product.Price = price
+		} else if isNew {
+			fail("price is required")
+		}
+
+		if raw, ok := value("cost"); ok && raw != "" {
+			cost, err := strconv.ParseFloat(raw, 64)
+			if err != nil || cost < 0 {
+				fail("cost must be a number of at least 0")
+			}
+			plan.product.Cost = cost
+			plan.costSet = true
+		}
+
+		quantity := func(column string, target *int) {
+			raw, ok := value(column)
+			if !ok || raw == "" {
+				return
+			}
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				fail("%s must be a whole number of at least 0", column)
+				return
+			}
+			*target = n
+		}
+		quantity("min_stock", &plan.product.MinStock)
+		quantity("reorder_point", &plan.product.ReorderPoint)
+		quantity("max_stock", &plan.product.MaxStock)
+		if raw, ok := value("stock"); ok && raw != "" {
+			var stock int
+			quantity("stock", &stock)
+			plan.stock = &stock
+
+			// A re-imported export carries the same stock and is let through
+			if plan.product.TrackSerials {
+				onHand, err := inventory.StockAt(db, plan.product.ID, locationID)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				if stock != onHand {
+					fail("stock of a serial-tracked product changes through its serial numbers")
+				}
+			}
+		}
+
+		if plan.product.ReorderPoint < plan.product.MinStock {
+			fail("reorder_point cannot be below min_stock")
+		}
+		if plan.product.MaxStock != 0 && plan.product.MaxStock < plan.product.ReorderPoint {
+			fail("max_stock cannot be below reorder_point")
+		}
+
+		if raw, ok := value("is_active"); ok && raw != "" {
+			active, err := parseImportBool(raw)
+			if err != nil {
+				fail("is_active must be true or false")
+			}
+			plan.product.IsActive = active
+		}
+
+		if len(result.Errors) > 0 {
+			continue
+		}
+
+		if isNew {
+			result.Action = importActionCreate
+		} else {
+			result.Action = importActionUpdate
+			result.ProductID = plan.product.ID
+		}
+		plans = append(plans, plan)
+	}
+
+	return plans, results, newCategories, nil
+}
+
+// applyProductImport writes the planned rows, creating missing categories
+// and booking stock changes through the stock ledger
+func applyProductImport(tx *gorm.DB, plans []productImportPlan, locationID, userID uint) error {
+	categoryIDs, _, err := categoryNamePaths(tx)
+	if err != nil {
+		return err
+	}
+
+	for i := range plans {
+		plan := &plans[i]
+
+		if len(plan.category) > 0 {
+			id, err := ensureCategoryPath(tx, plan.category, categoryIDs)
+			if err != nil {
+				return fmt.Errorf("row %d: %w", plan.result.Row, err)
+			}
+			plan.product.CategoryID = id
+		}
+
+		isNew := plan.product.ID == 0
+		if isNew {
+			if err := createProduct(tx, &plan.product); err != nil {
+				return fmt.Errorf("row %d: %w", plan.result.Row, err)
+			}
+			plan.result.ProductID = plan.product.ID
+		} else {
+			omit := []string{"stock"}
+			if !plan.costSet {
+				omit = append(omit, "cost")
+			}
+			if err := tx.Omit(omit...).Save(&plan.product).Error; err != nil {
+				return fmt.Errorf("row %d: %w", plan.result.Row, err)
+			}
+			if err := pricing.RecordPrice(tx, plan.product.ID, plan.oldPrice, pricing.PriceUpdate{
+				Price:  plan.product.Price,
+				Source: models.PriceSourceImport,
+				UserID: userID,
+			}); err != nil {
+				return fmt.Errorf("row %d: %w", plan.result.Row, err)
+			}
+		}
+
+		if plan.stock == nil {
+			continue
+		}
+
+		movement := inventory.Movement{
+			ProductID:     plan.product.ID,
+			LocationID:    locationID,
+			ReferenceType: "product_import",
+			ReferenceID:   plan.product.ID,
+			UserID:        userID,
+		}
+		if isNew {
+			movement.Type = models.MovementOpening
+			movement.Quantity = *plan.stock
+			movement.LotNumber = "OPENING"
+		} else {
+			onHand, err := inventory.StockAt(tx, plan.product.ID, locationID)
+			if err != nil {
+				return fmt.Errorf("row %d: %w", plan.result.Row, err)
+			}
+			movement.Type = models.MovementAdjustment
+			movement.Quantity = *plan.stock - onHand
+			movement.Note = "Stock set by product import"
+			movement.IncludeExpired = true
+		}
+		if movement.Quantity == 0 {
+			continue
+		}
+		if _, err := inventory.Move(tx, movement); err != nil {
+			return fmt.Errorf("row %d: %w", plan.result.Row, err)
+		}
+	}
+	return nil
+}
+
+// checkImportBarcode validates the check digit of a barcode in the same way
+// as CreateProduct, except for one already on file, which is kept as it is.
+// Barcodes are matched on products, so one that is another product's extra
+// barcode is refused.
+func checkImportBarcode(db *gorm.DB, code string) error {
+	var extra int64
+	db.Model(&models.ProductBarcode{}).Where("barcode = ?", code).Count(&extra)
+	if extra > 0 {
+		return fmt.Errorf("barcode %s is a variant or unit barcode", code)
+	}
+
+	if err := barcode.Validate(code); err != nil {
+		var existing int64
+		db.Model(&models.Product{}).Where("barcode = ?", code).Count(&existing)
+		if existing == 0 {
+			return fmt.Errorf("barcode %s: %w", code, err)
+		}
+	}
+	return nil
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func parseImportBool(raw string) (bool, error) {
+	switch strings.ToLower(raw) {
+	case "true", "yes", "y", "1":
+		return true, nil
+	case "false", "no", "n", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", raw)
+}
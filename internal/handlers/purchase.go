@@ -0,0 +1,626 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/inventory"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PurchaseOrderItemRequest struct {
+	ProductID uint    `json:"product_id" validate:"required"`
+	Quantity  int     `json:"quantity" validate:"required,gt=0"`
+	UnitCost  float64 `json:"unit_cost" validate:"gte=0"`
+}
+
+type PurchaseOrderRequest struct {
+	SupplierID uint                       `json:"supplier_id" validate:"required"`
+	LocationID uint                       `json:"location_id"` // deliver to; defaults to the user's store
+	Notes      string                     `json:"notes"`
+	ExpectedAt *time.Time                 `json:"expected_at"`
+	Items      []PurchaseOrderItemRequest `json:"items" validate:"required,min=1,dive"`
+}
+
+type GoodsReceiptItemRequest struct {
+	PurchaseOrderItemID uint       `json:"purchase_order_item_id"`
+	ProductID           uint       `json:"product_id"`
+	Quantity            int        `json:"quantity" validate:"required,gt=0"`
+	UnitCost            *float64   `json:"unit_cost" validate:"omitempty,gte=0"`
+	LotNumber           string     `json:"lot_number"`
+	ExpiryDate          *time.Time `json:"expiry_date"`
+	// Serials must list every unit received for serial-tracked products
+	Serials []string `json:"serials"`
+}
+
+type GoodsReceiptRequest struct {
+	PurchaseOrderID uint    `json:"purchase_order_id"`
+	SupplierID      uint    `json:"supplier_id"`
+	LocationID      uint    `json:"location_id"` // defaults to the PO's or the user's location
+	SupplierRef     string  `json:"supplier_ref"`
+	AdditionalCost  float64 `json:"additional_cost" validate:"gte=0"`
+	Notes           string  `json:"notes"`
+	// AllowOverDelivery accepts more than is outstanding on a PO line.
+	AllowOverDelivery bool `json:"allow_over_delivery"`
+	// CloseShort closes the purchase order even if lines are under-delivered.
+	CloseShort bool                      `json:"close_short"`
+	Items      []GoodsReceiptItemRequest `json:"items" validate:"required,min=1,dive"`
+}
+
+// Generate document number with the given prefix
+func generateDocumentNo(prefix string) string {
+	now := time.Now()
+	return fmt.Sprintf("%s-%s-%d", prefix, now.Format("20060102"), now.UnixMilli())
+}
+
+// Get all purchase orders
+func GetPurchaseOrders(c *gin.Context) {
+	db := database.GetDB()
+	var orders []models.PurchaseOrder
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	query := db.Preload("Supplier")
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if supplierID := c.Query("supplier_id"); supplierID != "" {
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+
+	var total int64
+	query.Model(&models.PurchaseOrder{}).Count(&total)
+
+	offset := (page - 1) * limit
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&orders).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch purchase orders", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Purchase orders fetched successfully", gin.H{
+		"purchase_orders": orders,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// Get single purchase order
+func GetPurchaseOrder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid purchase order ID", err)
+		return
+	}
+
+	var order models.PurchaseOrder
+	if err := database.GetDB().Preload("Supplier").Preload("Items.Product").First(&order, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Purchase order not found")
+		return
+	}
+
+	utils.SuccessResponse(c, "Purchase order fetched successfully", order)
+}
+
+// Create purchase order (as draft)
+func CreatePurchaseOrder(c *gin.Context) {
+	var req PurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, "User not authenticated", nil)
+		return
+	}
+
+	db := database.GetDB()
+	items, err := buildPurchaseOrderItems(db, req)
+	if err != nil {
+		utils.ErrorResponse(c, err.Error(), nil)
+		return
+	}
+
+	locationID, err := purchaseLocationID(c, req.LocationID)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	order := models.PurchaseOrder{
+		PONumber:   generateDocumentNo("PO"),
+		SupplierID: req.SupplierID,
+		LocationID: locationID,
+		UserID:     userID,
+		Status:     models.POStatusDraft,
+		Notes:      req.Notes,
+		ExpectedAt: req.ExpectedAt,
+		Items:      items,
+	}
+
+	if err := db.Create(&order).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to create purchase order", err)
+		return
+	}
+
+	db.Preload("Supplier").Preload("Items.Product").First(&order, order.ID)
+
+	utils.SuccessResponse(c, "Purchase order created successfully", order)
+}
+
+// Update purchase order (draft only)
+func UpdatePurchaseOrder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid purchase order ID", err)
+		return
+	}
+
+	var req PurchaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	var order models.PurchaseOrder
+	if err := db.First(&order, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Purchase order not found")
+		return
+	}
+
+	if order.Status != models.POStatusDraft {
+		utils.ErrorResponse(c, "Only draft purchase orders can be edited", nil)
+		return
+	}
+
+	items, err := buildPurchaseOrderItems(db, req)
+	if err != nil {
+		utils.ErrorResponse(c, err.Error(), nil)
+		return
+	}
+
+	locationID, err := purchaseLocationID(c, req.LocationID)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("purchase_order_id = ?", order.ID).Delete(&models.PurchaseOrderItem{}).Error; err != nil {
+			return err
+		}
+
+		order.SupplierID = req.SupplierID
+		order.LocationID = locationID
+		order.Notes = req.Notes
+		order.ExpectedAt = req.ExpectedAt
+		order.Items = items
+		return tx.Save(&order).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to update purchase order", err)
+		return
+	}
+
+	db.Preload("Supplier").Preload("Items.Product").First(&order, order.ID)
+
+	utils.SuccessResponse(c, "Purchase order updated successfully", order)
+}
+
+// Mark a draft purchase order as sent to the supplier
+func OrderPurchaseOrder(c *gin.Context) {
+	changePurchaseOrderStatus(c, []string{models.POStatusDraft}, models.POStatusOrdered, "Purchase order placed successfully")
+}
+
+// Cancel a purchase order that has not received anything yet
+func CancelPurchaseOrder(c *gin.Context) {
+	changePurchaseOrderStatus(c, []string{models.POStatusDraft, models.POStatusOrdered}, models.POStatusCancelled, "Purchase order cancelled successfully")
+}
+
+// Close a partially received purchase order, accepting the shortfall
+func ClosePurchaseOrder(c *gin.Context) {
+	changePurchaseOrderStatus(c, []string{models.POStatusPartial}, models.POStatusClosed, "Purchase order closed successfully")
+}
+
+func changePurchaseOrderStatus(c *gin.Context, from []string, to string, message string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid purchase order ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var order models.PurchaseOrder
+	if err := db.First(&order, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Purchase order not found")
+		return
+	}
+
+	allowed := false
+	for _, status := range from {
+		if order.Status == status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		utils.ErrorResponse(c, fmt.Sprintf("Cannot change purchase order from %s to %s", order.Status, to), nil)
+		return
+	}
+
+	updates := map[string]interface{}{"status": to}
+	if to == models.POStatusOrdered {
+		updates["ordered_at"] = time.Now()
+	}
+
+	if err := db.Model(&order).Updates(updates).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to update purchase order", err)
+		return
+	}
+
+	db.Preload("Supplier").Preload("Items.Product").First(&order, order.ID)
+
+	utils.SuccessResponse(c, message, order)
+}
+
+// purchaseLocationID returns the location stock is bought for: the one
+// requested, or the user's store
+func purchaseLocationID(c *gin.Context, requested uint) (uint, error) {
+	if requested == 0 {
+		return operatingLocationID(c)
+	}
+
+	var location models.Location
+	if err := database.GetDB().First(&location, requested).Error; err != nil {
+		return 0, fmt.Errorf("location not found")
+	}
+	return location.ID, nil
+}
+
+func buildPurchaseOrderItems(db *gorm.DB, req PurchaseOrderRequest) ([]models.PurchaseOrderItem, error) {
+	var supplier models.Supplier
+	if err := db.First(&supplier, req.SupplierID).Error; err != nil {
+		return nil, fmt.Errorf("Supplier not found")
+	}
+
+	var items []models.PurchaseOrderItem
+	for _, item := range req.Items {
+		var product models.Product
+		if err := db.First(&product, item.ProductID).Error; err != nil {
+			return nil, fmt.Errorf("Product with ID %d not found", item.ProductID)
+		}
+
+		items = append(items, models.PurchaseOrderItem{
+			ProductID:       item.ProductID,
+			QuantityOrdered: item.Quantity,
+			UnitCost:        item.UnitCost,
+		})
+	}
+
+	return items, nil
+}
+
+// Get all goods receipts
+func GetGoodsReceipts(c *gin.Context) {
+	db := database.GetDB()
+	var receipts []models.GoodsReceipt
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	query := db.Preload("Supplier")
+
+	if poID := c.Query("purchase_order_id"); poID != "" {
+		query = query.Where("purchase_order_id = ?", poID)
+	}
+
+	if supplierID := c.Query("supplier_id"); supplierID != "" {
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+
+	var total int64
+	query.Model(&models.GoodsReceipt{}).Count(&total)
+
+	offset := (page - 1) * limit
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&receipts).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch goods receipts", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Goods receipts fetched successfully", gin.H{
+		"goods_receipts": receipts,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// Get single goods receipt
+func GetGoodsReceipt(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid goods receipt ID", err)
+		return
+	}
+
+	var receipt models.GoodsReceipt
+	if err := database.GetDB().Preload("Supplier").Preload("Items.Product").Preload("Items.Serials").First(&receipt, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Goods receipt not found")
+		return
+	}
+
+	utils.SuccessResponse(c, "Goods receipt fetched successfully", receipt)
+}
+
+// Create goods receipt, optionally against a purchase order
+func CreateGoodsReceipt(c *gin.Context) {
+	var req GoodsReceiptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, "User not authenticated", nil)
+		return
+	}
+
+	db := database.GetDB()
+	var receipt models.GoodsReceipt
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var order *models.PurchaseOrder
+		if req.PurchaseOrderID != 0 {
+			order = &models.PurchaseOrder{}
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(order, req.PurchaseOrderID).Error; err != nil {
+				return fmt.Errorf("Purchase order not found")
+			}
+			if order.Status != models.POStatusOrdered && order.Status != models.POStatusPartial {
+				return fmt.Errorf("Cannot receive against a %s purchase order", order.Status)
+			}
+			req.SupplierID = order.SupplierID
+			if req.LocationID == 0 {
+				req.LocationID = order.LocationID
+			}
+		} else if req.SupplierID == 0 {
+			return fmt.Errorf("Supplier ID is required when not receiving against a purchase order")
+		} else if err := tx.First(&models.Supplier{}, req.SupplierID).Error; err != nil {
+			return fmt.Errorf("Supplier not found")
+		}
+
+		locationID, err := purchaseLocationID(c, req.LocationID)
+		if err != nil {
+			return err
+		}
+
+		items, poLines, err := buildReceiptItems(order, req)
+		if err != nil {
+			return err
+		}
+		allocateLandedCost(items, req.AdditionalCost)
+
+		receipt = models.GoodsReceipt{
+			ReceiptNo:      generateDocumentNo("GR"),
+			SupplierID:     req.SupplierID,
+			LocationID:     locationID,
+			UserID:         userID,
+			SupplierRef:    req.SupplierRef,
+			AdditionalCost: req.AdditionalCost,
+			Notes:          req.Notes,
+			Items:          items,
+		}
+		if order != nil {
+			receipt.PurchaseOrderID = &order.ID
+		}
+
+		if err := tx.Create(&receipt).Error; err != nil {
+			return err
+		}
+
+		for i, item := range receipt.Items {
+			lotNumber := item.LotNumber
+			if lotNumber == "" {
+				lotNumber = receipt.ReceiptNo
+			}
+
+			itemID := item.ID
+			if _, err := inventory.Receive(tx, inventory.Movement{
+				ProductID:          item.ProductID,
+				LocationID:         locationID,
+				Type:               models.MovementReceipt,
+				Quantity:           item.Quantity,
+				UnitCost:           item.LandedUnitCost,
+				ReferenceType:      "goods_receipt",
+				ReferenceID:        receipt.ID,
+				UserID:             userID,
+				LotNumber:          lotNumber,
+				ExpiryDate:         item.ExpiryDate,
+				GoodsReceiptItemID: &itemID,
+			}); err != nil {
+				return err
+			}
+
+			if err := receiveSerials(tx, item, locationID, req.Items[i].Serials); err != nil {
+				return err
+			}
+		}
+
+		if order == nil {
+			return nil
+		}
+
+		for _, line := range poLines {
+			if err := tx.Model(line).UpdateColumn("quantity_received", line.QuantityReceived).Error; err != nil {
+				return err
+			}
+		}
+
+		status := models.POStatusReceived
+		for _, line := range order.Items {
+			if line.Outstanding() > 0 {
+				status = models.POStatusPartial
+				if req.CloseShort {
+					status = models.POStatusClosed
+				}
+				break
+			}
+		}
+		return tx.Model(order).Update("status", status).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to create goods receipt", err)
+		return
+	}
+
+	db.Preload("Supplier").Preload("Items.Product").First(&receipt, receipt.ID)
+
+	utils.SuccessResponse(c, "Goods receipt created successfully", receipt)
+}
+
+// receiveSerials registers the serials received on a line of a
+// serial-tracked product
+func receiveSerials(tx *gorm.DB, item models.GoodsReceiptItem, locationID uint, serials []string) error {
+	var product models.Product
+	if err := tx.First(&product, item.ProductID).Error; err != nil {
+		return err
+	}
+
+	if !product.TrackSerials {
+		if len(serials) > 0 {
+			return fmt.Errorf("Product %s does not track serial numbers", product.Name)
+		}
+		return nil
+	}
+
+	if err := inventory.CheckSerials(serials, item.Quantity); err != nil {
+		return fmt.Errorf("Product %s: %w", product.Name, err)
+	}
+
+	itemID := item.ID
+	_, err := inventory.RegisterSerials(tx, product.ID, locationID, serials, &itemID)
+	return err
+}
+
+// buildReceiptItems matches receipt lines to purchase order lines, checks
+// for over-delivery and returns the PO lines whose received quantity changed.
+func buildReceiptItems(order *models.PurchaseOrder, req GoodsReceiptRequest) ([]models.GoodsReceiptItem, []*models.PurchaseOrderItem, error) {
+	var items []models.GoodsReceiptItem
+	var touched []*models.PurchaseOrderItem
+
+	for _, item := range req.Items {
+		if order == nil {
+			if item.ProductID == 0 || item.UnitCost == nil {
+				return nil, nil, fmt.Errorf("Product ID and unit cost are required for each line")
+			}
+			items = append(items, models.GoodsReceiptItem{
+				ProductID:  item.ProductID,
+				Quantity:   item.Quantity,
+				UnitCost:   *item.UnitCost,
+				LotNumber:  item.LotNumber,
+				ExpiryDate: item.ExpiryDate,
+			})
+			continue
+		}
+
+		var line *models.PurchaseOrderItem
+		for i := range order.Items {
+			candidate := &order.Items[i]
+			if (item.PurchaseOrderItemID != 0 && candidate.ID == item.PurchaseOrderItemID) ||
+				(item.PurchaseOrderItemID == 0 && candidate.ProductID == item.ProductID) {
+				line = candidate
+				break
+			}
+		}
+		if line == nil {
+			return nil, nil, fmt.Errorf("Line for product %d is not on purchase order %s", item.ProductID, order.PONumber)
+		}
+
+		expected := line.Outstanding()
+		if item.Quantity > expected && !req.AllowOverDelivery {
+			return nil, nil, fmt.Errorf("Over-delivery on product %d: %d outstanding, %d received", line.ProductID, expected, item.Quantity)
+		}
+
+		unitCost := line.UnitCost
+		if item.UnitCost != nil {
+			unitCost = *item.UnitCost
+		}
+
+		line.QuantityReceived += item.Quantity
+		touched = append(touched, line)
+
+		lineID := line.ID
+		items = append(items, models.GoodsReceiptItem{
+			PurchaseOrderItemID: &lineID,
+			ProductID:           line.ProductID,
+			Quantity:            item.Quantity,
+			QuantityExpected:    expected,
+			Variance:            item.Quantity - expected,
+			UnitCost:            unitCost,
+			LotNumber:           item.LotNumber,
+			ExpiryDate:          item.ExpiryDate,
+		})
+	}
+
+	return items, touched, nil
+}
+
+// allocateLandedCost spreads additional costs (freight, duties) across the
+// receipt lines by value, or by quantity when every line is free of charge.
+func allocateLandedCost(items []models.GoodsReceiptItem, additional float64) {
+	var totalValue float64
+	var totalQty int
+	for _, item := range items {
+		totalValue += item.UnitCost * float64(item.Quantity)
+		totalQty += item.Quantity
+	}
+
+	for i := range items {
+		item := &items[i]
+		item.LandedUnitCost = item.UnitCost
+		if additional == 0 {
+			continue
+		}
+
+		var share float64
+		if totalValue > 0 {
+			share = additional * (item.UnitCost * float64(item.Quantity)) / totalValue
+		} else {
+			share = additional * float64(item.Quantity) / float64(totalQty)
+		}
+		item.LandedUnitCost += share / float64(item.Quantity)
+	}
+}
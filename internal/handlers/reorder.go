@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Lead time assumed for products without a preferred supplier
+const defaultLeadTimeDays = 7
+
+type ReorderSuggestion struct {
+	ProductID         uint    `json:"product_id"`
+	ProductName       string  `json:"product_name"`
+	Barcode           *string `json:"barcode"`
+	SupplierID        *uint   `json:"supplier_id"`
+	SupplierName      string  `json:"supplier_name"`
+	Stock             int     `json:"stock"`
+	OnOrder           int     `json:"on_order"`
+	DailySales        float64 `json:"daily_sales"` // average units sold per day over the period
+	LeadTimeDays      int     `json:"lead_time_days"`
+	MinStock          int     `json:"min_stock"`
+	ReorderPoint      int     `json:"reorder_point"`
+	MaxStock          int     `json:"max_stock"`
+	TriggerLevel      int     `json:"trigger_level"` // stock + on order at or below this triggers an order
+	SuggestedQuantity int     `json:"suggested_quantity"`
+	UnitCost          float64 `json:"unit_cost"`
+}
+
+type ReorderOrderRequest struct {
+	LocationID uint       `json:"location_id"`
+	Days       int        `json:"days" validate:"omitempty,gt=0"`
+	ProductIDs []uint     `json:"product_ids"` // only these products; all suggestions when empty
+	ExpectedAt *time.Time `json:"expected_at"`
+	Notes      string     `json:"notes"`
+}
+
+// buildReorderSuggestions works out which active products need ordering at
+// the location (zero for the whole company). A product is suggested when its
+// stock plus what is already on order has fallen to the larger of its reorder
+// point and its minimum stock plus the demand expected over the supplier's
+// lead time, based on sales over the last days. The suggested quantity tops
+// it up to its maximum stock, or to the trigger level plus another period of
+// demand when no maximum is set.
+func buildReorderSuggestions(db *gorm.DB, locationID uint, days int) ([]ReorderSuggestion, error) {
+	since := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
+
+	type quantityRow struct {
+		ProductID uint
+		Quantity  int
+	}
+
+	var sold []quantityRow
+	if err := completedSalesLines(db, locationID, since, "").
+		Select("transaction_items.product_id, SUM(transaction_items.quantity) as quantity").
+		Group("transaction_items.product_id").
+		Scan(&sold).Error; err != nil {
+		return nil, err
+	}
+	soldByProduct := make(map[uint]int, len(sold))
+	for _, row := range sold {
+		soldByProduct[row.ProductID] = row.Quantity
+	}
+
+	onOrderQuery := db.Table("purchase_order_items").
+		Joins("JOIN purchase_orders ON purchase_order_items.purchase_order_id = purchase_orders.id").
+		Where("purchase_orders.status IN ?", []string{models.POStatusDraft, models.POStatusOrdered, models.POStatusPartial})
+	if locationID != 0 {
+		onOrderQuery = onOrderQuery.Where("purchase_orders.location_id = ?", locationID)
+	}
+	var onOrder []quantityRow
+	if err := onOrderQuery.
+		Select("purchase_order_items.product_id, SUM(GREATEST(purchase_order_items.quantity_ordered - purchase_order_items.quantity_received, 0)) as quantity").
+		Group("purchase_order_items.product_id").
+		Scan(&onOrder).Error; err != nil {
+		return nil, err
+	}
+	onOrderByProduct := make(map[uint]int, len(onOrder))
+	for _, row := range onOrder {
+		onOrderByProduct[row.ProductID] = row.Quantity
+	}
+
+	var products []models.Product
+	if err := db.Preload("Supplier").Where("is_active = ?", true).Order("name").Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	var stockByProduct map[uint]int
+	if locationID != 0 {
+		var levels []models.StockLevel
+		if err := db.Where("location_id = ?", locationID).Find(&levels).Error; err != nil {
+			return nil, err
+		}
+		stockByProduct = make(map[uint]int, len(levels))
+		for _, level := range levels {
+			stockByProduct[level.ProductID] = level.Quantity
+		}
+	}
+
+	suggestions := []ReorderSuggestion{}
+	for _, product := range products {
+		stock := product.Stock
+		if stockByProduct != nil {
+			stock = stockByProduct[product.ID]
+		}
+
+		leadTime := defaultLeadTimeDays
+		supplierName := ""
+		if product.Supplier != nil {
+			leadTime = product.Supplier.LeadTimeDays
+			supplierName = product.Supplier.Name
+		}
+
+		dailySales := float64(soldByProduct[product.ID]) / float64(days)
+		leadDemand := int(math.Ceil(dailySales * float64(leadTime)))
+
+		trigger := product.ReorderPoint
+		if product.MinStock+leadDemand > trigger {
+			trigger = product.MinStock + leadDemand
+		}
+
+		position := stock + onOrderByProduct[product.ID]
+		if position > trigger {
+			continue
+		}
+
+		target := product.MaxStock
+		if target == 0 {
+			target = trigger + int(math.Ceil(dailySales*float64(days)))
+		}
+		quantity := target - position
+		if quantity <= 0 {
+			continue
+		}
+
+		suggestions = append(suggestions, ReorderSuggestion{
+			ProductID:         product.ID,
+			ProductName:       product.Name,
+			Barcode:           product.Barcode,
+			SupplierID:        product.SupplierID,
+			SupplierName:      supplierName,
+			Stock:             stock,
+			OnOrder:           onOrderByProduct[product.ID],
+			DailySales:        math.Round(dailySales*100) / 100,
+			LeadTimeDays:      leadTime,
+			MinStock:          product.MinStock,
+			ReorderPoint:      product.ReorderPoint,
+			MaxStock:          product.MaxStock,
+			TriggerLevel:      trigger,
+			SuggestedQuantity: quantity,
+			UnitCost:          product.Cost,
+		})
+	}
+
+	return suggestions, nil
+}
+
+// Get products that should be reordered, with suggested quantities
+func GetReorderSuggestions(c *gin.Context) {
+	locationID, err := scopedLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days <= 0 {
+		utils.ErrorResponse(c, "Invalid days: must be a positive number", nil)
+		return
+	}
+
+	suggestions, err := buildReorderSuggestions(database.GetDB(), locationID, days)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to build reorder suggestions", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Reorder suggestions fetched successfully", gin.H{
+		"location_id": locationID,
+		"days":        days,
+		"suggestions": suggestions,
+	})
+}
+
+// Create draft purchase orders from the reorder suggestions, one per supplier
+func CreatePurchaseOrdersFromSuggestions(c *gin.Context) {
+	var req ReorderOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if req.Days == 0 {
+		req.Days = 30
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, "User not authenticated", nil)
+		return
+	}
+
+	// Orders are delivered to one location, so suggestions are worked out there
+	locationID, err := purchaseLocationID(c, req.LocationID)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	db := database.GetDB()
+	suggestions, err := buildReorderSuggestions(db, locationID, req.Days)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to build reorder suggestions", err)
+		return
+	}
+
+	wanted := make(map[uint]bool, len(req.ProductIDs))
+	for _, id := range req.ProductIDs {
+		wanted[id] = true
+	}
+
+	// Group the suggested lines by preferred supplier, keeping the order in
+	// which suppliers first appear
+	itemsBySupplier := make(map[uint][]models.PurchaseOrderItem)
+	var supplierIDs []uint
+	skipped := []gin.H{}
+	for _, suggestion := range suggestions {
+		if len(wanted) > 0 && !wanted[suggestion.ProductID] {
+			continue
+		}
+		if suggestion.SupplierID == nil {
+			skipped = append(skipped, gin.H{
+				"product_id":   suggestion.ProductID,
+				"product_name": suggestion.ProductName,
+				"reason":       "no preferred supplier",
+			})
+			continue
+		}
+
+		supplierID := *suggestion.SupplierID
+		if _, seen := itemsBySupplier[supplierID]; !seen {
+			supplierIDs = append(supplierIDs, supplierID)
+		}
+		itemsBySupplier[supplierID] = append(itemsBySupplier[supplierID], models.PurchaseOrderItem{
+			ProductID:       suggestion.ProductID,
+			QuantityOrdered: suggestion.SuggestedQuantity,
+			UnitCost:        suggestion.UnitCost,
+		})
+	}
+
+	if len(supplierIDs) == 0 {
+		utils.ErrorResponse(c, "Nothing to order", nil)
+		return
+	}
+
+	orders := make([]models.PurchaseOrder, 0, len(supplierIDs))
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i, supplierID := range supplierIDs {
+			order := models.PurchaseOrder{
+				// Document numbers are per millisecond, so keep them apart
+				PONumber:   fmt.Sprintf("%s-%d", generateDocumentNo("PO"), i+1),
+				SupplierID: supplierID,
+				LocationID: locationID,
+				UserID:     userID,
+				Status:     models.POStatusDraft,
+				Notes:      req.Notes,
+				ExpectedAt: req.ExpectedAt,
+				Items:      itemsBySupplier[supplierID],
+			}
+			if err := tx.Create(&order).Error; err != nil {
+				return err
+			}
+			orders = append(orders, order)
+		}
+		return nil
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to create purchase orders", err)
+		return
+	}
+
+	for i := range orders {
+		db.Preload("Supplier").Preload("Items.Product").First(&orders[i], orders[i].ID)
+	}
+
+	utils.SuccessResponse(c, "Purchase orders created successfully", gin.H{
+		"purchase_orders": orders,
+		"skipped":         skipped,
+	})
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ProfitRow struct {
+	Key         string  `json:"key"`
+	Name        string  `json:"name"`
+	Quantity    int     `json:"quantity"`
+	Revenue     float64 `json:"revenue"`
+	Cost        float64 `json:"cost"`
+	GrossProfit float64 `json:"gross_profit"`
+	Margin      float64 `json:"margin"` // gross profit as a percentage of revenue
+}
+
+// SQL for line-level cost and profit, shared by reports and the dashboard
+const (
+	lineCostSQL   = "transaction_items.cost * transaction_items.quantity"
+	lineProfitSQL = "transaction_items.subtotal - transaction_items.cost * transaction_items.quantity"
+)
+
+// profitGroupings maps the group_by parameter to its key and label columns
+var profitGroupings = map[string][2]string{
+	"product":  {"products.id", "products.name"},
+	"category": {"COALESCE(categories.id, 0)", "COALESCE(categories.name, 'Uncategorized')"},
+	"day":      {"DATE(transactions.created_at)", "DATE(transactions.created_at)"},
+	"month":    {"DATE_FORMAT(transactions.created_at, '%Y-%m')", "DATE_FORMAT(transactions.created_at, '%Y-%m')"},
+}
+
+// calculateMargin returns gross profit as a percentage of revenue
+func calculateMargin(revenue, profit float64) float64 {
+	if revenue == 0 {
+		return 0
+	}
+	return profit / revenue * 100
+}
+
+// completedSalesLines returns a query over transaction items of completed
+// transactions, joined with their product and category, within the given
+// dates and at the given location (zero for every location).
+func completedSalesLines(db *gorm.DB, locationID uint, startDate, endDate string) *gorm.DB {
+	query := db.Table("transaction_items").
+		Joins("JOIN transactions ON transaction_items.transaction_id = transactions.id").
+		Joins("JOIN products ON transaction_items.product_id = products.id").
+		Joins("LEFT JOIN categories ON products.category_id = categories.id").
+		Where("transactions.status = ? AND transactions.deleted_at IS NULL", "completed")
+
+	if locationID != 0 {
+		query = query.Where("transactions.location_id = ?", locationID)
+	}
+
+	if startDate != "" {
+		query = query.Where("DATE(transactions.created_at) >= ?", startDate)
+	}
+
+	if endDate != "" {
+		query = query.Where("DATE(transactions.created_at) <= ?", endDate)
+	}
+
+	return query
+}
+
+// CategoryProfitRow is a category's figures including every category below
+// it, for the category_tree grouping
+type CategoryProfitRow struct {
+	ProfitRow
+	ParentKey string `json:"parent_key,omitempty"`
+	Path      string `json:"path"`
+	Depth     int    `json:"depth"`
+}
+
+// Get gross profit and margin grouped by product, category, day or month.
+// group_by=category_tree rolls each category up with its subcategories.
+func GetProfitReport(c *gin.Context) {
+	groupBy := c.DefaultQuery("group_by", "product")
+	grouping, ok := profitGroupings[groupBy]
+	if !ok && groupBy != "category_tree" {
+		utils.ErrorResponse(c, fmt.Sprintf("Invalid group_by %q: must be product, category, category_tree, day or month", groupBy), nil)
+		return
+	}
+	if groupBy == "category_tree" {
+		grouping = profitGroupings["category"]
+	}
+
+	locationID, err := scopedLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	now := time.Now()
+	startDate := c.DefaultQuery("start_date", time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).Format("2006-01-02"))
+	endDate := c.DefaultQuery("end_date", now.Format("2006-01-02"))
+
+	// tag limits the report to products carrying the tag
+	lines := completedSalesLines(database.GetDB(), locationID, startDate, endDate)
+	tag := c.Query("tag")
+	if tag != "" {
+		lines = lines.Where(productHasTagSQL, tag)
+	}
+
+	var rows []ProfitRow
+	err = lines.
+		Select(fmt.Sprintf("%s as `key`, %s as name, SUM(transaction_items.quantity) as quantity, "+
+			"SUM(transaction_items.subtotal) as revenue, SUM(%s) as cost, SUM(%s) as gross_profit",
+			grouping[0], grouping[1], lineCostSQL, lineProfitSQL)).
+		Group(fmt.Sprintf("%s, %s", grouping[0], grouping[1])).
+		Order("gross_profit DESC").
+		Scan(&rows).Error
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to build profit report", err)
+		return
+	}
+
+	var totals ProfitRow
+	totals.Key = "total"
+	for i := range rows {
+		rows[i].Margin = calculateMargin(rows[i].Revenue, rows[i].GrossProfit)
+		addProfit(&totals, rows[i])
+	}
+	totals.Margin = calculateMargin(totals.Revenue, totals.GrossProfit)
+
+	var result interface{} = rows
+	if groupBy == "category_tree" {
+		treeRows, err := rollUpCategoryProfit(database.GetDB(), rows)
+		if err != nil {
+			utils.ErrorResponse(c, "Failed to build profit report", err)
+			return
+		}
+		result = treeRows
+	}
+
+	utils.SuccessResponse(c, "Profit report fetched successfully", gin.H{
+		"group_by":    groupBy,
+		"location_id": locationID,
+		"start_date":  startDate,
+		"end_date":    endDate,
+		"tag":         tag,
+		"rows":        result,
+		"totals":      totals,
+	})
+}
+
+func addProfit(into *ProfitRow, row ProfitRow) {
+	into.Quantity += row.Quantity
+	into.Revenue += row.Revenue
+	into.Cost += row.Cost
+	into.GrossProfit += row.GrossProfit
+}
+
+// rollUpCategoryProfit adds each category's figures to every category above
+// it, returning one row per category with sales in its subtree, in tree
+// order. Uncategorized sales keep their own row.
+func rollUpCategoryProfit(db *gorm.DB, rows []ProfitRow) ([]CategoryProfitRow, error) {
+	var categories []models.Category
+	if err := db.Unscoped().Order("path").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]*CategoryProfitRow, len(categories))
+	for _, category := range categories {
+		key := strconv.FormatUint(uint64(category.ID), 10)
+		row := &CategoryProfitRow{
+			ProfitRow: ProfitRow{Key: key, Name: category.Name},
+			Path:      category.Path,
+			Depth:     category.Depth,
+		}
+		if category.ParentID != nil {
+			row.ParentKey = strconv.FormatUint(uint64(*category.ParentID), 10)
+		}
+		byKey[key] = row
+	}
+
+	var uncategorized *CategoryProfitRow
+	for _, row := range rows {
+		own, ok := byKey[row.Key]
+		if !ok {
+			uncategorized = &CategoryProfitRow{ProfitRow: row}
+			continue
+		}
+		for _, id := range strings.Split(strings.Trim(own.Path, "/"), "/") {
+			if ancestor, ok := byKey[id]; ok {
+				addProfit(&ancestor.ProfitRow, row)
+			}
+		}
+	}
+
+	var result []CategoryProfitRow
+	for _, category := range categories {
+		row := byKey[strconv.FormatUint(uint64(category.ID), 10)]
+		if row.Quantity == 0 && row.Revenue == 0 {
+			continue
+		}
+		row.Margin = calculateMargin(row.Revenue, row.GrossProfit)
+		result = append(result, *row)
+	}
+	if uncategorized != nil {
+		result = append(result, *uncategorized)
+	}
+	return result, nil
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"POS-Golang/internal/auth"
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Role names are stored on users and shown in tokens
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+type RoleRequest struct {
+	Name        string   `json:"name" validate:"required,max=50"` // lower case letters, digits, dashes and underscores
+	Description string   `json:"description" validate:"max=255"`
+	Permissions []string `json:"permissions"`
+	// RequireTwoFactor makes the role's users log in with a TOTP code too;
+	// left out, it stays as it is
+	RequireTwoFactor *bool `json:"require_two_factor"`
+}
+
+// Get every permission a role can be given
+func GetPermissions(c *gin.Context) {
+	utils.SuccessResponse(c, "Permissions fetched successfully", models.AllPermissions)
+}
+
+// Get all roles with the number of users that have each
+func GetRoles(c *gin.Context) {
+	db := database.GetDB()
+	var roles []models.Role
+	if err := db.Order("id").Find(&roles).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch roles", err)
+		return
+	}
+
+	var counts []struct {
+		Role  string
+		Count int64
+	}
+	if err := db.Model(&models.User{}).Select("role, COUNT(*) AS count").Group("role").Scan(&counts).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch roles", err)
+		return
+	}
+	for i := range roles {
+		for _, count := range counts {
+			if count.Role == roles[i].Name {
+				roles[i].UserCount = count.Count
+			}
+		}
+		showRolePermissions(&roles[i])
+	}
+
+	utils.SuccessResponse(c, "Roles fetched successfully", roles)
+}
+
+// Create a role
+func CreateRole(c *gin.Context) {
+	req, ok := bindRole(c)
+	if !ok {
+		return
+	}
+
+	// Otherwise a user could make a role with more than they have and give
+	// it to themselves
+	if !canGrantPermissions(c, req.Permissions) {
+		utils.ForbiddenResponse(c, "You cannot give a role permissions you do not have")
+		return
+	}
+
+	db := database.GetDB()
+	if roleExists(db, req.Name) {
+		utils.ErrorResponse(c, "Role name already exists", nil)
+		return
+	}
+
+	role := models.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+	}
+	if req.RequireTwoFactor != nil {
+		role.RequireTwoFactor = *req.RequireTwoFactor
+	}
+	if err := db.Create(&role).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to create role", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Role created successfully", role)
+}
+
+// Update a role. Renaming it moves its users along; built-in roles keep
+// their names and the admin role keeps every permission. Changes apply to
+// signed-in users on their next request.
+func UpdateRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid role ID", err)
+		return
+	}
+
+	req, ok := bindRole(c)
+	if !ok {
+		return
+	}
+
+	db := database.GetDB()
+	var role models.Role
+	if err := db.First(&role, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Role not found")
+		return
+	}
+
+	// Only admins change the admin role, their own role, or a role with
+	// permissions they do not have, and nobody adds permissions they lack
+	access, _ := signedInAccess(c)
+	if access.Role != models.RoleAdmin {
+		if role.Name == access.Role {
+			utils.ForbiddenResponse(c, "You cannot change your own role")
+			return
+		}
+		allowed, err := canGrantRole(c, db, role.Name)
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to check role", err)
+			return
+		}
+		if !allowed || !canGrantPermissions(c, req.Permissions) {
+			utils.ForbiddenResponse(c, "You cannot give a role permissions you do not have")
+			return
+		}
+	}
+
+	if req.Name != role.Name {
+		if role.IsSystem {
+			utils.ErrorResponse(c, "Built-in roles cannot be renamed", nil)
+			return
+		}
+		if roleExists(db, req.Name) {
+			utils.ErrorResponse(c, "Role name already exists", nil)
+			return
+		}
+	}
+
+	oldName := role.Name
+	role.Name = req.Name
+	role.Description = req.Description
+	if role.Name != models.RoleAdmin {
+		role.Permissions = req.Permissions
+	}
+	if req.RequireTwoFactor != nil {
+		role.RequireTwoFactor = *req.RequireTwoFactor
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+		if oldName == role.Name {
+			return nil
+		}
+		// Users in the trash move too, so restoring them keeps their role
+		return tx.Unscoped().Model(&models.User{}).Where("role = ?", oldName).
+			UpdateColumn("role", role.Name).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to update role", err)
+		return
+	}
+
+	showRolePermissions(&role)
+	utils.SuccessResponse(c, "Role updated successfully", role)
+}
+
+// Delete a role no user has
+func DeleteRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid role ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var role models.Role
+	if err := db.First(&role, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Role not found")
+		return
+	}
+
+	if role.IsSystem {
+		utils.ErrorResponse(c, "Built-in roles cannot be deleted", nil)
+		return
+	}
+
+	var users int64
+	db.Unscoped().Model(&models.User{}).Where("role = ?", role.Name).Count(&users)
+	if users > 0 {
+		c.JSON(http.StatusConflict, utils.Response{
+			Success: false,
+			Message: "Role is still in use and cannot be deleted",
+			Error:   fmt.Sprintf("%d users have this role, including any in the trash", users),
+		})
+		return
+	}
+
+	if err := db.Delete(&role).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to delete role", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Role deleted successfully", nil)
+}
+
+func bindRole(c *gin.Context) (RoleRequest, bool) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return req, false
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return req, false
+	}
+
+	req.Name = strings.ToLower(strings.TrimSpace(req.Name))
+	if !roleNamePattern.MatchString(req.Name) {
+		utils.ErrorResponse(c, "Role names may only contain letters, digits, dashes and underscores", nil)
+		return req, false
+	}
+
+	permissions := []string{}
+	seen := make(map[string]bool, len(req.Permissions))
+	for _, permission := range req.Permissions {
+		if !models.ValidPermission(permission) {
+			utils.ErrorResponse(c, fmt.Sprintf("Unknown permission %s", permission), nil)
+			return req, false
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			permissions = append(permissions, permission)
+		}
+	}
+	req.Permissions = permissions
+	return req, true
+}
+
+// roleExists reports whether a role with the name exists
+func roleExists(db *gorm.DB, name string) bool {
+	var count int64
+	db.Model(&models.Role{}).Where("name = ?", name).Count(&count)
+	return count > 0
+}
+
+// canGrantRole reports whether the signed-in user may give someone a role.
+// Only admins hand out roles with permissions they do not have themselves.
+func canGrantRole(c *gin.Context, db *gorm.DB, role string) (bool, error) {
+	access, ok := signedInAccess(c)
+	if !ok {
+		return false, nil
+	}
+	if access.Role == models.RoleAdmin {
+		return true, nil
+	}
+	if role == models.RoleAdmin {
+		return false, nil
+	}
+
+	permissions, err := auth.RolePermissions(db, role)
+	if err != nil {
+		return false, err
+	}
+	return canGrantPermissions(c, permissions), nil
+}
+
+// canGrantPermissions reports whether the signed-in user may put the
+// permissions on a role: admins may give any, others only ones they have
+func canGrantPermissions(c *gin.Context, permissions []string) bool {
+	access, ok := signedInAccess(c)
+	if !ok {
+		return false
+	}
+	if access.Role == models.RoleAdmin {
+		return true
+	}
+	for _, permission := range permissions {
+		if !slices.Contains(access.Permissions, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+func signedInAccess(c *gin.Context) (auth.Access, bool) {
+	value, _ := c.Get("access")
+	access, ok := value.(auth.Access)
+	return access, ok
+}
+
+// showRolePermissions lists every permission on the admin role, which has
+// them all whatever its row says
+func showRolePermissions(role *models.Role) {
+	if role.Name == models.RoleAdmin {
+		role.Permissions = models.PermissionNames()
+	}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/inventory"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RegisterSerialsRequest struct {
+	Serials []string `json:"serials" validate:"required,min=1"`
+}
+
+type ReturnSerialRequest struct {
+	// Restock puts the unit back on sale; otherwise it is kept as defective
+	Restock bool   `json:"restock"`
+	Reason  string `json:"reason"`
+}
+
+type SerialSale struct {
+	TransactionID uint       `json:"transaction_id"`
+	TransactionNo string     `json:"transaction_no"`
+	Price         float64    `json:"price"`
+	SoldAt        time.Time  `json:"sold_at"`
+	ReturnedAt    *time.Time `json:"returned_at"`
+}
+
+type SerialLookup struct {
+	models.SerialNumber
+	Sales             []SerialSale `json:"sales"`
+	WarrantyExpiresAt *time.Time   `json:"warranty_expires_at"`
+	UnderWarranty     bool         `json:"under_warranty"`
+}
+
+// Get serial numbers
+func GetSerials(c *gin.Context) {
+	db := database.GetDB()
+	var serials []models.SerialNumber
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+
+	query := db.Preload("Product")
+
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+
+	if locationID, err := scopedLocationID(c); err == nil && locationID != 0 {
+		query = query.Where("location_id = ?", locationID)
+	}
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if search := c.Query("search"); search != "" {
+		query = query.Where("serial LIKE ?", search+"%")
+	}
+
+	var total int64
+	query.Model(&models.SerialNumber{}).Count(&total)
+
+	offset := (page - 1) * limit
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&serials).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch serial numbers", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Serial numbers fetched successfully", gin.H{
+		"serials": serials,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// Look up a serial number with its sales history and warranty status
+func GetSerial(c *gin.Context) {
+	db := database.GetDB()
+
+	var unit models.SerialNumber
+	if err := db.Preload("Product").Where("serial = ?", c.Param("serial")).First(&unit).Error; err != nil {
+		utils.NotFoundResponse(c, "Serial number not found")
+		return
+	}
+
+	lookup := SerialLookup{SerialNumber: unit}
+	db.Table("transaction_item_serials").
+		Select("transactions.id as transaction_id, transactions.transaction_no, transaction_items.price, transactions.created_at as sold_at, transaction_item_serials.returned_at").
+		Joins("JOIN transaction_items ON transaction_item_serials.transaction_item_id = transaction_items.id").
+		Joins("JOIN transactions ON transaction_items.transaction_id = transactions.id").
+		Where("transaction_item_serials.serial_number_id = ?", unit.ID).
+		Order("transactions.created_at DESC").
+		Scan(&lookup.Sales)
+
+	// Warranty runs from the most recent sale that has not been returned
+	if unit.Status == models.SerialSold && unit.SoldAt != nil && unit.Product.WarrantyMonths > 0 {
+		expires := unit.SoldAt.AddDate(0, unit.Product.WarrantyMonths, 0)
+		lookup.WarrantyExpiresAt = &expires
+		lookup.UnderWarranty = time.Now().Before(expires)
+	}
+
+	utils.SuccessResponse(c, "Serial number fetched successfully", lookup)
+}
+
+// Register serials for stock already on hand of a serial-tracked product
+func RegisterProductSerials(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid product ID", err)
+		return
+	}
+
+	var req RegisterSerialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	var product models.Product
+	if err := db.First(&product, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Product not found")
+		return
+	}
+
+	if !product.TrackSerials {
+		utils.ErrorResponse(c, "Product does not track serial numbers", nil)
+		return
+	}
+
+	locationID, err := operatingLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	if err := inventory.CheckSerials(req.Serials, len(req.Serials)); err != nil {
+		utils.ErrorResponse(c, "Invalid serials", err)
+		return
+	}
+
+	// Serials can only be registered for units already counted in stock;
+	// new stock is received with its serials through goods receipts
+	var registered int64
+	db.Model(&models.SerialNumber{}).
+		Where("product_id = ? AND location_id = ? AND status = ?", product.ID, locationID, models.SerialInStock).
+		Count(&registered)
+	onHand, err := inventory.StockAt(db, product.ID, locationID)
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to check stock", err)
+		return
+	}
+	if int(registered)+len(req.Serials) > onHand {
+		utils.ErrorResponse(c, fmt.Sprintf("Only %d units in stock are without a serial", onHand-int(registered)), nil)
+		return
+	}
+
+	var units []models.SerialNumber
+	err = db.Transaction(func(tx *gorm.DB) error {
+		units, err = inventory.RegisterSerials(tx, product.ID, locationID, req.Serials, nil)
+		return err
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to register serials", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Serials registered successfully", units)
+}
+
+// Return a sold unit by its serial number
+func ReturnSerial(c *gin.Context) {
+	var req ReturnSerialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	userID, _ := currentUserID(c)
+	db := database.GetDB()
+
+	var unit *models.SerialNumber
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		unit, err = inventory.ReturnSerial(tx, c.Param("serial"), req.Restock, userID, req.Reason)
+		return err
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to return serial", err)
+		return
+	}
+
+	db.Preload("Product").First(unit, unit.ID)
+
+	utils.SuccessResponse(c, "Serial returned successfully", unit)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Token the first-run setup must be given, if any; set at startup
+var setupToken string
+
+// SetSetupToken makes the first-run setup require a token, so no one else
+// on the network can claim the admin account first
+func SetSetupToken(token string) {
+	setupToken = token
+}
+
+type SetupRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=20"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"` // checked against the password policy
+	// SetupToken must match SETUP_TOKEN when that is set
+	SetupToken string `json:"setup_token"`
+}
+
+var (
+	errSetupDone  = errors.New("setup has already been done")
+	errUserExists = errors.New("user already exists")
+)
+
+// needsSetup reports whether no user has been created yet, counting users
+// in the trash
+func needsSetup(db *gorm.DB) (bool, error) {
+	var count int64
+	err := db.Unscoped().Model(&models.User{}).Count(&count).Error
+	return count == 0, err
+}
+
+// Report whether the first admin still has to be created
+func GetSetupStatus(c *gin.Context) {
+	needed, err := needsSetup(database.GetDB())
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to check setup", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Setup status fetched successfully", gin.H{
+		"setup_required":       needed,
+		"setup_token_required": needed && setupToken != "",
+	})
+}
+
+// Create the first admin. This only works while there are no users at all.
+func Setup(c *gin.Context) {
+	var req SetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Invalid request", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation failed", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if setupToken != "" && subtle.ConstantTimeCompare([]byte(req.SetupToken), []byte(setupToken)) != 1 {
+		c.JSON(http.StatusForbidden, utils.Response{
+			Success: false,
+			Message: "Invalid setup token",
+		})
+		return
+	}
+
+	user := models.User{
+		Username: req.Username,
+		Email:    req.Email,
+		Password: req.Password,
+		Role:     models.RoleAdmin,
+	}
+	if badPassword(c, req.Password, &user) {
+		return
+	}
+	if err := user.HashPassword(); err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to hash password", err)
+		return
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Locking the read stops two setups running side by side from
+		// both creating an admin
+		var ids []uint
+		if err := tx.Unscoped().Model(&models.User{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Limit(1).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			return errSetupDone
+		}
+		return tx.Create(&user).Error
+	})
+	if errors.Is(err, errSetupDone) {
+		c.JSON(http.StatusConflict, utils.Response{
+			Success: false,
+			Message: "Setup has already been done",
+		})
+		return
+	}
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to create admin", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, utils.Response{
+		Success: true,
+		Message: "Admin created successfully",
+		Data: gin.H{
+			"user": gin.H{
+				"id":       user.ID,
+				"username": user.Username,
+				"email":    user.Email,
+				"role":     user.Role,
+			},
+		},
+	})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Get stock ledger entries
+func GetStockMovements(c *gin.Context) {
+	db := database.GetDB()
+	var movements []models.StockMovement
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+
+	query := db.Preload("Product")
+
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+
+	if locationID, err := scopedLocationID(c); err == nil && locationID != 0 {
+		query = query.Where("location_id = ?", locationID)
+	}
+
+	if movementType := c.Query("type"); movementType != "" {
+		query = query.Where("type = ?", movementType)
+	}
+
+	if startDate := c.Query("start_date"); startDate != "" {
+		query = query.Where("DATE(created_at) >= ?", startDate)
+	}
+
+	if endDate := c.Query("end_date"); endDate != "" {
+		query = query.Where("DATE(created_at) <= ?", endDate)
+	}
+
+	var total int64
+	query.Model(&models.StockMovement{}).Count(&total)
+
+	offset := (page - 1) * limit
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&movements).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch stock movements", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Stock movements fetched successfully", gin.H{
+		"stock_movements": movements,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SupplierRequest struct {
+	Name     string `json:"name" validate:"required"`
+	Contact  string `json:"contact"`
+	Phone    string `json:"phone"`
+	Email    string `json:"email" validate:"omitempty,email"`
+	Address  string `json:"address"`
+	IsActive *bool  `json:"is_active"`
+	// LeadTimeDays defaults to 7 for new suppliers
+	LeadTimeDays *int `json:"lead_time_days" validate:"omitempty,gte=0"`
+}
+
+// Get all suppliers
+func GetSuppliers(c *gin.Context) {
+	db := database.GetDB()
+	var suppliers []models.Supplier
+
+	query := db.Order("name")
+	if search := c.Query("search"); search != "" {
+		query = query.Where("name LIKE ?", "%"+search+"%")
+	}
+
+	if err := query.Find(&suppliers).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch suppliers", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Suppliers fetched successfully", suppliers)
+}
+
+// Create supplier
+func CreateSupplier(c *gin.Context) {
+	var req SupplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	supplier := models.Supplier{
+		Name:         req.Name,
+		Contact:      req.Contact,
+		Phone:        req.Phone,
+		Email:        req.Email,
+		Address:      req.Address,
+		LeadTimeDays: 7,
+		IsActive:     true,
+	}
+	if req.IsActive != nil {
+		supplier.IsActive = *req.IsActive
+	}
+	if req.LeadTimeDays != nil {
+		supplier.LeadTimeDays = *req.LeadTimeDays
+	}
+
+	if err := database.GetDB().Create(&supplier).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to create supplier", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Supplier created successfully", supplier)
+}
+
+// Update supplier
+func UpdateSupplier(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid supplier ID", err)
+		return
+	}
+
+	var req SupplierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	var supplier models.Supplier
+	if err := db.First(&supplier, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Supplier not found")
+		return
+	}
+
+	supplier.Name = req.Name
+	supplier.Contact = req.Contact
+	supplier.Phone = req.Phone
+	supplier.Email = req.Email
+	supplier.Address = req.Address
+	if req.IsActive != nil {
+		supplier.IsActive = *req.IsActive
+	}
+	if req.LeadTimeDays != nil {
+		supplier.LeadTimeDays = *req.LeadTimeDays
+	}
+
+	if err := db.Save(&supplier).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to update supplier", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Supplier updated successfully", supplier)
+}
+
+// Delete supplier
+func DeleteSupplier(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid supplier ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var supplier models.Supplier
+	if err := db.First(&supplier, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Supplier not found")
+		return
+	}
+
+	if err := db.Delete(&supplier).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to delete supplier", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Supplier deleted successfully", nil)
+}
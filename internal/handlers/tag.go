@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// productHasTagSQL matches products carrying the tag with the given name
+const productHasTagSQL = "EXISTS (SELECT 1 FROM product_tags JOIN tags ON tags.id = product_tags.tag_id " +
+	"WHERE product_tags.product_id = products.id AND tags.name = ?)"
+
+type TagRequest struct {
+	Name  string `json:"name" validate:"required,max=50"`
+	Color string `json:"color" validate:"max=20"`
+}
+
+type TagProductsRequest struct {
+	ProductIDs []uint `json:"product_ids" validate:"required,min=1"`
+}
+
+// Get all tags with the number of products carrying each
+func GetTags(c *gin.Context) {
+	db := database.GetDB()
+	query := db.Order("name")
+	if search := c.Query("search"); search != "" {
+		query = query.Where("name LIKE ?", "%"+search+"%")
+	}
+
+	var tags []models.Tag
+	if err := query.Find(&tags).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch tags", err)
+		return
+	}
+
+	var counts []struct {
+		TagID uint
+		Count int64
+	}
+	db.Table("product_tags").
+		Select("product_tags.tag_id, COUNT(*) AS count").
+		Joins("JOIN products ON products.id = product_tags.product_id AND products.deleted_at IS NULL").
+		Group("product_tags.tag_id").
+		Scan(&counts)
+
+	byTag := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		byTag[count.TagID] = count.Count
+	}
+	for i := range tags {
+		count := byTag[tags[i].ID]
+		tags[i].ProductCount = &count
+	}
+
+	utils.SuccessResponse(c, "Tags fetched successfully", tags)
+}
+
+// Create tag
+func CreateTag(c *gin.Context) {
+	var req TagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	tag := models.Tag{Name: strings.TrimSpace(req.Name), Color: req.Color}
+	if err := checkTagName(db, tag.Name, 0); err != nil {
+		utils.ErrorResponse(c, err.Error(), nil)
+		return
+	}
+
+	if err := db.Create(&tag).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to create tag", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Tag created successfully", tag)
+}
+
+// Rename or recolour a tag
+func UpdateTag(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid tag ID", err)
+		return
+	}
+
+	var req TagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	var tag models.Tag
+	if err := db.First(&tag, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Tag not found")
+		return
+	}
+
+	tag.Name = strings.TrimSpace(req.Name)
+	tag.Color = req.Color
+	if err := checkTagName(db, tag.Name, tag.ID); err != nil {
+		utils.ErrorResponse(c, err.Error(), nil)
+		return
+	}
+
+	if err := db.Save(&tag).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to update tag", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Tag updated successfully", tag)
+}
+
+// Delete a tag, taking it off every product
+func DeleteTag(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid tag ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var tag models.Tag
+	if err := db.First(&tag, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Tag not found")
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM product_tags WHERE tag_id = ?", tag.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to delete tag", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Tag deleted successfully", nil)
+}
+
+// Put a tag on several products at once
+func AddTagProducts(c *gin.Context) {
+	tag, products, ok := tagProductsRequest(c)
+	if !ok {
+		return
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		for i := range products {
+			if err := tx.Model(&products[i]).Association("Tags").Append(&tag); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to tag products", err)
+		return
+	}
+
+	utils.SuccessResponse(c, fmt.Sprintf("Tagged %d products", len(products)), nil)
+}
+
+// Take a tag off several products at once
+func RemoveTagProducts(c *gin.Context) {
+	tag, products, ok := tagProductsRequest(c)
+	if !ok {
+		return
+	}
+
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+
+	result := database.GetDB().Exec("DELETE FROM product_tags WHERE tag_id = ? AND product_id IN ?", tag.ID, ids)
+	if result.Error != nil {
+		utils.ErrorResponse(c, "Failed to untag products", result.Error)
+		return
+	}
+
+	utils.SuccessResponse(c, fmt.Sprintf("Untagged %d products", result.RowsAffected), nil)
+}
+
+// tagProductsRequest reads the tag and products of a bulk tagging request,
+// writing the error response when they are not valid
+func tagProductsRequest(c *gin.Context) (models.Tag, []models.Product, bool) {
+	var tag models.Tag
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid tag ID", err)
+		return tag, nil, false
+	}
+
+	var req TagProductsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return tag, nil, false
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return tag, nil, false
+	}
+
+	db := database.GetDB()
+	if err := db.First(&tag, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Tag not found")
+		return tag, nil, false
+	}
+
+	var products []models.Product
+	if err := db.Where("id IN ?", req.ProductIDs).Find(&products).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch products", err)
+		return tag, nil, false
+	}
+	if len(products) != len(uniqueIDs(req.ProductIDs)) {
+		utils.ErrorResponse(c, "Some products were not found", nil)
+		return tag, nil, false
+	}
+	return tag, products, true
+}
+
+// resolveTags returns the tags with the given names, creating the ones that
+// do not exist yet. Names are trimmed and duplicates dropped.
+func resolveTags(tx *gorm.DB, names []string) ([]models.Tag, error) {
+	tags := make([]models.Tag, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		if len(name) > 50 {
+			return nil, fmt.Errorf("tag %q is longer than 50 characters", name)
+		}
+		seen[key] = true
+
+		var tag models.Tag
+		if err := tx.Where(models.Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// setProductTags replaces the tags of a product with the named tags
+func setProductTags(tx *gorm.DB, product *models.Product, names []string) error {
+	tags, err := resolveTags(tx, names)
+	if err != nil {
+		return err
+	}
+	return tx.Model(product).Association("Tags").Replace(tags)
+}
+
+func checkTagName(db *gorm.DB, name string, excludeID uint) error {
+	if name == "" {
+		return fmt.Errorf("Tag name is required")
+	}
+	var count int64
+	db.Model(&models.Tag{}).Where("name = ? AND id != ?", name, excludeID).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("Tag %s already exists", name)
+	}
+	return nil
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"POS-Golang/internal/auth"
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TerminalRequest struct {
+	Name       string `json:"name" validate:"required,max=100"`
+	LocationID uint   `json:"location_id" validate:"required"`
+	IsActive   *bool  `json:"is_active"`
+}
+
+type PINLoginRequest struct {
+	Username string `json:"username" validate:"required"`
+	PIN      string `json:"pin" validate:"required,numeric,min=4,max=6"`
+}
+
+type UserPINRequest struct {
+	PIN string `json:"pin" validate:"required,numeric,min=4,max=6"`
+}
+
+// pinKey is the rate limit key for a user's PIN
+func pinKey(userID uint) string {
+	return fmt.Sprintf("pin:%d", userID)
+}
+
+// checkPIN checks a user's PIN, counting wrong ones towards the lockout.
+// It returns how long the user's PIN is locked out for when it is.
+func checkPIN(user *models.User, pin string) (bool, time.Duration, error) {
+	key := pinKey(user.ID)
+	wait, err := pinLimiter.Blocked(key)
+	if err != nil || wait > 0 {
+		return false, wait, err
+	}
+	if !user.CheckPIN(pin) {
+		wait, err := pinLimiter.Fail(key)
+		return false, wait, err
+	}
+	return true, 0, pinLimiter.Reset(key)
+}
+
+// Log in with a PIN on a registered terminal. The session started is tied
+// to the terminal and locks when left idle. A PIN is a single factor, so
+// users who sign in with two-factor, by choice or by role, cannot use it.
+func PINLogin(c *gin.Context) {
+	var req PINLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Invalid request", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation failed", map[string]string{"error": err.Error()})
+		return
+	}
+
+	terminal := c.MustGet("terminal").(*models.Terminal)
+	db := database.GetDB()
+
+	var user models.User
+	if err := db.Where("username = ?", req.Username).First(&user).Error; err != nil {
+		recordLoginAttempt(c, models.LoginPIN, req.Username, nil, &terminal.ID, models.LoginInvalid)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Invalid username or PIN",
+		})
+		return
+	}
+
+	ok, wait, err := checkPIN(&user, req.PIN)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to check PIN", err)
+		return
+	}
+	if !ok {
+		reason := models.LoginInvalid
+		if wait > 0 {
+			reason = models.LoginAccountLocked
+		}
+		recordLoginAttempt(c, models.LoginPIN, req.Username, &user, &terminal.ID, reason)
+		if wait > 0 {
+			lockedOut(c, "Too many wrong PINs, try again later", wait)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "Invalid username or PIN",
+		})
+		return
+	}
+
+	twoFactor, err := usesTwoFactor(db, &user)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to check two-factor sign-in", err)
+		return
+	}
+	if twoFactor {
+		recordLoginAttempt(c, models.LoginPIN, req.Username, &user, &terminal.ID, models.LoginPINRefused)
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "PIN login is not available to users who sign in with two-factor",
+		})
+		return
+	}
+
+	permissions, err := auth.RolePermissions(db, user.Role)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to load permissions", err)
+		return
+	}
+
+	// Store staff only log in on their own store's terminals
+	access := auth.Access{Role: user.Role, Permissions: permissions}
+	if user.LocationID != nil && *user.LocationID != terminal.LocationID && !access.Can(models.PermLocationAll) {
+		recordLoginAttempt(c, models.LoginPIN, req.Username, &user, &terminal.ID, models.LoginWrongTerminal)
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "This terminal belongs to another store",
+		})
+		return
+	}
+
+	tokens, err := auth.Login(db, &user, c.Request.UserAgent(), c.ClientIP(), &terminal.ID)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to generate token", err)
+		return
+	}
+	recordLoginAttempt(c, models.LoginPIN, req.Username, &user, &terminal.ID, "")
+
+	utils.SuccessResponse(c, "Login successful", gin.H{
+		"token":              tokens.AccessToken,
+		"token_type":         tokens.TokenType,
+		"expires_at":         tokens.ExpiresAt,
+		"refresh_token":      tokens.RefreshToken,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+		"terminal_id":        terminal.ID,
+		"user": gin.H{
+			"id":                   user.ID,
+			"username":             user.Username,
+			"email":                user.Email,
+			"role":                 user.Role,
+			"permissions":          permissions,
+			"location_id":          user.LocationID,
+			"must_change_password": user.MustChangePassword,
+		},
+	})
+}
+
+// Get the users who can log in with a PIN on the calling terminal, for the
+// till's user picker
+func GetTerminalUsers(c *gin.Context) {
+	terminal := c.MustGet("terminal").(*models.Terminal)
+
+	var users []struct {
+		ID       uint   `json:"id"`
+		Username string `json:"username"`
+	}
+	db := database.GetDB()
+	if err := db.Model(&models.User{}).
+		Where("pin_hash != ''").
+		Where("location_id = ? OR location_id IS NULL", terminal.LocationID).
+		// Users who sign in with two-factor cannot log in with a PIN
+		Where("id NOT IN (?)", db.Model(&models.TwoFactor{}).Select("user_id").Where("enabled_at IS NOT NULL")).
+		Where("role NOT IN (?)", db.Model(&models.Role{}).Select("name").Where("require_two_factor = ?", true)).
+		Order("username").Find(&users).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch users", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Users fetched successfully", users)
+}
+
+// Set a user's PIN for them
+func SetUserPIN(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid user ID", err)
+		return
+	}
+
+	var req UserPINRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		utils.NotFoundResponse(c, "User not found")
+		return
+	}
+
+	// Otherwise a manager could set an admin's PIN and sign in as them
+	allowed, err := canGrantRole(c, db, user.Role)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to check role", err)
+		return
+	}
+	if !allowed {
+		utils.ForbiddenResponse(c, "You cannot set the PIN of a user with permissions you do not have")
+		return
+	}
+
+	if err := user.SetPIN(req.PIN); err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to set PIN", err)
+		return
+	}
+	if err := db.Model(&user).UpdateColumn("pin_hash", user.PINHash).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to set PIN", err)
+		return
+	}
+	if err := pinLimiter.Reset(pinKey(user.ID)); err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to unlock PIN", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "PIN set successfully", nil)
+}
+
+// Get registered terminals
+func GetTerminals(c *gin.Context) {
+	query := database.GetDB().Preload("Location")
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Where("location_id = ?", locationID)
+	}
+
+	var terminals []models.Terminal
+	if err := query.Order("name").Find(&terminals).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch terminals", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Terminals fetched successfully", terminals)
+}
+
+// Register a terminal. Its key is only shown in this response, so it has
+// to be entered on the terminal now.
+func CreateTerminal(c *gin.Context) {
+	req, ok := bindTerminal(c)
+	if !ok {
+		return
+	}
+
+	key, hash, err := auth.NewTerminalKey()
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to create terminal key", err)
+		return
+	}
+
+	terminal := models.Terminal{
+		Name:       req.Name,
+		LocationID: req.LocationID,
+		KeyHash:    hash,
+		IsActive:   req.IsActive == nil || *req.IsActive,
+	}
+	if err := database.GetDB().Create(&terminal).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to create terminal", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Terminal registered successfully", gin.H{
+		"terminal": terminal,
+		"key":      key,
+	})
+}
+
+// Update a terminal. Deactivating it or moving it to another store ends
+// the sessions started on it.
+func UpdateTerminal(c *gin.Context) {
+	terminal, ok := findTerminal(c)
+	if !ok {
+		return
+	}
+
+	req, ok := bindTerminal(c)
+	if !ok {
+		return
+	}
+
+	endSessions := (req.IsActive != nil && !*req.IsActive && terminal.IsActive) || req.LocationID != terminal.LocationID
+
+	terminal.Name = req.Name
+	terminal.LocationID = req.LocationID
+	if req.IsActive != nil {
+		terminal.IsActive = *req.IsActive
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(terminal).Error; err != nil {
+			return err
+		}
+		if !endSessions {
+			return nil
+		}
+		return auth.RevokeTerminal(tx, terminal.ID)
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to update terminal", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Terminal updated successfully", terminal)
+}
+
+// Replace a terminal's key, as done when the old one may have leaked. The
+// old key stops working and the terminal's sessions end.
+func RotateTerminalKey(c *gin.Context) {
+	terminal, ok := findTerminal(c)
+	if !ok {
+		return
+	}
+
+	key, hash, err := auth.NewTerminalKey()
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to create terminal key", err)
+		return
+	}
+
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(terminal).UpdateColumn("key_hash", hash).Error; err != nil {
+			return err
+		}
+		return auth.RevokeTerminal(tx, terminal.ID)
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to replace terminal key", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Terminal key replaced successfully", gin.H{
+		"terminal": terminal,
+		"key":      key,
+	})
+}
+
+// Remove a terminal, ending the sessions started on it
+func DeleteTerminal(c *gin.Context) {
+	terminal, ok := findTerminal(c)
+	if !ok {
+		return
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := auth.RevokeTerminal(tx, terminal.ID); err != nil {
+			return err
+		}
+		return tx.Delete(terminal).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to delete terminal", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Terminal deleted successfully", nil)
+}
+
+func findTerminal(c *gin.Context) (*models.Terminal, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid terminal ID", err)
+		return nil, false
+	}
+
+	var terminal models.Terminal
+	if err := database.GetDB().First(&terminal, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Terminal not found")
+		return nil, false
+	}
+	return &terminal, true
+}
+
+func bindTerminal(c *gin.Context) (TerminalRequest, bool) {
+	var req TerminalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return req, false
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return req, false
+	}
+
+	var location models.Location
+	if err := database.GetDB().First(&location, req.LocationID).Error; err != nil || location.Type == models.LocationTransit {
+		utils.ErrorResponse(c, "Location not found", nil)
+		return req, false
+	}
+	return req, true
+}
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"POS-Golang/internal/barcode"
 	"POS-Golang/internal/database"
+	"POS-Golang/internal/inventory"
 	"POS-Golang/internal/models"
+	"POS-Golang/internal/pricing"
 	"POS-Golang/internal/utils"
 	"fmt"
 	"net/http"
@@ -10,17 +13,38 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type TransactionItemRequest struct {
 	ProductID uint `json:"product_id" validate:"required"`
 	Quantity  int  `json:"quantity" validate:"required,gt=0"`
+	// Serials of the units sold, required for serial-tracked products
+	Serials []string `json:"serials"`
+	// Price overrides the list price; it needs approval
+	Price *float64 `json:"price" validate:"omitempty,gte=0"`
+	// Barcode is the scale barcode a weighed item was scanned with. The
+	// line is then one labelled pack, sold at the price the barcode gives.
+	Barcode string `json:"barcode"`
+	// DiscountPercent comes off the line; above the limit it needs approval
+	DiscountPercent float64 `json:"discount_percent" validate:"gte=0,lte=100"`
 }
 
 type TransactionRequest struct {
-	Items         []TransactionItemRequest `json:"items" validate:"required,min=1"`
+	Items         []TransactionItemRequest `json:"items" validate:"required,min=1,dive"`
 	PaymentMethod string                   `json:"payment_method" validate:"required,oneof=cash card transfer"`
 	PaymentAmount float64                  `json:"payment_amount" validate:"required,gt=0"`
+	// Customer buying, whose price list applies unless another is given
+	CustomerID  *uint `json:"customer_id"`
+	PriceListID *uint `json:"price_list_id"`
+	// Approval by a supervisor, for price overrides and discounts the
+	// cashier cannot give on their own
+	Approval *ApprovalRequest `json:"approval"`
+}
+
+type VoidTransactionRequest struct {
+	Reason   string           `json:"reason" validate:"required,max=255"`
+	Approval *ApprovalRequest `json:"approval"`
 }
 
 // Generate transaction number
@@ -41,7 +65,17 @@ func GetTransactions(c *gin.Context) {
 	endDate := c.Query("end_date")
 	status := c.Query("status")
 
-	query := db.Preload("User").Preload("Items.Product")
+	query := db.Preload("User").Preload("Customer").Preload("Items.Product")
+
+	// Store staff only see their own store's transactions
+	locationID, err := scopedLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+	if locationID != 0 {
+		query = query.Where("location_id = ?", locationID)
+	}
 
 	// Apply filters
 	if startDate != "" {
@@ -56,6 +90,10 @@ func GetTransactions(c *gin.Context) {
 		query = query.Where("status = ?", status)
 	}
 
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+
 	paymentMethod := c.Query("payment_method")
 	if paymentMethod != "" {
 		query = query.Where("payment_method = ?", paymentMethod)
@@ -94,11 +132,17 @@ func GetTransaction(c *gin.Context) {
 	db := database.GetDB()
 	var transaction models.Transaction
 
-	if err := db.Preload("User").Preload("Items.Product.Category").First(&transaction, id).Error; err != nil {
+	if err := db.Preload("User").Preload("Customer").Preload("PriceList").Preload("Items.Product.Category").Preload("Items.Lots.StockLot").Preload("Items.Serials.SerialNumber").Preload("Approvals.Approver").First(&transaction, id).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
 		return
 	}
 
+	// Store staff only see their own store's sales
+	if err := checkLocationAccess(c, transaction.LocationID); err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You can only view sales of your own store"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Transaction fetched successfully",
 		"data":    transaction,
@@ -127,6 +171,23 @@ func CreateTransaction(c *gin.Context) {
 		return
 	}
 
+	// Sales are made from the cashier's store
+	locationID, err := operatingLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	var location models.Location
+	if err := db.First(&location, locationID).Error; err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+	if !location.IsActive {
+		utils.ErrorResponse(c, "Sales cannot be made at an inactive location", nil)
+		return
+	}
+
 	// Start transaction
 	tx := db.Begin()
 	defer func() {
@@ -135,9 +196,37 @@ func CreateTransaction(c *gin.Context) {
 		}
 	}()
 
+	// Prices come from the requested or customer's price list, if any
+	var customer *models.Customer
+	if req.CustomerID != nil {
+		customer, err = findSaleCustomer(tx, *req.CustomerID)
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, err.Error(), nil)
+			return
+		}
+	}
+
+	priceList, err := pricing.ActiveList(tx, req.PriceListID, customer)
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, "Invalid price list", err)
+		return
+	}
+
 	// Validate products and calculate total
 	var totalAmount float64
 	var transactionItems []models.TransactionItem
+	var approvals []models.Approval
+
+	// Picking a list other than the customer's or the default one changes
+	// what the customer pays, so it is a price override
+	if req.PriceListID != nil && !priceList.IsDefault && (customer == nil || !sameID(customer.PriceListID, req.PriceListID)) {
+		approvals = append(approvals, models.Approval{
+			Action:  models.ApprovalPriceOverride,
+			Details: fmt.Sprintf("price list %s", priceList.Name),
+		})
+	}
 
 	for _, item := range req.Items {
 		var product models.Product
@@ -147,8 +236,14 @@ func CreateTransaction(c *gin.Context) {
 			return
 		}
 
-		// Check stock availability
-		if product.Stock < item.Quantity {
+		// Check stock availability at this store
+		onHand, err := inventory.StockAt(tx, product.ID, locationID)
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, "Failed to check stock", err)
+			return
+		}
+		if onHand < item.Quantity {
 			tx.Rollback()
 			utils.ErrorResponse(c, fmt.Sprintf("Insufficient stock for product %s", product.Name), nil)
 			return
@@ -161,23 +256,80 @@ func CreateTransaction(c *gin.Context) {
 			return
 		}
 
-		subtotal := product.Price * float64(item.Quantity)
+		// Serial-tracked products must name every unit sold
+		if product.TrackSerials {
+			if err := inventory.CheckSerials(item.Serials, item.Quantity); err != nil {
+				tx.Rollback()
+				utils.ErrorResponse(c, fmt.Sprintf("Invalid serials for product %s", product.Name), err)
+				return
+			}
+		} else if len(item.Serials) > 0 {
+			tx.Rollback()
+			utils.ErrorResponse(c, fmt.Sprintf("Product %s does not track serial numbers", product.Name), nil)
+			return
+		}
+
+		listPrice, err := pricing.UnitPrice(tx, priceList, product, item.Quantity)
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, fmt.Sprintf("Failed to price product %s", product.Name), err)
+			return
+		}
+
+		if item.Barcode != "" {
+			if item.Quantity != 1 {
+				tx.Rollback()
+				utils.ErrorResponse(c, fmt.Sprintf("A scale barcode line of %s must have a quantity of 1", product.Name), nil)
+				return
+			}
+			if listPrice, err = scaleLinePrice(item.Barcode, product, listPrice); err != nil {
+				tx.Rollback()
+				utils.ErrorResponse(c, "Invalid scale barcode", err)
+				return
+			}
+		}
+
+		// Price overrides and large discounts are recorded for approval
+		unitPrice := listPrice
+		if item.Price != nil && roundPrice(*item.Price) != listPrice {
+			unitPrice = roundPrice(*item.Price)
+			approvals = append(approvals, models.Approval{
+				Action:  models.ApprovalPriceOverride,
+				Details: fmt.Sprintf("%s: price %.2f instead of %.2f", product.Name, unitPrice, listPrice),
+			})
+		}
+
+		discount := roundPrice(unitPrice * float64(item.Quantity) * item.DiscountPercent / 100)
+		if item.DiscountPercent > discountApprovalLimit {
+			approvals = append(approvals, models.Approval{
+				Action:  models.ApprovalDiscount,
+				Details: fmt.Sprintf("%s: %g%% discount, %.2f off", product.Name, item.DiscountPercent, discount),
+			})
+		}
+
+		subtotal := unitPrice*float64(item.Quantity) - discount
 		totalAmount += subtotal
 
 		transactionItems = append(transactionItems, models.TransactionItem{
 			ProductID: item.ProductID,
 			Quantity:  item.Quantity,
-			Price:     product.Price,
+			ListPrice: listPrice,
+			Price:     unitPrice,
+			Discount:  discount,
+			Cost:      product.Cost,
 			Subtotal:  subtotal,
 		})
+	}
 
-		// Update product stock
-		product.Stock -= item.Quantity
-		if err := tx.Save(&product).Error; err != nil {
-			tx.Rollback()
-			utils.ErrorResponse(c, "Failed to update product stock", err)
-			return
-		}
+	var actions []string
+	for _, approval := range approvals {
+		actions = append(actions, approval.Action)
+	}
+	approverID, err := approver(c, tx, req.Approval, actions...)
+	if err != nil {
+		tx.Rollback()
+		approvalFailed(c, err)
+		return
 	}
 
 	// Validate payment amount
@@ -194,12 +346,17 @@ func CreateTransaction(c *gin.Context) {
 	transaction := models.Transaction{
 		TransactionNo: generateTransactionNo(),
 		UserID:        uint(userID.(float64)),
+		LocationID:    locationID,
+		CustomerID:    req.CustomerID,
 		TotalAmount:   totalAmount,
 		PaymentMethod: req.PaymentMethod,
 		PaymentAmount: req.PaymentAmount,
 		ChangeAmount:  changeAmount,
 		Status:        "completed",
 	}
+	if priceList != nil {
+		transaction.PriceListID = &priceList.ID
+	}
 
 	if err := tx.Create(&transaction).Error; err != nil {
 		tx.Rollback()
@@ -218,6 +375,96 @@ func CreateTransaction(c *gin.Context) {
 		return
 	}
 
+	if len(approvals) > 0 {
+		for i := range approvals {
+			approvals[i].ApproverID = approverID
+			approvals[i].RequestedByID = transaction.UserID
+			approvals[i].LocationID = locationID
+			approvals[i].TransactionID = &transaction.ID
+		}
+		if err := tx.Create(&approvals).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, "Failed to record approvals", err)
+			return
+		}
+	}
+
+	// Update product stock through the stock ledger, recording which lots
+	// each line was drawn from for lot-tracked products
+	var itemLots []models.TransactionItemLot
+	var itemSerials []models.TransactionItemSerial
+	for i, item := range transactionItems {
+		movements, err := inventory.Move(tx, inventory.Movement{
+			ProductID:     item.ProductID,
+			LocationID:    locationID,
+			Type:          models.MovementSale,
+			Quantity:      -item.Quantity,
+			ReferenceType: "transaction",
+			ReferenceID:   transaction.ID,
+			UserID:        transaction.UserID,
+		})
+		if err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, "Failed to update product stock", err)
+			return
+		}
+
+		var lotUnits int
+		var lotCost float64
+		for _, movement := range movements {
+			if movement.StockLotID != nil {
+				itemLots = append(itemLots, models.TransactionItemLot{
+					TransactionItemID: item.ID,
+					StockLotID:        *movement.StockLotID,
+					Quantity:          -movement.Quantity,
+				})
+				lotUnits += -movement.Quantity
+				lotCost += float64(-movement.Quantity) * movement.UnitCost
+			}
+		}
+
+		// Lot-tracked lines cost what the lots they drew from cost
+		if lotUnits > 0 {
+			transactionItems[i].Cost = lotCost / float64(lotUnits)
+			if err := tx.Model(&transactionItems[i]).UpdateColumn("cost", transactionItems[i].Cost).Error; err != nil {
+				tx.Rollback()
+				utils.ErrorResponse(c, "Failed to update transaction item cost", err)
+				return
+			}
+		}
+
+		if serials := req.Items[i].Serials; len(serials) > 0 {
+			units, err := inventory.SellSerials(tx, item.ProductID, locationID, serials)
+			if err != nil {
+				tx.Rollback()
+				utils.ErrorResponse(c, "Failed to sell serial numbers", err)
+				return
+			}
+			for _, unit := range units {
+				itemSerials = append(itemSerials, models.TransactionItemSerial{
+					TransactionItemID: item.ID,
+					SerialNumberID:    unit.ID,
+				})
+			}
+		}
+	}
+
+	if len(itemSerials) > 0 {
+		if err := tx.Create(&itemSerials).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, "Failed to record serial numbers", err)
+			return
+		}
+	}
+
+	if len(itemLots) > 0 {
+		if err := tx.Create(&itemLots).Error; err != nil {
+			tx.Rollback()
+			utils.ErrorResponse(c, "Failed to record lot allocations", err)
+			return
+		}
+	}
+
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		utils.ErrorResponse(c, "Failed to commit transaction", err)
@@ -225,7 +472,87 @@ func CreateTransaction(c *gin.Context) {
 	}
 
 	// Load complete transaction data
-	db.Preload("User").Preload("Items.Product").First(&transaction, transaction.ID)
+	db.Preload("User").Preload("Customer").Preload("PriceList").Preload("Items.Product").Preload("Items.Serials.SerialNumber").Preload("Approvals.Approver").First(&transaction, transaction.ID)
 
 	utils.SuccessResponse(c, "Transaction created successfully", transaction)
 }
+
+// Void a completed sale, putting its stock back. Users whose role cannot
+// void need a supervisor's approval, which is recorded with the void.
+func VoidTransaction(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid transaction ID", err)
+		return
+	}
+
+	var req VoidTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	var transaction models.Transaction
+	if err := db.First(&transaction, id).Error; err != nil {
+		utils.NotFoundResponse(c, "Transaction not found")
+		return
+	}
+
+	// Store staff only void their own store's sales
+	if err := checkLocationAccess(c, transaction.LocationID); err != nil {
+		c.JSON(http.StatusForbidden, utils.Response{Success: false, Message: err.Error()})
+		return
+	}
+
+	approverID, err := approver(c, db, req.Approval, models.ApprovalVoid)
+	if err != nil {
+		approvalFailed(c, err)
+		return
+	}
+
+	userID, _ := currentUserID(c)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if _, err := inventory.VoidSale(tx, transaction.ID, userID, req.Reason); err != nil {
+			return err
+		}
+		return tx.Create(&models.Approval{
+			Action:        models.ApprovalVoid,
+			ApproverID:    approverID,
+			RequestedByID: userID,
+			LocationID:    transaction.LocationID,
+			TransactionID: &transaction.ID,
+			Reason:        req.Reason,
+			Details:       fmt.Sprintf("%s for %.2f", transaction.TransactionNo, transaction.TotalAmount),
+		}).Error
+	})
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to void transaction", err)
+		return
+	}
+
+	db.Preload("User").Preload("Customer").Preload("Items.Product").Preload("Approvals.Approver").First(&transaction, transaction.ID)
+
+	utils.SuccessResponse(c, "Transaction voided successfully", transaction)
+}
+
+// scaleLinePrice returns the price of a pack labelled with a scale barcode:
+// the price printed in it, or the weight in it at the per-kilogram price.
+func scaleLinePrice(code string, product models.Product, perKilogram float64) (float64, error) {
+	embedded, ok := barcode.DecodeEmbedded(code)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a scale barcode", code)
+	}
+	if product.PLU == nil || *product.PLU != embedded.PLU {
+		return 0, fmt.Errorf("barcode %s was not printed for %s", code, product.Name)
+	}
+	if embedded.Kind == barcode.EmbeddedWeight {
+		return roundPrice(embedded.Kilograms() * perKilogram), nil
+	}
+	return embedded.Amount(), nil
+}
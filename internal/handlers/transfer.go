@@ -0,0 +1,557 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/inventory"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StockTransferItemRequest struct {
+	ProductID uint `json:"product_id" validate:"required"`
+	Quantity  int  `json:"quantity" validate:"required,gt=0"`
+}
+
+type StockTransferRequest struct {
+	FromLocationID uint                       `json:"from_location_id" validate:"required"`
+	ToLocationID   uint                       `json:"to_location_id"` // defaults to the user's store
+	Notes          string                     `json:"notes"`
+	Items          []StockTransferItemRequest `json:"items" validate:"required,min=1,dive"`
+}
+
+type TransferLineRequest struct {
+	ItemID   uint     `json:"item_id" validate:"required"`
+	Quantity int      `json:"quantity" validate:"gte=0"`
+	Serials  []string `json:"serials"`
+	Note     string   `json:"note"`
+}
+
+// TransferLinesRequest lists the quantities actually shipped or received.
+// Lines left out are taken to be shipped or received in full.
+type TransferLinesRequest struct {
+	Items []TransferLineRequest `json:"items" validate:"dive"`
+}
+
+var errLocationAccess = errors.New("you can only move stock for your own store")
+
+// checkLocationAccess makes sure store staff only act on their own store
+func checkLocationAccess(c *gin.Context, locationIDs ...uint) error {
+	if can(c, models.PermLocationAll) {
+		return nil
+	}
+
+	scoped, err := scopedLocationID(c)
+	if err != nil {
+		return err
+	}
+	if scoped == 0 {
+		return nil
+	}
+
+	for _, id := range locationIDs {
+		if id == scoped {
+			return nil
+		}
+	}
+	return errLocationAccess
+}
+
+// Get stock transfers to or from the user's location
+func GetStockTransfers(c *gin.Context) {
+	db := database.GetDB()
+	var transfers []models.StockTransfer
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	locationID, err := scopedLocationID(c)
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid location", err)
+		return
+	}
+
+	query := db.Preload("FromLocation").Preload("ToLocation")
+	if locationID != 0 {
+		query = query.Where("from_location_id = ? OR to_location_id = ?", locationID, locationID)
+	}
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Model(&models.StockTransfer{}).Count(&total)
+
+	offset := (page - 1) * limit
+	if err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&transfers).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to fetch stock transfers", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Stock transfers fetched successfully", gin.H{
+		"stock_transfers": transfers,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// Get single stock transfer
+func GetStockTransfer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid stock transfer ID", err)
+		return
+	}
+
+	transfer, err := loadStockTransfer(database.GetDB(), uint(id))
+	if err != nil {
+		utils.NotFoundResponse(c, "Stock transfer not found")
+		return
+	}
+
+	if err := checkLocationAccess(c, transfer.FromLocationID, transfer.ToLocationID); err != nil {
+		utils.ForbiddenResponse(c, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, "Stock transfer fetched successfully", transfer)
+}
+
+// Request a stock transfer between two locations
+func CreateStockTransfer(c *gin.Context) {
+	var req StockTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, "User not authenticated", nil)
+		return
+	}
+
+	if req.ToLocationID == 0 {
+		locationID, err := operatingLocationID(c)
+		if err != nil {
+			utils.ErrorResponse(c, "Invalid location", err)
+			return
+		}
+		req.ToLocationID = locationID
+	}
+
+	if req.FromLocationID == req.ToLocationID {
+		utils.ErrorResponse(c, "Source and destination must be different locations", nil)
+		return
+	}
+
+	db := database.GetDB()
+	for _, id := range []uint{req.FromLocationID, req.ToLocationID} {
+		var location models.Location
+		if err := db.First(&location, id).Error; err != nil || location.Type == models.LocationTransit {
+			utils.ErrorResponse(c, fmt.Sprintf("Location with ID %d not found", id), nil)
+			return
+		}
+	}
+
+	if err := checkLocationAccess(c, req.FromLocationID, req.ToLocationID); err != nil {
+		utils.ForbiddenResponse(c, err.Error())
+		return
+	}
+
+	var items []models.StockTransferItem
+	for _, item := range req.Items {
+		var product models.Product
+		if err := db.First(&product, item.ProductID).Error; err != nil {
+			utils.ErrorResponse(c, fmt.Sprintf("Product with ID %d not found", item.ProductID), err)
+			return
+		}
+		items = append(items, models.StockTransferItem{
+			ProductID:         item.ProductID,
+			QuantityRequested: item.Quantity,
+		})
+	}
+
+	transfer := models.StockTransfer{
+		TransferNo:     generateDocumentNo("TRF"),
+		FromLocationID: req.FromLocationID,
+		ToLocationID:   req.ToLocationID,
+		Status:         models.TransferRequested,
+		Notes:          req.Notes,
+		RequestedBy:    userID,
+		Items:          items,
+	}
+
+	if err := db.Create(&transfer).Error; err != nil {
+		utils.ErrorResponse(c, "Failed to create stock transfer", err)
+		return
+	}
+
+	loaded, _ := loadStockTransfer(db, transfer.ID)
+	utils.SuccessResponse(c, "Stock transfer requested successfully", loaded)
+}
+
+// Ship a requested transfer: stock leaves the source and is held in transit
+func ShipStockTransfer(c *gin.Context) {
+	processStockTransfer(c, models.TransferRequested, func(tx *gorm.DB, transfer *models.StockTransfer, lines map[uint]TransferLineRequest, userID, transitID uint) error {
+		if err := checkLocationAccess(c, transfer.FromLocationID); err != nil {
+			return err
+		}
+
+		for i := range transfer.Items {
+			item := &transfer.Items[i]
+			line, listed := lines[item.ID]
+
+			qty := item.QuantityRequested
+			if listed {
+				qty = line.Quantity
+			}
+			if qty == 0 {
+				continue
+			}
+
+			if err := shipTransferItem(tx, transfer, item, qty, line.Serials, userID, transitID); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		return tx.Model(transfer).Updates(map[string]interface{}{
+			"status":     models.TransferShipped,
+			"shipped_by": userID,
+			"shipped_at": now,
+		}).Error
+	})
+}
+
+// Receive a shipped transfer at its destination, recording discrepancies
+func ReceiveStockTransfer(c *gin.Context) {
+	processStockTransfer(c, models.TransferShipped, func(tx *gorm.DB, transfer *models.StockTransfer, lines map[uint]TransferLineRequest, userID, transitID uint) error {
+		if err := checkLocationAccess(c, transfer.ToLocationID); err != nil {
+			return err
+		}
+
+		for i := range transfer.Items {
+			item := &transfer.Items[i]
+			line, listed := lines[item.ID]
+
+			received := item.QuantityShipped
+			var serials []string
+			if listed {
+				received = line.Quantity
+				serials = line.Serials
+			}
+
+			if err := receiveTransferItem(tx, transfer, item, received, serials, line.Note, userID, transitID); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		return tx.Model(transfer).Updates(map[string]interface{}{
+			"status":      models.TransferReceived,
+			"received_by": userID,
+			"received_at": now,
+		}).Error
+	})
+}
+
+// Cancel a transfer that has not been shipped
+func CancelStockTransfer(c *gin.Context) {
+	processStockTransfer(c, models.TransferRequested, func(tx *gorm.DB, transfer *models.StockTransfer, _ map[uint]TransferLineRequest, _, _ uint) error {
+		if err := checkLocationAccess(c, transfer.FromLocationID, transfer.ToLocationID); err != nil {
+			return err
+		}
+		return tx.Model(transfer).Update("status", models.TransferCancelled).Error
+	})
+}
+
+// processStockTransfer loads and locks a transfer in the expected status and
+// runs one step of its lifecycle inside a database transaction.
+func processStockTransfer(c *gin.Context, expected string, step func(tx *gorm.DB, transfer *models.StockTransfer, lines map[uint]TransferLineRequest, userID, transitID uint) error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid stock transfer ID", err)
+		return
+	}
+
+	var req TransferLinesRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			utils.ValidationErrorResponse(c, "Validation error", map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	lines := make(map[uint]TransferLineRequest, len(req.Items))
+	for _, line := range req.Items {
+		lines[line.ItemID] = line
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		utils.ErrorResponse(c, "User not authenticated", nil)
+		return
+	}
+
+	db := database.GetDB()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var transfer models.StockTransfer
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Items.Product").Preload("Items.Lots").Preload("Items.Serials.SerialNumber").
+			First(&transfer, id).Error; err != nil {
+			return fmt.Errorf("stock transfer not found")
+		}
+
+		if transfer.Status != expected {
+			return fmt.Errorf("stock transfer is %s, expected %s", transfer.Status, expected)
+		}
+
+		for itemID := range lines {
+			found := false
+			for _, item := range transfer.Items {
+				if item.ID == itemID {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("item %d is not on this transfer", itemID)
+			}
+		}
+
+		transitID, err := inventory.TransitLocationID(tx)
+		if err != nil {
+			return err
+		}
+
+		return step(tx, &transfer, lines, userID, transitID)
+	})
+	if errors.Is(err, errLocationAccess) {
+		utils.ForbiddenResponse(c, err.Error())
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, "Failed to update stock transfer", err)
+		return
+	}
+
+	transfer, _ := loadStockTransfer(db, uint(id))
+	utils.SuccessResponse(c, "Stock transfer updated successfully", transfer)
+}
+
+func loadStockTransfer(db *gorm.DB, id uint) (*models.StockTransfer, error) {
+	var transfer models.StockTransfer
+	err := db.Preload("FromLocation").Preload("ToLocation").
+		Preload("Items.Product").Preload("Items.Lots.StockLot").Preload("Items.Serials.SerialNumber").
+		First(&transfer, id).Error
+	return &transfer, err
+}
+
+// shipTransferItem moves one line from the source into transit
+func shipTransferItem(tx *gorm.DB, transfer *models.StockTransfer, item *models.StockTransferItem, qty int, serials []string, userID, transitID uint) error {
+	if item.Product.TrackSerials {
+		if err := inventory.CheckSerials(serials, qty); err != nil {
+			return fmt.Errorf("product %s: %w", item.Product.Name, err)
+		}
+
+		units, err := inventory.RelocateSerials(tx, item.ProductID, transfer.FromLocationID, transitID, serials)
+		if err != nil {
+			return err
+		}
+
+		for _, unit := range units {
+			if err := tx.Create(&models.StockTransferItemSerial{
+				StockTransferItemID: item.ID,
+				SerialNumberID:      unit.ID,
+			}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	relocated, err := inventory.Relocate(tx, inventory.Relocation{
+		ProductID:      item.ProductID,
+		FromLocationID: transfer.FromLocationID,
+		ToLocationID:   transitID,
+		Quantity:       qty,
+		ReferenceType:  "stock_transfer",
+		ReferenceID:    transfer.ID,
+		UserID:         userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, lot := range relocated {
+		if err := tx.Create(&models.StockTransferItemLot{
+			StockTransferItemID: item.ID,
+			StockLotID:          lot.LotID,
+			Quantity:            lot.Quantity,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(item).Update("quantity_shipped", qty).Error
+}
+
+// receiveTransferItem moves one line from transit to the destination. Goods
+// missing on arrival are written off from transit, and extra goods are
+// booked in at the destination, so the ledger balances on both sides.
+func receiveTransferItem(tx *gorm.DB, transfer *models.StockTransfer, item *models.StockTransferItem, received int, serials []string, note string, userID, transitID uint) error {
+	ref := inventory.Relocation{
+		ProductID:      item.ProductID,
+		FromLocationID: transitID,
+		ToLocationID:   transfer.ToLocationID,
+		IncludeExpired: true,
+		ReferenceType:  "stock_transfer",
+		ReferenceID:    transfer.ID,
+		UserID:         userID,
+		Note:           note,
+	}
+	variance := inventory.Movement{
+		ProductID:      item.ProductID,
+		Type:           models.MovementTransferVariance,
+		ReferenceType:  "stock_transfer",
+		ReferenceID:    transfer.ID,
+		UserID:         userID,
+		Note:           note,
+		IncludeExpired: true,
+	}
+
+	if item.Product.TrackSerials {
+		if serials == nil {
+			for _, shipped := range item.Serials {
+				serials = append(serials, shipped.SerialNumber.Serial)
+			}
+		}
+		if err := receiveTransferSerials(tx, transfer, item, serials, transitID); err != nil {
+			return err
+		}
+		received = len(serials)
+	}
+
+	shipped := item.QuantityShipped
+	moved := received
+	if moved > shipped {
+		moved = shipped
+	}
+
+	if len(item.Lots) > 0 {
+		// Move the specific lots shipped on this line, writing off whatever
+		// did not arrive
+		remaining := moved
+		for _, lot := range item.Lots {
+			lotID := lot.StockLotID
+			take := lot.Quantity
+			if take > remaining {
+				take = remaining
+			}
+			remaining -= take
+
+			if take > 0 {
+				lotRef := ref
+				lotRef.Quantity = take
+				lotRef.FromLotID = &lotID
+				if _, err := inventory.Relocate(tx, lotRef); err != nil {
+					return err
+				}
+			}
+
+			if missing := lot.Quantity - take; missing > 0 {
+				lotVariance := variance
+				lotVariance.LocationID = transitID
+				lotVariance.Quantity = -missing
+				lotVariance.FromLotID = &lotID
+				if _, err := inventory.Move(tx, lotVariance); err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		if moved > 0 {
+			ref.Quantity = moved
+			if _, err := inventory.Relocate(tx, ref); err != nil {
+				return err
+			}
+		}
+
+		if missing := shipped - moved; missing > 0 {
+			variance.LocationID = transitID
+			variance.Quantity = -missing
+			if _, err := inventory.Move(tx, variance); err != nil {
+				return err
+			}
+		}
+	}
+
+	if extra := received - shipped; extra > 0 {
+		variance.LocationID = transfer.ToLocationID
+		variance.Quantity = extra
+		variance.FromLotID = nil
+		variance.LotNumber = transfer.TransferNo
+		if _, err := inventory.Move(tx, variance); err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(item).Updates(map[string]interface{}{
+		"quantity_received": received,
+		"discrepancy":       received - shipped,
+		"discrepancy_note":  note,
+	}).Error
+}
+
+// receiveTransferSerials moves the serials that arrived to the destination
+// and marks the rest of the shipped units as missing.
+func receiveTransferSerials(tx *gorm.DB, transfer *models.StockTransfer, item *models.StockTransferItem, serials []string, transitID uint) error {
+	arrived := make(map[string]bool, len(serials))
+	for _, serial := range serials {
+		arrived[serial] = true
+	}
+
+	for _, shipped := range item.Serials {
+		unit := shipped.SerialNumber
+		if !arrived[unit.Serial] {
+			if err := tx.Model(&unit).Update("status", models.SerialMissing).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		delete(arrived, unit.Serial)
+		if _, err := inventory.RelocateSerials(tx, item.ProductID, transitID, transfer.ToLocationID, []string{unit.Serial}); err != nil {
+			return err
+		}
+		if err := tx.Model(&shipped).Update("received", true).Error; err != nil {
+			return err
+		}
+	}
+
+	for serial := range arrived {
+		return fmt.Errorf("serial %s was not shipped on this transfer", serial)
+	}
+	return nil
+}
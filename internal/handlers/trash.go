@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/trash"
+	"POS-Golang/internal/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// How long deleted records stay in the trash, set at startup
+var trashRetention time.Duration
+
+// SetTrashRetention sets how long deleted records are kept before the
+// automatic purge removes them; zero keeps them for good
+func SetTrashRetention(retention time.Duration) {
+	trashRetention = retention
+}
+
+// Get the number of records of each type in the trash
+func GetTrash(c *gin.Context) {
+	counts, err := trash.Counts(database.GetDB())
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch trash", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Trash fetched successfully", gin.H{
+		"types":          trash.Types,
+		"counts":         counts,
+		"retention_days": int(trashRetention.Hours() / 24),
+	})
+}
+
+// Get the records of one type in the trash, most recently deleted first
+func GetTrashItems(c *gin.Context) {
+	recordType := c.Param("type")
+	if !trash.Valid(recordType) {
+		utils.ErrorResponse(c, fmt.Sprintf("Invalid type %q: must be %s", recordType, strings.Join(trash.Types, ", ")), nil)
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+
+	items, total, err := trash.List(database.GetDB(), recordType, c.Query("search"), (page-1)*limit, limit, trashRetention)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch trash", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Trash fetched successfully", gin.H{
+		"type":  recordType,
+		"items": items,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// Restore a record from the trash
+func RestoreTrashItem(c *gin.Context) {
+	recordType, id, ok := trashItemParams(c)
+	if !ok {
+		return
+	}
+
+	userID := trashUserID(c)
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		return trash.Restore(tx, recordType, id, userID)
+	})
+	if errors.Is(err, trash.ErrNotFound) {
+		utils.NotFoundResponse(c, "Record not found in the trash")
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(c, "Cannot restore record", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Record restored successfully", nil)
+}
+
+// Delete a record in the trash for good, without waiting for the retention
+// period to pass
+func PurgeTrashItem(c *gin.Context) {
+	recordType, id, ok := trashItemParams(c)
+	if !ok {
+		return
+	}
+
+	userID := trashUserID(c)
+	var files []string
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		files, err = trash.Purge(tx, recordType, id, userID)
+		return err
+	})
+
+	var inUse *trash.InUseError
+	switch {
+	case errors.Is(err, trash.ErrNotFound):
+		utils.NotFoundResponse(c, "Record not found in the trash")
+		return
+	case errors.As(err, &inUse):
+		c.JSON(http.StatusConflict, utils.Response{
+			Success: false,
+			Message: "Record is still in use and cannot be purged",
+			Error:   err.Error(),
+		})
+		return
+	case err != nil:
+		utils.ErrorResponse(c, "Failed to purge record", err)
+		return
+	}
+
+	trash.RemoveFiles(c.Request.Context(), imageStorage, files)
+	utils.SuccessResponse(c, "Record purged successfully", nil)
+}
+
+// Purge every record past the retention period now, as the background
+// purge would
+func PurgeExpiredTrash(c *gin.Context) {
+	if trashRetention <= 0 {
+		utils.ErrorResponse(c, "No retention period is set, so nothing expires", nil)
+		return
+	}
+
+	purged, kept, err := trash.PurgeExpired(database.GetDB(), imageStorage, trashRetention, time.Now())
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to purge trash", err)
+		return
+	}
+
+	utils.SuccessResponse(c, fmt.Sprintf("Purged %d records", purged), gin.H{
+		"purged": purged,
+		"kept":   kept,
+	})
+}
+
+// Get the trash audit log: records deleted, restored and purged, and by
+// whom
+func GetTrashEvents(c *gin.Context) {
+	query := database.GetDB().Preload("User")
+
+	if recordType := c.Query("type"); recordType != "" {
+		query = query.Where("record_type = ?", recordType)
+	}
+	if recordID := c.Query("record_id"); recordID != "" {
+		query = query.Where("record_id = ?", recordID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+
+	var total int64
+	query.Model(&models.TrashEvent{}).Count(&total)
+
+	var events []models.TrashEvent
+	if err := query.Order("id DESC").Offset((page - 1) * limit).Limit(limit).Find(&events).Error; err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch trash log", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Trash log fetched successfully", gin.H{
+		"events": events,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// trashItemParams reads the record type and ID from the URL, writing the
+// error response when they are not valid
+func trashItemParams(c *gin.Context) (string, uint, bool) {
+	recordType := c.Param("type")
+	if !trash.Valid(recordType) {
+		utils.ErrorResponse(c, fmt.Sprintf("Invalid type %q: must be %s", recordType, strings.Join(trash.Types, ", ")), nil)
+		return "", 0, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		utils.ErrorResponse(c, "Invalid record ID", err)
+		return "", 0, false
+	}
+	return recordType, uint(id), true
+}
+
+// trashUserID is the user to record in the trash audit log
+func trashUserID(c *gin.Context) *uint {
+	if userID, ok := currentUserID(c); ok {
+		return &userID
+	}
+	return nil
+}
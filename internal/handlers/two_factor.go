@@ -0,0 +1,736 @@
+package handlers
+
+import (
+	"POS-Golang/internal/auth"
+	"POS-Golang/internal/database"
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/utils"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	recoveryCodeCount = 10
+	// A login challenge has to be answered within loginChallengeTTL and
+	// stops working after loginChallengeAttempts wrong codes
+	loginChallengeTTL      = 5 * time.Minute
+	loginChallengeAttempts = 5
+)
+
+type ChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code"`          // from the authenticator app
+	RecoveryCode   string `json:"recovery_code"` // instead of a code, when the app is lost
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code"` // needed when two-factor sign-in is on
+}
+
+var (
+	errChallengeInvalid = errors.New("login challenge is invalid or has expired")
+	errCodeInvalid      = errors.New("invalid code")
+	errTwoFactorEnabled = errors.New("two-factor sign-in is already set up")
+)
+
+// twoFactorRequired reports whether a role makes its users use two-factor
+// sign-in
+func twoFactorRequired(db *gorm.DB, role string) (bool, error) {
+	var required []bool
+	err := db.Model(&models.Role{}).Where("name = ?", role).Pluck("require_two_factor", &required).Error
+	return len(required) > 0 && required[0], err
+}
+
+// findTwoFactor returns a user's TOTP secret, or nil if they have none
+func findTwoFactor(db *gorm.DB, userID uint) (*models.TwoFactor, error) {
+	var rows []models.TwoFactor
+	if err := db.Where("user_id = ?", userID).Limit(1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// usesTwoFactor reports whether the user signs in with two-factor, because
+// they turned it on or their role requires it
+func usesTwoFactor(db *gorm.DB, user *models.User) (bool, error) {
+	twoFactor, err := findTwoFactor(db, user.ID)
+	if err != nil {
+		return false, err
+	}
+	if twoFactor != nil && twoFactor.EnabledAt != nil {
+		return true, nil
+	}
+	return twoFactorRequired(db, user.Role)
+}
+
+// startTwoFactor hands out a login challenge in place of tokens when the
+// user has two-factor sign-in on or their role requires it, and reports
+// whether it did
+func startTwoFactor(c *gin.Context, db *gorm.DB, user *models.User, username string) (bool, error) {
+	twoFactor, err := findTwoFactor(db, user.ID)
+	if err != nil {
+		return false, err
+	}
+	enabled := twoFactor != nil && twoFactor.EnabledAt != nil
+	required, err := twoFactorRequired(db, user.Role)
+	if err != nil {
+		return false, err
+	}
+	if !enabled && !required {
+		return false, nil
+	}
+
+	token, hash, err := auth.NewSecret("mfa_")
+	if err != nil {
+		return false, err
+	}
+	challenge := models.LoginChallenge{
+		TokenHash: hash,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(loginChallengeTTL),
+	}
+	if err := db.Create(&challenge).Error; err != nil {
+		return false, err
+	}
+	recordLoginAttempt(c, models.LoginPassword, username, user, nil, models.LoginTwoFactorRequired)
+
+	// Users whose role requires it but who have not set it up yet do so
+	// now, before they get in
+	message := "Enter the code from your authenticator app"
+	if !enabled {
+		message = "Set up two-factor sign-in to continue"
+	}
+	utils.SuccessResponse(c, message, gin.H{
+		"two_factor_required": true,
+		"enrollment_required": !enabled,
+		"challenge_token":     token,
+		"expires_at":          challenge.ExpiresAt,
+	})
+	return true, nil
+}
+
+// findChallenge returns the login challenge with a token while it can
+// still be answered
+func findChallenge(db *gorm.DB, token string) (*models.LoginChallenge, error) {
+	var challenge models.LoginChallenge
+	if err := db.Where("token_hash = ?", auth.HashSecret(token)).First(&challenge).Error; err != nil {
+		return nil, errChallengeInvalid
+	}
+	if time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= loginChallengeAttempts {
+		return nil, errChallengeInvalid
+	}
+	return &challenge, nil
+}
+
+// challengeFailed writes the response for a login challenge that does not
+// work, so the user has to log in with their password again
+func challengeFailed(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, utils.Response{
+		Success: false,
+		Message: "Login has expired, please log in again",
+		Error:   errChallengeInvalid.Error(),
+	})
+}
+
+// newPendingTwoFactor gives a user a new TOTP secret, pending until they
+// enter a code from it. A secret already turned on is not replaced.
+func newPendingTwoFactor(db *gorm.DB, user *models.User) (*auth.TOTPKey, error) {
+	twoFactor, err := findTwoFactor(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor != nil && twoFactor.EnabledAt != nil {
+		return nil, errTwoFactorEnabled
+	}
+
+	key, err := auth.NewTOTPKey(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	row := models.TwoFactor{UserID: user.ID, Secret: key.Secret}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "enabled_at", "last_step", "updated_at"}),
+	}).Create(&row).Error; err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// useCode checks a code from the authenticator app, or when allowRecovery
+// a recovery code, and uses it up
+func useCode(tx *gorm.DB, twoFactor *models.TwoFactor, code, recoveryCode string, allowRecovery bool) error {
+	if code != "" {
+		step, ok := auth.CheckTOTP(twoFactor.Secret, code, twoFactor.LastStep, time.Now())
+		if !ok {
+			return errCodeInvalid
+		}
+		// Only moving the step forward stops two requests racing with the
+		// same code from both getting in
+		result := tx.Model(&models.TwoFactor{}).Where("user_id = ? AND last_step < ?", twoFactor.UserID, step).
+			UpdateColumn("last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errCodeInvalid
+		}
+		twoFactor.LastStep = step
+		return nil
+	}
+
+	if recoveryCode == "" || !allowRecovery {
+		return errCodeInvalid
+	}
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", twoFactor.UserID, auth.HashRecoveryCode(recoveryCode)).
+		UpdateColumn("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errCodeInvalid
+	}
+	return nil
+}
+
+// enableTwoFactor turns on a pending TOTP secret and returns the user's
+// new recovery codes
+func enableTwoFactor(tx *gorm.DB, twoFactor *models.TwoFactor) ([]string, error) {
+	now := time.Now()
+	if err := tx.Model(&models.TwoFactor{}).Where("user_id = ?", twoFactor.UserID).
+		UpdateColumn("enabled_at", now).Error; err != nil {
+		return nil, err
+	}
+	twoFactor.EnabledAt = &now
+	return replaceRecoveryCodes(tx, twoFactor.UserID)
+}
+
+// replaceRecoveryCodes gives a user new recovery codes, and the old ones
+// stop working
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes, hashes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]models.RecoveryCode, len(hashes))
+	for i, hash := range hashes {
+		rows[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Set up two-factor sign-in while logging in, for a user whose role
+// requires it and who has not set it up yet. Entering a code from the app
+// then finishes the login.
+func EnrollTwoFactorLogin(c *gin.Context) {
+	var req ChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Invalid request", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation failed", map[string]string{"error": err.Error()})
+		return
+	}
+
+	db := database.GetDB()
+	challenge, err := findChallenge(db, req.ChallengeToken)
+	if err != nil {
+		challengeFailed(c)
+		return
+	}
+	var user models.User
+	if err := db.First(&user, challenge.UserID).Error; err != nil {
+		challengeFailed(c)
+		return
+	}
+
+	key, err := newPendingTwoFactor(db, &user)
+	if errors.Is(err, errTwoFactorEnabled) {
+		c.JSON(http.StatusConflict, utils.Response{
+			Success: false,
+			Message: "Two-factor sign-in is already set up, enter a code from your app",
+		})
+		return
+	}
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to set up two-factor sign-in", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Scan the QR code with your authenticator app, then enter a code from it", key)
+}
+
+// Finish a login with a code from the authenticator app or a recovery
+// code. For a user setting up two-factor sign-in as they log in, the code
+// turns it on, and their recovery codes are only shown in this response.
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Invalid request", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation failed", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if req.Code == "" && req.RecoveryCode == "" {
+		utils.ValidationErrorResponse(c, "Validation failed", map[string]string{"code": "a code or a recovery code is required"})
+		return
+	}
+
+	db := database.GetDB()
+	challenge, err := findChallenge(db, req.ChallengeToken)
+	if err != nil {
+		challengeFailed(c)
+		return
+	}
+	var user models.User
+	if err := db.First(&user, challenge.UserID).Error; err != nil {
+		challengeFailed(c)
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	if wait, err := accountLimiter.Blocked(accountKey(user.ID)); err != nil || wait > 0 {
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to check login attempts", err)
+			return
+		}
+		recordLoginAttempt(c, models.LoginTwoFactor, user.Username, &user, nil, models.LoginAccountLocked)
+		lockedOut(c, "Account locked after too many failed logins, try again later", wait)
+		return
+	}
+
+	twoFactor, err := findTwoFactor(db, user.ID)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to check code", err)
+		return
+	}
+	if twoFactor == nil {
+		utils.ErrorResponse(c, "Set up two-factor sign-in first", nil)
+		return
+	}
+	enrolling := twoFactor.EnabledAt == nil
+
+	var recoveryCodes []string
+	var tokens *auth.Tokens
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Using up the challenge first makes it work only once, even for
+		// two requests racing
+		result := tx.Where("id = ?", challenge.ID).Delete(&models.LoginChallenge{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errChallengeInvalid
+		}
+
+		if err := useCode(tx, twoFactor, req.Code, req.RecoveryCode, !enrolling); err != nil {
+			return err
+		}
+		if enrolling {
+			codes, err := enableTwoFactor(tx, twoFactor)
+			if err != nil {
+				return err
+			}
+			recoveryCodes = codes
+		}
+
+		var err error
+		tokens, err = auth.Login(tx, &user, c.Request.UserAgent(), c.ClientIP(), nil)
+		return err
+	})
+	switch {
+	case errors.Is(err, errCodeInvalid):
+		if err := db.Model(&models.LoginChallenge{}).Where("id = ?", challenge.ID).
+			UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+			log.Printf("login challenge: %v", err)
+		}
+		loginFailed(ipKey(c.ClientIP()), accountKey(user.ID))
+		recordLoginAttempt(c, models.LoginTwoFactor, user.Username, &user, nil, models.LoginInvalidCode)
+		c.JSON(http.StatusUnauthorized, utils.Response{
+			Success: false,
+			Message: "Invalid code",
+		})
+		return
+	case errors.Is(err, errChallengeInvalid):
+		challengeFailed(c)
+		return
+	case err != nil:
+		utils.InternalServerErrorResponse(c, "Failed to generate token", err)
+		return
+	}
+
+	if err := accountLimiter.Reset(accountKey(user.ID)); err != nil {
+		log.Printf("login limiter: %v", err)
+	}
+	recordLoginAttempt(c, models.LoginTwoFactor, user.Username, &user, nil, "")
+
+	permissions, err := auth.RolePermissions(db, user.Role)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to load permissions", err)
+		return
+	}
+
+	data := loginData(&user, tokens, permissions)
+	if recoveryCodes != nil {
+		data["recovery_codes"] = recoveryCodes
+	}
+	utils.SuccessResponse(c, "Login successful", data)
+}
+
+// Get whether the signed-in user has two-factor sign-in on, whether their
+// role requires it and how many recovery codes they have left
+func GetMyTwoFactor(c *gin.Context) {
+	userID, _ := currentUserID(c)
+	db := database.GetDB()
+
+	twoFactor, err := findTwoFactor(db, userID)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch two-factor sign-in", err)
+		return
+	}
+	required, err := twoFactorRequired(db, c.GetString("role"))
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to fetch two-factor sign-in", err)
+		return
+	}
+
+	var left int64
+	db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&left)
+
+	status := gin.H{
+		"enabled":             twoFactor != nil && twoFactor.EnabledAt != nil,
+		"pending":             twoFactor != nil && twoFactor.EnabledAt == nil,
+		"required":            required,
+		"recovery_codes_left": left,
+	}
+	if twoFactor != nil {
+		status["enabled_at"] = twoFactor.EnabledAt
+	}
+	utils.SuccessResponse(c, "Two-factor sign-in fetched successfully", status)
+}
+
+// Start setting up two-factor sign-in for the signed-in user. It is turned
+// on once a code from the app is confirmed.
+func EnrollTwoFactor(c *gin.Context) {
+	userID, _ := currentUserID(c)
+	db := database.GetDB()
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		utils.NotFoundResponse(c, "User not found")
+		return
+	}
+
+	key, err := newPendingTwoFactor(db, &user)
+	if errors.Is(err, errTwoFactorEnabled) {
+		c.JSON(http.StatusConflict, utils.Response{
+			Success: false,
+			Message: "Two-factor sign-in is already set up",
+		})
+		return
+	}
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to set up two-factor sign-in", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Scan the QR code with your authenticator app, then confirm a code from it", key)
+}
+
+// Confirm a code from the app, turning two-factor sign-in on. The recovery
+// codes are only shown in this response.
+func ConfirmTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if !bindTwoFactorCode(c, &req) {
+		return
+	}
+
+	userID, _ := currentUserID(c)
+	if codesLockedOut(c, userID) {
+		return
+	}
+	db := database.GetDB()
+	twoFactor, err := findTwoFactor(db, userID)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to confirm two-factor sign-in", err)
+		return
+	}
+	if twoFactor == nil {
+		utils.ErrorResponse(c, "Start setting up two-factor sign-in first", nil)
+		return
+	}
+	if twoFactor.EnabledAt != nil {
+		c.JSON(http.StatusConflict, utils.Response{
+			Success: false,
+			Message: "Two-factor sign-in is already set up",
+		})
+		return
+	}
+
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := useCode(tx, twoFactor, req.Code, "", false); err != nil {
+			return err
+		}
+		var err error
+		codes, err = enableTwoFactor(tx, twoFactor)
+		return err
+	})
+	if errors.Is(err, errCodeInvalid) {
+		loginFailed(ipKey(c.ClientIP()), accountKey(userID))
+		utils.ErrorResponse(c, "Invalid code", nil)
+		return
+	}
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to confirm two-factor sign-in", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Two-factor sign-in turned on, keep the recovery codes somewhere safe", gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// Replace the signed-in user's recovery codes, as done when they run low or
+// may have been seen. It takes a code from the app.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if !bindTwoFactorCode(c, &req) {
+		return
+	}
+
+	userID, _ := currentUserID(c)
+	if codesLockedOut(c, userID) {
+		return
+	}
+	db := database.GetDB()
+	twoFactor, err := findTwoFactor(db, userID)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to replace recovery codes", err)
+		return
+	}
+	if twoFactor == nil || twoFactor.EnabledAt == nil {
+		utils.ErrorResponse(c, "Two-factor sign-in is not on", nil)
+		return
+	}
+
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := useCode(tx, twoFactor, req.Code, "", false); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if errors.Is(err, errCodeInvalid) {
+		loginFailed(ipKey(c.ClientIP()), accountKey(userID))
+		utils.ErrorResponse(c, "Invalid code", nil)
+		return
+	}
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to replace recovery codes", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Recovery codes replaced, the old ones no longer work", gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// Turn off the signed-in user's two-factor sign-in. It takes their password
+// and a code from the app, and is refused while their role requires it.
+func DisableTwoFactor(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Invalid request", map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation failed", map[string]string{"error": err.Error()})
+		return
+	}
+
+	userID, _ := currentUserID(c)
+	db := database.GetDB()
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		utils.NotFoundResponse(c, "User not found")
+		return
+	}
+
+	required, err := twoFactorRequired(db, user.Role)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to turn off two-factor sign-in", err)
+		return
+	}
+	if required {
+		c.JSON(http.StatusConflict, utils.Response{
+			Success: false,
+			Message: "Your role requires two-factor sign-in",
+		})
+		return
+	}
+
+	if wait, err := accountLimiter.Blocked(accountKey(user.ID)); err != nil || wait > 0 {
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to check login attempts", err)
+			return
+		}
+		lockedOut(c, "Too many wrong passwords, try again later", wait)
+		return
+	}
+	if !user.CheckPassword(req.Password) {
+		loginFailed(ipKey(c.ClientIP()), accountKey(user.ID))
+		c.JSON(http.StatusUnauthorized, utils.Response{
+			Success: false,
+			Message: "Password is wrong",
+		})
+		return
+	}
+
+	twoFactor, err := findTwoFactor(db, user.ID)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to turn off two-factor sign-in", err)
+		return
+	}
+	if twoFactor == nil {
+		utils.SuccessResponse(c, "Two-factor sign-in turned off", nil)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if twoFactor.EnabledAt != nil {
+			if err := useCode(tx, twoFactor, req.Code, "", false); err != nil {
+				return err
+			}
+		}
+		return removeTwoFactor(tx, user.ID)
+	})
+	if errors.Is(err, errCodeInvalid) {
+		loginFailed(ipKey(c.ClientIP()), accountKey(userID))
+		utils.ErrorResponse(c, "Invalid code", nil)
+		return
+	}
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to turn off two-factor sign-in", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Two-factor sign-in turned off", nil)
+}
+
+// Reset a user's two-factor sign-in for them, as done when they have lost
+// both their authenticator app and their recovery codes. If their role
+// requires it they set it up again when they next log in.
+func ResetUserTwoFactor(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, "Invalid user ID", err)
+		return
+	}
+
+	db := database.GetDB()
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		utils.NotFoundResponse(c, "User not found")
+		return
+	}
+
+	// Otherwise a manager could weaken the sign-in of an admin
+	allowed, err := canGrantRole(c, db, user.Role)
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to check role", err)
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, utils.Response{
+			Success: false,
+			Message: "You cannot reset the two-factor sign-in of a user with permissions you do not have",
+		})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := removeTwoFactor(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.LoginChallenge{}).Error
+	})
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to reset two-factor sign-in", err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Two-factor sign-in reset successfully", nil)
+}
+
+// removeTwoFactor deletes a user's TOTP secret and recovery codes
+func removeTwoFactor(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.TwoFactor{}).Error
+}
+
+// codesLockedOut writes the response and returns true while wrong codes or
+// passwords have the user locked out, so codes cannot be guessed from a
+// signed-in session either
+func codesLockedOut(c *gin.Context, userID uint) bool {
+	wait, err := accountLimiter.Blocked(accountKey(userID))
+	if err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to check login attempts", err)
+		return true
+	}
+	if wait > 0 {
+		lockedOut(c, "Too many wrong codes, try again later", wait)
+		return true
+	}
+	return false
+}
+
+func bindTwoFactorCode(c *gin.Context, req *TwoFactorCodeRequest) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		utils.ValidationErrorResponse(c, "Invalid request", map[string]string{"error": err.Error()})
+		return false
+	}
+
+	if err := validate.Struct(req); err != nil {
+		utils.ValidationErrorResponse(c, "Validation failed", map[string]string{"error": err.Error()})
+		return false
+	}
+	return true
+}
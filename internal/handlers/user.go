@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"POS-Golang/internal/auth"
 	"POS-Golang/internal/database"
 	"POS-Golang/internal/models"
+	"POS-Golang/internal/trash"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // Get all users with pagination and filter
@@ -32,6 +35,9 @@ func GetUsers(c *gin.Context) {
 	if role != "" {
 		query = query.Where("role = ?", role)
 	}
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Where("location_id = ?", locationID)
+	}
 
 	var total int64
 	query.Count(&total)
@@ -52,6 +58,15 @@ func GetUsers(c *gin.Context) {
 	})
 }
 
+// locationExists reports whether an optional store assignment is valid
+func locationExists(locationID *uint) bool {
+	if locationID == nil {
+		return true
+	}
+	var location models.Location
+	return database.GetDB().First(&location, *locationID).Error == nil
+}
+
 // Create user (Admin only)
 func CreateUser(c *gin.Context) {
 	var req RegisterRequest
@@ -73,11 +88,36 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
+	if !locationExists(req.LocationID) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Location not found"})
+		return
+	}
+
+	if !roleExists(db, req.Role) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Role not found"})
+		return
+	}
+
+	// Only admins hand out roles with permissions they do not have
+	if allowed, err := canGrantRole(c, db, req.Role); err != nil || !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You cannot give a role with permissions you do not have"})
+		return
+	}
+
 	user := models.User{
-		Username: req.Username,
-		Email:    req.Email,
-		Password: req.Password,
-		Role:     req.Role,
+		Username:   req.Username,
+		Email:      req.Email,
+		Password:   req.Password,
+		Role:       req.Role,
+		LocationID: req.LocationID,
+	}
+	if req.MustChangePassword != nil {
+		user.MustChangePassword = *req.MustChangePassword
+	}
+
+	if err := auth.CheckPassword(req.Password, &user); err != nil {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
 	}
 
 	if err := user.HashPassword(); err != nil {
@@ -94,10 +134,12 @@ func CreateUser(c *gin.Context) {
 		"success": true,
 		"message": "User created successfully",
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"role":     user.Role,
+			"id":                   user.ID,
+			"username":             user.Username,
+			"email":                user.Email,
+			"role":                 user.Role,
+			"location_id":          user.LocationID,
+			"must_change_password": user.MustChangePassword,
 		},
 	})
 }
@@ -124,25 +166,71 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// Only admins change users whose role has permissions they do not have
+	if allowed, err := canGrantRole(c, db, user.Role); err != nil || !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You cannot change a user with permissions you do not have"})
+		return
+	}
+
 	var existingUser models.User
 	if err := db.Where("(username = ? OR email = ?) AND id != ?", req.Username, req.Email, id).First(&existingUser).Error; err == nil {
 		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Username or email already taken"})
 		return
 	}
 
+	if !locationExists(req.LocationID) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Location not found"})
+		return
+	}
+
+	if !roleExists(db, req.Role) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Role not found"})
+		return
+	}
+
+	// Only admins hand out roles with permissions they do not have
+	if allowed, err := canGrantRole(c, db, req.Role); err != nil || !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You cannot give a role with permissions you do not have"})
+		return
+	}
+
+	// A new role or password signs the user out everywhere
+	revokeReason := ""
+	if req.Role != user.Role {
+		revokeReason = models.RevokeRoleChanged
+	}
+
 	user.Username = req.Username
 	user.Email = req.Email
 	user.Role = req.Role
+	user.LocationID = req.LocationID
+	if req.MustChangePassword != nil {
+		user.MustChangePassword = *req.MustChangePassword
+	}
 
 	if req.Password != "" {
+		if err := auth.CheckPassword(req.Password, &user); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
 		user.Password = req.Password
 		if err := user.HashPassword(); err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 			return
 		}
+		revokeReason = models.RevokePasswordChanged
 	}
 
-	if err := db.Save(&user).Error; err != nil {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if revokeReason == "" {
+			return nil
+		}
+		return auth.RevokeUser(tx, user.ID, revokeReason)
+	})
+	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
@@ -151,10 +239,12 @@ func UpdateUser(c *gin.Context) {
 		"success": true,
 		"message": "User updated successfully",
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"role":     user.Role,
+			"id":                   user.ID,
+			"username":             user.Username,
+			"email":                user.Email,
+			"role":                 user.Role,
+			"location_id":          user.LocationID,
+			"must_change_password": user.MustChangePassword,
 		},
 	})
 }
@@ -181,7 +271,22 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
-	if err := db.Delete(&user).Error; err != nil {
+	// Otherwise a manager could remove an admin
+	if allowed, err := canGrantRole(c, db, user.Role); err != nil || !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You cannot delete a user with permissions you do not have"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		if err := auth.RevokeUser(tx, user.ID, models.RevokeUserDeleted); err != nil {
+			return err
+		}
+		return trash.Record(tx, models.TrashDeleted, trash.Users, user.ID, user.Username, trashUserID(c))
+	})
+	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
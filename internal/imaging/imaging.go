@@ -0,0 +1,122 @@
+// Package imaging checks uploaded images and makes their thumbnails.
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the WebP decoder
+)
+
+// Limits on uploaded images
+const (
+	MaxPixels     = 40_000_000 // refuses images that would take too much memory to decode
+	ThumbnailSize = 320        // longest side of a thumbnail, in pixels
+)
+
+// Image formats accepted for upload, by content type, with the file
+// extension they are stored under
+var formats = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Image is a checked upload and its thumbnail
+type Image struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+
+	Thumbnail            []byte
+	ThumbnailContentType string
+	ThumbnailExtension   string
+}
+
+// Process checks that data is a JPEG, PNG, GIF or WebP image of a sensible
+// size and makes a thumbnail of it. The upload is kept as it was sent.
+func Process(data []byte) (*Image, error) {
+	contentType := http.DetectContentType(data)
+	extension, ok := formats[contentType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported image type %s: use JPEG, PNG, GIF or WebP", contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", config.Width, config.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+
+	img := &Image{
+		Data:        data,
+		ContentType: contentType,
+		Extension:   extension,
+		Width:       config.Width,
+		Height:      config.Height,
+	}
+
+	// Thumbnails with transparency stay PNG; the rest become JPEG, which is
+	// much smaller for photos
+	thumb := Thumbnail(src, ThumbnailSize)
+	var buf bytes.Buffer
+	if opaque(thumb) {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+		img.ThumbnailContentType, img.ThumbnailExtension = "image/jpeg", ".jpg"
+	} else {
+		err = png.Encode(&buf, thumb)
+		img.ThumbnailContentType, img.ThumbnailExtension = "image/png", ".png"
+	}
+	if err != nil {
+		return nil, err
+	}
+	img.Thumbnail = buf.Bytes()
+	return img, nil
+}
+
+// Thumbnail scales the image down to fit in a size x size square, keeping
+// its proportions. Smaller images are not enlarged.
+func Thumbnail(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			height = max(1, height*size/width)
+			width = size
+		} else {
+			width = max(1, width*size/height)
+			height = size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// opaque reports whether every pixel of the image is fully opaque
+func opaque(img *image.RGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0xff {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,403 @@
+package inventory
+
+import (
+	"POS-Golang/internal/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Cost methods for updating product cost on receipt
+const (
+	CostMethodAverage = "average"
+	CostMethodLast    = "last"
+)
+
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+var costMethod = CostMethodAverage
+
+// SetCostMethod selects how Receive updates a product's cost.
+func SetCostMethod(method string) {
+	costMethod = method
+}
+
+// Movement describes a change to a product's stock at one location.
+// Quantity is signed: positive for stock coming in, negative for going out.
+type Movement struct {
+	ProductID     uint
+	LocationID    uint
+	Type          string
+	Quantity      int
+	UnitCost      float64
+	ReferenceType string
+	ReferenceID   uint
+	UserID        uint
+	Note          string
+
+	// Lot details for stock coming in to a lot-tracked product
+	LotNumber          string
+	ExpiryDate         *time.Time
+	ReceivedDate       *time.Time
+	GoodsReceiptItemID *uint
+
+	// IncludeExpired lets outgoing stock be drawn from expired lots, for
+	// write-offs and corrections. Sales never draw from expired lots.
+	IncludeExpired bool
+
+	// FromLotID draws outgoing stock from one specific lot instead of
+	// picking lots first-expired, first-out.
+	FromLotID *uint
+}
+
+// Move applies a movement to the product's stock at a location and records
+// it in the stock ledger. For lot-tracked products one ledger entry is
+// written per lot touched. It must be called inside a database transaction.
+func Move(tx *gorm.DB, m Movement) ([]models.StockMovement, error) {
+	product, err := lockProduct(tx, m.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	return apply(tx, product, m)
+}
+
+// Receive books incoming stock and updates the product's cost from the
+// landed unit cost using the configured cost method.
+func Receive(tx *gorm.DB, m Movement) ([]models.StockMovement, error) {
+	if m.Quantity <= 0 {
+		return nil, fmt.Errorf("receive quantity must be positive")
+	}
+
+	product, err := lockProduct(tx, m.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	newCost := NextCost(product.Stock, product.Cost, m.Quantity, m.UnitCost)
+	if err := tx.Model(product).UpdateColumn("cost", newCost).Error; err != nil {
+		return nil, err
+	}
+
+	return apply(tx, product, m)
+}
+
+// NextCost returns the product cost after receiving qty units at unitCost.
+// Cost is shared across locations, so onHand is the company-wide stock.
+func NextCost(onHand int, currentCost float64, qty int, unitCost float64) float64 {
+	if costMethod == CostMethodLast || onHand <= 0 {
+		return unitCost
+	}
+	total := float64(onHand)*currentCost + float64(qty)*unitCost
+	return total / float64(onHand+qty)
+}
+
+// StockAt returns the quantity of a product on hand at a location, which is
+// zero when it has never been stocked there.
+func StockAt(db *gorm.DB, productID, locationID uint) (int, error) {
+	var level models.StockLevel
+	err := db.Where("product_id = ? AND location_id = ?", productID, locationID).First(&level).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return level.Quantity, nil
+}
+
+// DefaultLocationID returns the location used when a request is not tied
+// to a particular store.
+func DefaultLocationID(db *gorm.DB) (uint, error) {
+	var location models.Location
+	if err := db.Where("code = ?", models.DefaultLocationCode).First(&location).Error; err != nil {
+		if err := db.Where("type != ?", models.LocationTransit).Order("id").First(&location).Error; err != nil {
+			return 0, fmt.Errorf("no locations configured: %w", err)
+		}
+	}
+	return location.ID, nil
+}
+
+// TransitLocationID returns the system location holding stock in transit
+// between locations, creating it on first use.
+func TransitLocationID(tx *gorm.DB) (uint, error) {
+	location := models.Location{
+		Code:     models.TransitLocationCode,
+		Name:     "In Transit",
+		Type:     models.LocationTransit,
+		IsActive: true,
+	}
+	if err := tx.Where("code = ?", models.TransitLocationCode).FirstOrCreate(&location).Error; err != nil {
+		return 0, err
+	}
+	return location.ID, nil
+}
+
+// StartLotTracking puts a product's existing stock at each location into a
+// single lot so that it can be drawn from once lot tracking is switched on.
+func StartLotTracking(tx *gorm.DB, product *models.Product) error {
+	var levels []models.StockLevel
+	if err := tx.Where("product_id = ? AND quantity > 0", product.ID).Find(&levels).Error; err != nil {
+		return err
+	}
+
+	for _, level := range levels {
+		lot := models.StockLot{
+			ProductID:       product.ID,
+			LocationID:      level.LocationID,
+			LotNumber:       "UNTRACKED",
+			ReceivedDate:    time.Now(),
+			InitialQuantity: level.Quantity,
+			Quantity:        level.Quantity,
+			UnitCost:        product.Cost,
+		}
+		if err := tx.Create(&lot).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lockProduct(tx *gorm.DB, productID uint) (*models.Product, error) {
+	var product models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error; err != nil {
+		return nil, fmt.Errorf("product with ID %d not found: %w", productID, err)
+	}
+	return &product, nil
+}
+
+// lockStockLevel returns the product's stock level row at a location,
+// creating it if the product has never been stocked there.
+func lockStockLevel(tx *gorm.DB, productID, locationID uint) (*models.StockLevel, error) {
+	if locationID == 0 {
+		return nil, fmt.Errorf("stock movement requires a location")
+	}
+
+	level := models.StockLevel{ProductID: productID, LocationID: locationID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&level).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id = ? AND location_id = ?", productID, locationID).
+		First(&level).Error; err != nil {
+		return nil, err
+	}
+	return &level, nil
+}
+
+// updateBalances sets the stock at a location and keeps the product's
+// company-wide total in step.
+func updateBalances(tx *gorm.DB, product *models.Product, level *models.StockLevel, delta int) error {
+	level.Quantity += delta
+	if err := tx.Model(level).UpdateColumn("quantity", level.Quantity).Error; err != nil {
+		return err
+	}
+
+	product.Stock += delta
+	return tx.Model(product).UpdateColumn("stock", product.Stock).Error
+}
+
+func apply(tx *gorm.DB, product *models.Product, m Movement) ([]models.StockMovement, error) {
+	level, err := lockStockLevel(tx, product.ID, m.LocationID)
+	if err != nil {
+		return nil, err
+	}
+
+	onHand := level.Quantity
+	if m.Quantity < 0 && onHand+m.Quantity < 0 {
+		return nil, fmt.Errorf("%w for product %s at this location", ErrInsufficientStock, product.Name)
+	}
+
+	if err := updateBalances(tx, product, level, m.Quantity); err != nil {
+		return nil, err
+	}
+
+	unitCost := m.UnitCost
+	if unitCost == 0 {
+		unitCost = product.Cost
+	}
+
+	entry := models.StockMovement{
+		ProductID:     product.ID,
+		LocationID:    m.LocationID,
+		Type:          m.Type,
+		Quantity:      m.Quantity,
+		BalanceAfter:  level.Quantity,
+		UnitCost:      unitCost,
+		ReferenceType: m.ReferenceType,
+		ReferenceID:   m.ReferenceID,
+		UserID:        m.UserID,
+		Note:          m.Note,
+	}
+
+	var movements []models.StockMovement
+	switch {
+	case !product.TrackLots:
+		movements = append(movements, entry)
+
+	case m.Quantity > 0:
+		lot, err := addLot(tx, product, m, unitCost)
+		if err != nil {
+			return nil, err
+		}
+		entry.StockLotID = &lot.ID
+		movements = append(movements, entry)
+
+	default:
+		allocations, err := consumeLots(tx, product, m.LocationID, -m.Quantity, m.IncludeExpired, m.FromLotID)
+		if err != nil {
+			return nil, err
+		}
+
+		running := onHand
+		for _, alloc := range allocations {
+			lotID := alloc.Lot.ID
+			running -= alloc.Quantity
+
+			lotEntry := entry
+			lotEntry.StockLotID = &lotID
+			lotEntry.Quantity = -alloc.Quantity
+			lotEntry.BalanceAfter = running
+			if m.UnitCost == 0 && alloc.Lot.UnitCost > 0 {
+				lotEntry.UnitCost = alloc.Lot.UnitCost
+			}
+			movements = append(movements, lotEntry)
+		}
+	}
+
+	if err := tx.Create(&movements).Error; err != nil {
+		return nil, err
+	}
+
+	return movements, nil
+}
+
+type lotAllocation struct {
+	Lot      models.StockLot
+	Quantity int
+}
+
+func addLot(tx *gorm.DB, product *models.Product, m Movement, unitCost float64) (*models.StockLot, error) {
+	lotNumber := m.LotNumber
+	if lotNumber == "" {
+		lotNumber = fmt.Sprintf("%s-%d", m.Type, time.Now().Unix())
+	}
+
+	received := time.Now()
+	if m.ReceivedDate != nil {
+		received = *m.ReceivedDate
+	}
+
+	lot := models.StockLot{
+		ProductID:          product.ID,
+		LocationID:         m.LocationID,
+		LotNumber:          lotNumber,
+		ExpiryDate:         m.ExpiryDate,
+		ReceivedDate:       received,
+		InitialQuantity:    m.Quantity,
+		Quantity:           m.Quantity,
+		UnitCost:           unitCost,
+		GoodsReceiptItemID: m.GoodsReceiptItemID,
+	}
+	if err := tx.Create(&lot).Error; err != nil {
+		return nil, err
+	}
+	return &lot, nil
+}
+
+// consumeLots draws qty units from the product's lots at a location in
+// first-expired, first-out order. Lots without an expiry date are used last.
+func consumeLots(tx *gorm.DB, product *models.Product, locationID uint, qty int, includeExpired bool, lotID *uint) ([]lotAllocation, error) {
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id = ? AND location_id = ? AND quantity > 0", product.ID, locationID)
+	if lotID != nil {
+		query = query.Where("id = ?", *lotID)
+	}
+	if !includeExpired {
+		query = query.Where("expiry_date IS NULL OR expiry_date >= ?", time.Now().Format("2006-01-02"))
+	}
+
+	var lots []models.StockLot
+	if err := query.Order("expiry_date IS NULL, expiry_date ASC, received_date ASC, id ASC").Find(&lots).Error; err != nil {
+		return nil, err
+	}
+
+	var allocations []lotAllocation
+	remaining := qty
+	for _, lot := range lots {
+		if remaining == 0 {
+			break
+		}
+
+		take := lot.Quantity
+		if take > remaining {
+			take = remaining
+		}
+		if err := tx.Model(&models.StockLot{}).Where("id = ?", lot.ID).
+			UpdateColumn("quantity", gorm.Expr("quantity - ?", take)).Error; err != nil {
+			return nil, err
+		}
+
+		allocations = append(allocations, lotAllocation{Lot: lot, Quantity: take})
+		remaining -= take
+	}
+
+	if remaining > 0 {
+		return nil, fmt.Errorf("%w for product %s: only %d unexpired units in lots", ErrInsufficientStock, product.Name, qty-remaining)
+	}
+
+	return allocations, nil
+}
+
+// WriteOffLot removes whatever is left of a single lot from stock, typically
+// once it has expired. It must be called inside a database transaction.
+func WriteOffLot(tx *gorm.DB, lotID uint, userID uint, note string) (*models.StockMovement, error) {
+	var lot models.StockLot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&lot, lotID).Error; err != nil {
+		return nil, fmt.Errorf("lot with ID %d not found: %w", lotID, err)
+	}
+	if lot.Quantity == 0 {
+		return nil, fmt.Errorf("lot %s has no remaining stock", lot.LotNumber)
+	}
+
+	product, err := lockProduct(tx, lot.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	level, err := lockStockLevel(tx, lot.ProductID, lot.LocationID)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := lot.Quantity
+	if err := tx.Model(&lot).UpdateColumn("quantity", 0).Error; err != nil {
+		return nil, err
+	}
+
+	if err := updateBalances(tx, product, level, -remaining); err != nil {
+		return nil, err
+	}
+
+	movement := models.StockMovement{
+		ProductID:     product.ID,
+		LocationID:    lot.LocationID,
+		StockLotID:    &lot.ID,
+		Type:          models.MovementWriteOff,
+		Quantity:      -remaining,
+		BalanceAfter:  level.Quantity,
+		UnitCost:      lot.UnitCost,
+		ReferenceType: "stock_lot",
+		ReferenceID:   lot.ID,
+		UserID:        userID,
+		Note:          note,
+	}
+	if err := tx.Create(&movement).Error; err != nil {
+		return nil, err
+	}
+
+	return &movement, nil
+}
@@ -0,0 +1,188 @@
+package inventory
+
+import (
+	"POS-Golang/internal/models"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CheckSerials verifies that exactly qty distinct, non-empty serials were given.
+func CheckSerials(serials []string, qty int) error {
+	if len(serials) != qty {
+		return fmt.Errorf("expected %d serials, got %d", qty, len(serials))
+	}
+
+	seen := make(map[string]bool, len(serials))
+	for _, serial := range serials {
+		serial = strings.TrimSpace(serial)
+		if serial == "" {
+			return fmt.Errorf("serial must not be empty")
+		}
+		if seen[serial] {
+			return fmt.Errorf("serial %s is listed more than once", serial)
+		}
+		seen[serial] = true
+	}
+	return nil
+}
+
+// RegisterSerials records newly received units of a serial-tracked product
+// at a location.
+func RegisterSerials(tx *gorm.DB, productID, locationID uint, serials []string, goodsReceiptItemID *uint) ([]models.SerialNumber, error) {
+	trimmed := make([]string, len(serials))
+	for i, serial := range serials {
+		trimmed[i] = strings.TrimSpace(serial)
+	}
+	serials = trimmed
+
+	var existing []string
+	if err := tx.Model(&models.SerialNumber{}).Where("serial IN ?", serials).Pluck("serial", &existing).Error; err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("serials already registered: %s", strings.Join(existing, ", "))
+	}
+
+	now := time.Now()
+	units := make([]models.SerialNumber, 0, len(serials))
+	for _, serial := range serials {
+		units = append(units, models.SerialNumber{
+			ProductID:          productID,
+			Serial:             serial,
+			Status:             models.SerialInStock,
+			LocationID:         locationID,
+			GoodsReceiptItemID: goodsReceiptItemID,
+			ReceivedAt:         now,
+		})
+	}
+
+	if err := tx.Create(&units).Error; err != nil {
+		return nil, err
+	}
+	return units, nil
+}
+
+// SellSerials marks the given units at a location as sold. Each serial is
+// locked so the same unit can never be sold by two transactions at once.
+func SellSerials(tx *gorm.DB, productID, locationID uint, serials []string) ([]models.SerialNumber, error) {
+	now := time.Now()
+	units := make([]models.SerialNumber, 0, len(serials))
+
+	for _, serial := range serials {
+		var unit models.SerialNumber
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("serial = ?", strings.TrimSpace(serial)).First(&unit).Error; err != nil {
+			return nil, fmt.Errorf("serial %s not found", serial)
+		}
+		if unit.ProductID != productID {
+			return nil, fmt.Errorf("serial %s belongs to a different product", serial)
+		}
+		if unit.Status != models.SerialInStock {
+			return nil, fmt.Errorf("serial %s is not available for sale (%s)", serial, unit.Status)
+		}
+		if unit.LocationID != locationID {
+			return nil, fmt.Errorf("serial %s is held at another location", serial)
+		}
+
+		if err := tx.Model(&unit).Updates(map[string]interface{}{
+			"status":  models.SerialSold,
+			"sold_at": now,
+		}).Error; err != nil {
+			return nil, err
+		}
+		units = append(units, unit)
+	}
+
+	return units, nil
+}
+
+// ReturnSerial takes back a sold unit at the location it was sold from.
+// Restocked units go back on sale through the stock ledger; the rest are
+// kept aside as defective.
+func ReturnSerial(tx *gorm.DB, serial string, restock bool, userID uint, note string) (*models.SerialNumber, error) {
+	var unit models.SerialNumber
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("serial = ?", serial).First(&unit).Error; err != nil {
+		return nil, fmt.Errorf("serial %s not found", serial)
+	}
+	if unit.Status != models.SerialSold {
+		return nil, fmt.Errorf("serial %s has not been sold", serial)
+	}
+
+	var sale models.TransactionItemSerial
+	if err := tx.Where("serial_number_id = ? AND returned_at IS NULL", unit.ID).Order("id DESC").First(&sale).Error; err != nil {
+		return nil, fmt.Errorf("no open sale found for serial %s", serial)
+	}
+
+	now := time.Now()
+	if err := tx.Model(&sale).Update("returned_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	status := models.SerialDefective
+	if restock {
+		status = models.SerialInStock
+
+		var item models.TransactionItem
+		if err := tx.First(&item, sale.TransactionItemID).Error; err != nil {
+			return nil, err
+		}
+
+		var transaction models.Transaction
+		if err := tx.First(&transaction, item.TransactionID).Error; err != nil {
+			return nil, err
+		}
+		unit.LocationID = transaction.LocationID
+
+		if _, err := Move(tx, Movement{
+			ProductID:     unit.ProductID,
+			LocationID:    transaction.LocationID,
+			Type:          models.MovementReturn,
+			Quantity:      1,
+			UnitCost:      item.Cost,
+			ReferenceType: "transaction",
+			ReferenceID:   item.TransactionID,
+			UserID:        userID,
+			Note:          note,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Model(&unit).Updates(map[string]interface{}{
+		"status":      status,
+		"location_id": unit.LocationID,
+		"returned_at": now,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &unit, nil
+}
+
+// RelocateSerials moves in-stock units of a product from one location to
+// another alongside a stock relocation.
+func RelocateSerials(tx *gorm.DB, productID, fromLocationID, toLocationID uint, serials []string) ([]models.SerialNumber, error) {
+	units := make([]models.SerialNumber, 0, len(serials))
+
+	for _, serial := range serials {
+		var unit models.SerialNumber
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("serial = ?", strings.TrimSpace(serial)).First(&unit).Error; err != nil {
+			return nil, fmt.Errorf("serial %s not found", serial)
+		}
+		if unit.ProductID != productID || unit.LocationID != fromLocationID || unit.Status != models.SerialInStock {
+			return nil, fmt.Errorf("serial %s is not in stock at the source location", serial)
+		}
+
+		if err := tx.Model(&unit).Update("location_id", toLocationID).Error; err != nil {
+			return nil, err
+		}
+		units = append(units, unit)
+	}
+
+	return units, nil
+}
@@ -0,0 +1,88 @@
+package inventory
+
+import (
+	"POS-Golang/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Relocation moves stock of one product between two locations. Lot details
+// travel with the goods, so the lots created at the destination keep the
+// lot number, expiry and received date of the lots they came from.
+type Relocation struct {
+	ProductID      uint
+	FromLocationID uint
+	ToLocationID   uint
+	Quantity       int
+	FromLotID      *uint
+	IncludeExpired bool
+	ReferenceType  string
+	ReferenceID    uint
+	UserID         uint
+	Note           string
+}
+
+// RelocatedLot is a lot created at the destination of a relocation.
+type RelocatedLot struct {
+	LotID    uint
+	Quantity int
+}
+
+// Relocate books a transfer out of one location and into another. It must
+// be called inside a database transaction.
+func Relocate(tx *gorm.DB, r Relocation) ([]RelocatedLot, error) {
+	outgoing, err := Move(tx, Movement{
+		ProductID:      r.ProductID,
+		LocationID:     r.FromLocationID,
+		Type:           models.MovementTransferOut,
+		Quantity:       -r.Quantity,
+		ReferenceType:  r.ReferenceType,
+		ReferenceID:    r.ReferenceID,
+		UserID:         r.UserID,
+		Note:           r.Note,
+		IncludeExpired: r.IncludeExpired,
+		FromLotID:      r.FromLotID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var relocated []RelocatedLot
+	for _, out := range outgoing {
+		in := Movement{
+			ProductID:     r.ProductID,
+			LocationID:    r.ToLocationID,
+			Type:          models.MovementTransferIn,
+			Quantity:      -out.Quantity,
+			UnitCost:      out.UnitCost,
+			ReferenceType: r.ReferenceType,
+			ReferenceID:   r.ReferenceID,
+			UserID:        r.UserID,
+			Note:          r.Note,
+		}
+
+		if out.StockLotID != nil {
+			var source models.StockLot
+			if err := tx.First(&source, *out.StockLotID).Error; err != nil {
+				return nil, err
+			}
+			in.LotNumber = source.LotNumber
+			in.ExpiryDate = source.ExpiryDate
+			in.ReceivedDate = &source.ReceivedDate
+			in.GoodsReceiptItemID = source.GoodsReceiptItemID
+		}
+
+		incoming, err := Move(tx, in)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, movement := range incoming {
+			if movement.StockLotID != nil {
+				relocated = append(relocated, RelocatedLot{LotID: *movement.StockLotID, Quantity: movement.Quantity})
+			}
+		}
+	}
+
+	return relocated, nil
+}
@@ -0,0 +1,91 @@
+package inventory
+
+import (
+	"POS-Golang/internal/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrNotVoidable = errors.New("only completed transactions can be voided")
+
+// VoidSale cancels a completed sale and puts everything it sold back on
+// hand at the location it was sold from. Lot-tracked stock goes back as
+// lots with the details of the lots it was drawn from, and sold serials go
+// back in stock. A sale with a unit already returned cannot be voided. It
+// must be called inside a database transaction.
+func VoidSale(tx *gorm.DB, transactionID, userID uint, reason string) (*models.Transaction, error) {
+	var transaction models.Transaction
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Items.Lots.StockLot").Preload("Items.Serials.SerialNumber").
+		First(&transaction, transactionID).Error; err != nil {
+		return nil, err
+	}
+	if transaction.Status != "completed" {
+		return nil, ErrNotVoidable
+	}
+
+	now := time.Now()
+	for _, item := range transaction.Items {
+		for _, sale := range item.Serials {
+			if sale.ReturnedAt != nil {
+				return nil, fmt.Errorf("serial %s was already returned", sale.SerialNumber.Serial)
+			}
+		}
+
+		back := Movement{
+			ProductID:     item.ProductID,
+			LocationID:    transaction.LocationID,
+			Type:          models.MovementVoid,
+			ReferenceType: "transaction",
+			ReferenceID:   transaction.ID,
+			UserID:        userID,
+			Note:          reason,
+		}
+
+		if len(item.Lots) == 0 {
+			back.Quantity = item.Quantity
+			back.UnitCost = item.Cost
+			if _, err := Move(tx, back); err != nil {
+				return nil, err
+			}
+		}
+		for _, lot := range item.Lots {
+			lotBack := back
+			lotBack.Quantity = lot.Quantity
+			lotBack.UnitCost = lot.StockLot.UnitCost
+			lotBack.LotNumber = lot.StockLot.LotNumber
+			lotBack.ExpiryDate = lot.StockLot.ExpiryDate
+			lotBack.ReceivedDate = &lot.StockLot.ReceivedDate
+			lotBack.GoodsReceiptItemID = lot.StockLot.GoodsReceiptItemID
+			if _, err := Move(tx, lotBack); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, sale := range item.Serials {
+			if err := tx.Model(&sale).UpdateColumn("returned_at", now).Error; err != nil {
+				return nil, err
+			}
+			if err := tx.Model(&models.SerialNumber{}).Where("id = ?", sale.SerialNumberID).Updates(map[string]interface{}{
+				"status":      models.SerialInStock,
+				"location_id": transaction.LocationID,
+				"sold_at":     nil,
+			}).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Model(&transaction).Updates(map[string]interface{}{
+		"status":      "voided",
+		"voided_at":   now,
+		"void_reason": reason,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
@@ -0,0 +1,258 @@
+// Package labels renders shelf and price labels onto printable sheets as
+// PDF or SVG.
+package labels
+
+import (
+	"POS-Golang/internal/barcode"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Label is the content printed on one label.
+type Label struct {
+	Name    string
+	Price   string // already formatted for display
+	Barcode string // drawn as bars when it is a valid EAN-8, UPC-A or EAN-13
+	SKU     string
+}
+
+// Layout describes a sheet of labels. All sizes are in millimetres.
+type Layout struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	PageWidth   float64 `json:"page_width"`
+	PageHeight  float64 `json:"page_height"`
+	Columns     int     `json:"columns"`
+	Rows        int     `json:"rows"`
+	LabelWidth  float64 `json:"label_width"`
+	LabelHeight float64 `json:"label_height"`
+	MarginLeft  float64 `json:"margin_left"`
+	MarginTop   float64 `json:"margin_top"`
+	GapX        float64 `json:"gap_x"`
+	GapY        float64 `json:"gap_y"`
+
+	// Price labels put the price first and leave out the SKU
+	PriceFirst bool `json:"price_first"`
+}
+
+// PerPage returns the number of labels on one sheet.
+func (l Layout) PerPage() int {
+	return l.Columns * l.Rows
+}
+
+var layouts = map[string]Layout{
+	"shelf": {
+		Name:        "shelf",
+		Description: "Shelf-edge labels, 3 x 8 on A4 (70 x 37 mm)",
+		PageWidth:   210, PageHeight: 297,
+		Columns: 3, Rows: 8,
+		LabelWidth: 70, LabelHeight: 37,
+		MarginLeft: 0, MarginTop: 0.5,
+	},
+	"price": {
+		Name:        "price",
+		Description: "Price stickers, 4 x 10 on A4 (48.5 x 25.4 mm)",
+		PageWidth:   210, PageHeight: 297,
+		Columns: 4, Rows: 10,
+		LabelWidth: 48.5, LabelHeight: 25.4,
+		MarginLeft: 8, MarginTop: 21.5,
+		PriceFirst: true,
+	},
+	"price-small": {
+		Name:        "price-small",
+		Description: "Small price stickers, 5 x 13 on A4 (38.1 x 21.2 mm)",
+		PageWidth:   210, PageHeight: 297,
+		Columns: 5, Rows: 13,
+		LabelWidth: 38.1, LabelHeight: 21.2,
+		MarginLeft: 4.75, MarginTop: 10.7, GapX: 2.5,
+		PriceFirst: true,
+	},
+}
+
+// Layouts returns every available layout, sorted by name.
+func Layouts() []Layout {
+	list := make([]Layout, 0, len(layouts))
+	for _, layout := range layouts {
+		list = append(list, layout)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// FindLayout returns the layout with the given name.
+func FindLayout(name string) (Layout, error) {
+	layout, ok := layouts[name]
+	if !ok {
+		return Layout{}, fmt.Errorf("unknown label layout %q", name)
+	}
+	return layout, nil
+}
+
+// Output formats
+const (
+	FormatPDF = "pdf"
+	FormatSVG = "svg"
+)
+
+// ContentType returns the MIME type of a format.
+func ContentType(format string) string {
+	if format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "application/pdf"
+}
+
+// canvas draws in millimetres from the top left of the current page
+type canvas interface {
+	newPage()
+	rect(x, y, w, h float64)
+	text(x, y, size float64, bold, centred bool, s string)
+}
+
+// Render writes the labels onto as many sheets as needed. Skip leaves that
+// many positions empty at the start of the first sheet so a partly used
+// sheet can be fed again.
+func Render(w io.Writer, format string, layout Layout, items []Label, skip int) error {
+	if layout.PerPage() == 0 {
+		return fmt.Errorf("label layout %q has no labels per page", layout.Name)
+	}
+	if skip < 0 || skip >= layout.PerPage() {
+		return fmt.Errorf("skip must be between 0 and %d", layout.PerPage()-1)
+	}
+
+	var c interface {
+		canvas
+		writeTo(io.Writer) error
+	}
+	switch format {
+	case FormatPDF:
+		c = newPDF(layout.PageWidth, layout.PageHeight)
+	case FormatSVG:
+		c = newSVG(layout.PageWidth, layout.PageHeight)
+	default:
+		return fmt.Errorf("unknown label format %q: must be pdf or svg", format)
+	}
+
+	for i := range items {
+		position := skip + i
+		if position%layout.PerPage() == 0 || i == 0 {
+			c.newPage()
+		}
+		cell := position % layout.PerPage()
+		x := layout.MarginLeft + float64(cell%layout.Columns)*(layout.LabelWidth+layout.GapX)
+		y := layout.MarginTop + float64(cell/layout.Columns)*(layout.LabelHeight+layout.GapY)
+		drawLabel(c, layout, x, y, items[i])
+	}
+	if len(items) == 0 {
+		c.newPage()
+	}
+
+	return c.writeTo(w)
+}
+
+// drawLabel lays out one label: name, price, then the barcode filling the
+// space left at the bottom
+func drawLabel(c canvas, layout Layout, x, y float64, item Label) {
+	w, h := layout.LabelWidth, layout.LabelHeight
+	pad := h * 0.08
+	inner := w - 2*pad
+
+	nameSize := clamp(h*0.16, 6, 10)
+	priceSize := clamp(h*0.26, 9, 18)
+
+	cursor := y + pad
+	if layout.PriceFirst {
+		cursor += priceSize * ptToMM
+		c.text(x+pad, cursor, priceSize, true, false, item.Price)
+		cursor += nameSize*ptToMM + 1
+		c.text(x+pad, cursor, nameSize, false, false, fitText(item.Name, nameSize, inner))
+	} else {
+		cursor += nameSize * ptToMM
+		c.text(x+pad, cursor, nameSize, true, false, fitText(item.Name, nameSize, inner))
+		cursor += priceSize*ptToMM + 1
+		c.text(x+pad, cursor, priceSize, true, false, item.Price)
+		if item.SKU != "" {
+			skuSize := nameSize * 0.8
+			c.text(x+w-pad-textWidth(item.SKU, skuSize), y+pad+skuSize*ptToMM, skuSize, false, false, item.SKU)
+		}
+	}
+
+	modules, err := barcode.Modules(item.Barcode)
+	if err != nil {
+		return
+	}
+
+	digitSize := clamp(h*0.14, 5, 8)
+	barsTop := cursor + 1.5
+	barsHeight := y + h - pad - digitSize*ptToMM - 0.5 - barsTop
+	if barsHeight < 3 {
+		return
+	}
+
+	// Scale the symbol to the label, keeping the quiet zones either side
+	const quietModules = 9
+	moduleWidth := inner / float64(len(modules)+2*quietModules)
+	if moduleWidth > 0.33 {
+		moduleWidth = 0.33 // nominal size for EAN
+	}
+	symbolWidth := moduleWidth * float64(len(modules))
+	left := x + (w-symbolWidth)/2
+
+	for i := 0; i < len(modules); {
+		if !modules[i] {
+			i++
+			continue
+		}
+		start := i
+		for i < len(modules) && modules[i] {
+			i++
+		}
+		c.rect(left+float64(start)*moduleWidth, barsTop, float64(i-start)*moduleWidth, barsHeight)
+	}
+	c.text(x+w/2, barsTop+barsHeight+digitSize*ptToMM+0.3, digitSize, false, true, item.Barcode)
+}
+
+// Points to millimetres
+const ptToMM = 25.4 / 72
+
+// textWidth estimates the printed width in millimetres of s in Helvetica.
+// Digits are exactly 0.556 em; other characters are averaged.
+func textWidth(s string, size float64) float64 {
+	width := 0.0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			width += 0.556
+		case r == ' ' || r == '.' || r == ',' || r == 'i' || r == 'l':
+			width += 0.278
+		case r >= 'A' && r <= 'Z':
+			width += 0.667
+		default:
+			width += 0.52
+		}
+	}
+	return width * size * ptToMM
+}
+
+// fitText shortens s with an ellipsis so it fits in width millimetres
+func fitText(s string, size, width float64) string {
+	if textWidth(s, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && textWidth(string(runes)+"...", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
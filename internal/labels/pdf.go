@@ -0,0 +1,111 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Millimetres to PDF points
+const mmToPt = 72 / 25.4
+
+// pdfCanvas builds a minimal PDF using the standard Helvetica fonts, which
+// every PDF reader provides, so no fonts need to be embedded
+type pdfCanvas struct {
+	width, height float64 // page size in millimetres
+	pages         []*bytes.Buffer
+}
+
+func newPDF(width, height float64) *pdfCanvas {
+	return &pdfCanvas{width: width, height: height}
+}
+
+func (p *pdfCanvas) current() *bytes.Buffer {
+	return p.pages[len(p.pages)-1]
+}
+
+func (p *pdfCanvas) newPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+}
+
+// PDF coordinates start at the bottom left, in points
+func (p *pdfCanvas) point(x, y float64) (float64, float64) {
+	return x * mmToPt, (p.height - y) * mmToPt
+}
+
+func (p *pdfCanvas) rect(x, y, w, h float64) {
+	px, py := p.point(x, y+h)
+	fmt.Fprintf(p.current(), "%.3f %.3f %.3f %.3f re f\n", px, py, w*mmToPt, h*mmToPt)
+}
+
+func (p *pdfCanvas) text(x, y, size float64, bold, centred bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	if centred {
+		x -= textWidth(s, size) / 2
+	}
+	px, py := p.point(x, y)
+	fmt.Fprintf(p.current(), "BT /%s %.2f Tf %.3f %.3f Td (%s) Tj ET\n", font, size, px, py, pdfString(s))
+}
+
+func (p *pdfCanvas) writeTo(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-4 are the catalog, page tree and fonts; each page then takes
+	// two objects, the page and its content stream
+	kids := ""
+	for i := range p.pages {
+		kids += fmt.Sprintf("%d 0 R ", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, len(p.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, content := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			p.width*mmToPt, p.height*mmToPt, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// pdfString escapes s for a PDF literal string in WinAnsi encoding, which
+// matches Latin-1 for the characters kept; anything else prints as '?'
+func pdfString(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
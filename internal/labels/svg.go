@@ -0,0 +1,63 @@
+package labels
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Space between sheets when several are stacked in one SVG
+const svgPageGap = 10
+
+// svgCanvas stacks the sheets vertically in a single SVG document
+type svgCanvas struct {
+	width, height float64
+	page          int
+	body          bytes.Buffer
+}
+
+func newSVG(width, height float64) *svgCanvas {
+	return &svgCanvas{width: width, height: height, page: -1}
+}
+
+func (s *svgCanvas) offset() float64 {
+	return float64(s.page) * (s.height + svgPageGap)
+}
+
+func (s *svgCanvas) newPage() {
+	s.page++
+	fmt.Fprintf(&s.body, `<rect x="0" y="%.2f" width="%.2f" height="%.2f" fill="#fff" stroke="#ccc" stroke-width="0.2"/>`+"\n",
+		s.offset(), s.width, s.height)
+}
+
+func (s *svgCanvas) rect(x, y, w, h float64) {
+	fmt.Fprintf(&s.body, `<rect x="%.3f" y="%.3f" width="%.3f" height="%.3f"/>`+"\n", x, y+s.offset(), w, h)
+}
+
+func (s *svgCanvas) text(x, y, size float64, bold, centred bool, str string) {
+	attrs := ""
+	if bold {
+		attrs += ` font-weight="bold"`
+	}
+	if centred {
+		attrs += ` text-anchor="middle"`
+	}
+	fmt.Fprintf(&s.body, `<text x="%.3f" y="%.3f" font-size="%.3f"%s>`, x, y+s.offset(), size*ptToMM, attrs)
+	xml.EscapeText(&s.body, []byte(str))
+	s.body.WriteString("</text>\n")
+}
+
+func (s *svgCanvas) writeTo(w io.Writer) error {
+	pages := s.page + 1
+	if pages < 1 {
+		pages = 1
+	}
+	total := float64(pages)*(s.height+svgPageGap) - svgPageGap
+
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%.2fmm" height="%.2fmm" viewBox="0 0 %.2f %.2f" font-family="Helvetica, Arial, sans-serif">
+%s</svg>
+`, s.width, total, s.width, total, s.body.String())
+	return err
+}
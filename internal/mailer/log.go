@@ -0,0 +1,24 @@
+package mailer
+
+import (
+	"context"
+	"log"
+)
+
+// Log writes messages to the log instead of sending them. Messages can
+// carry secrets such as password reset links, so it is only for
+// development and testing.
+type Log struct{}
+
+// NewLog returns a mailer writing to the log
+func NewLog() *Log {
+	return &Log{}
+}
+
+func (Log) Send(ctx context.Context, msg Message) error {
+	if err := msg.check(); err != nil {
+		return err
+	}
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,33 @@
+// Package mailer sends email, through an SMTP server or, for development
+// and testing, to the log.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// check rejects line breaks in the headers, so a value taken from a request
+// cannot add headers of its own
+func (m Message) check() error {
+	if m.To == "" {
+		return fmt.Errorf("message has no recipient")
+	}
+	if strings.ContainsAny(m.To, "\r\n") || strings.ContainsAny(m.Subject, "\r\n") {
+		return fmt.Errorf("invalid message header")
+	}
+	return nil
+}
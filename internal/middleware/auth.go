@@ -1,8 +1,12 @@
 package middleware
 
 import (
+	"POS-Golang/internal/auth"
+	"POS-Golang/internal/database"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -48,29 +52,70 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		}
 
 		// Extract claims and set to context
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			if userID, ok := claims["user_id"]; ok {
-				c.Set("user_id", userID)
-			}
-			if role, ok := claims["role"]; ok {
-				c.Set("role", role)
-			}
-			if username, ok := claims["username"]; ok {
-				c.Set("username", username)
+		claims, _ := token.Claims.(jwt.MapClaims)
+		userID, _ := claims["user_id"].(float64)
+		sessionID, _ := claims["session_id"].(float64)
+
+		// The session is checked on every request, so signing out, deleting
+		// the user or changing their role or password takes effect at once.
+		// Tokens issued before sessions existed have none and are refused.
+		access, err := auth.CheckSession(database.GetDB(), uint(userID), uint(sessionID))
+		if err != nil {
+			message := "Session has ended, please log in again"
+			switch {
+			case errors.Is(err, auth.ErrLocked):
+				message = "Terminal locked after going unused, enter your PIN"
+			case !errors.Is(err, auth.ErrRevoked):
+				message = "Failed to check session"
 			}
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": message,
+			})
+			c.Abort()
+			return
 		}
 
+		c.Set("user_id", userID)
+		c.Set("session_id", uint(sessionID))
+		c.Set("role", access.Role)
+		c.Set("access", access)
+		if username, ok := claims["username"]; ok {
+			c.Set("username", username)
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission lets the request through only if the user's role has
+// the permission
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		access, _ := c.Get("access")
+		if a, ok := access.(auth.Access); !ok || !a.Can(permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "You do not have permission to do this",
+				"error":   "missing permission " + permission,
+			})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
-func AdminOnly() gin.HandlerFunc {
+// EnforcePasswordChange lets a user who has to change their password reach
+// only the allowed routes, such as the one to change it, until they have
+func EnforcePasswordChange(allowed ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userRole, exists := c.Get("role")
-		if !exists || userRole != "admin" {
+		access, _ := c.Get("access")
+		if a, ok := access.(auth.Access); ok && a.MustChangePassword && !slices.Contains(allowed, c.FullPath()) {
 			c.JSON(http.StatusForbidden, gin.H{
 				"success": false,
-				"message": "Admin access required",
+				"message": "You must change your password first",
+				"error":   "password change required",
 			})
 			c.Abort()
 			return
@@ -78,3 +123,36 @@ func AdminOnly() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// TerminalAuth lets the request through only from a registered, active
+// terminal, identified by its key in the X-Terminal-Key header
+func TerminalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-Terminal-Key")
+		if key == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "This can only be done from a registered terminal",
+			})
+			c.Abort()
+			return
+		}
+
+		terminal, err := auth.FindTerminal(database.GetDB(), key, c.ClientIP())
+		if err != nil {
+			message := "Unknown or inactive terminal"
+			if !errors.Is(err, auth.ErrUnknownTerminal) {
+				message = "Failed to check terminal"
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": message,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("terminal", terminal)
+		c.Next()
+	}
+}
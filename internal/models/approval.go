@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Actions a supervisor approves
+const (
+	ApprovalVoid          = "void"
+	ApprovalPriceOverride = "price_override"
+	ApprovalDiscount      = "discount"
+	ApprovalNoSale        = "no_sale"
+)
+
+// ApprovalPermissions maps each approved action to the permission that
+// covers it. Users whose role has the permission approve their own
+// actions; anyone else needs a supervisor's PIN.
+var ApprovalPermissions = map[string]string{
+	ApprovalVoid:          PermTransactionVoid,
+	ApprovalPriceOverride: PermPriceOverride,
+	ApprovalDiscount:      PermDiscountOverLimit,
+	ApprovalNoSale:        PermDrawerNoSale,
+}
+
+// Approval records a sensitive action and the user who authorised it, which
+// is the user who did it when their own role allowed it
+type Approval struct {
+	ID            uint         `json:"id" gorm:"primaryKey"`
+	Action        string       `json:"action" gorm:"not null;size:30;index"`
+	ApproverID    uint         `json:"approver_id" gorm:"not null;index"`
+	Approver      *User        `json:"approver,omitempty"`
+	RequestedByID uint         `json:"requested_by_id" gorm:"not null;index"`
+	RequestedBy   *User        `json:"requested_by,omitempty"`
+	LocationID    uint         `json:"location_id" gorm:"not null;index"`
+	TransactionID *uint        `json:"transaction_id" gorm:"index"` // nil for a no-sale drawer open
+	Transaction   *Transaction `json:"transaction,omitempty"`
+	Reason        string       `json:"reason"`
+	Details       string       `json:"details"` // what was approved, e.g. the old and new price
+	CreatedAt     time.Time    `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Tag is a free-form label merchandisers put on products, such as
+// "organic" or "summer range". A product can have any number of tags.
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null;uniqueIndex;size:50"`
+	Color     string    `json:"color" gorm:"size:20"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// ProductCount is filled in when tags are listed
+	ProductCount *int64 `json:"product_count,omitempty" gorm:"-"`
+}
+
+// Custom attribute types
+const (
+	AttributeText        = "text"
+	AttributeNumber      = "number"
+	AttributeBoolean     = "boolean"
+	AttributeSelect      = "select"      // one of Options
+	AttributeMultiSelect = "multiselect" // any of Options, e.g. allergens
+)
+
+// AttributeDefinition is a custom product attribute defined by an admin,
+// such as brand, country of origin or allergens
+type AttributeDefinition struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Code      string    `json:"code" gorm:"not null;uniqueIndex;size:50"` // key used in requests and filters
+	Name      string    `json:"name" gorm:"not null"`
+	Type      string    `json:"type" gorm:"not null;size:20"`
+	Options   []string  `json:"options" gorm:"serializer:json;type:text"` // choices of select and multiselect attributes
+	Unit      string    `json:"unit" gorm:"size:20"`                      // shown after number values, e.g. g or ml
+	Required  bool      `json:"required"`                                 // whenever a product's attributes are set
+	SortOrder int       `json:"sort_order" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProductAttribute is a product's value of a custom attribute. Multiselect
+// attributes have one row per option chosen; the value is kept in the
+// column matching the attribute type.
+type ProductAttribute struct {
+	ID          uint                `json:"id" gorm:"primaryKey"`
+	ProductID   uint                `json:"product_id" gorm:"not null;uniqueIndex:idx_product_attribute_value"`
+	AttributeID uint                `json:"attribute_id" gorm:"not null;uniqueIndex:idx_product_attribute_value;index:idx_attribute_text;index:idx_attribute_number"`
+	Attribute   AttributeDefinition `json:"attribute,omitempty" gorm:"foreignKey:AttributeID"`
+	ValueText   string              `json:"value_text" gorm:"size:191;uniqueIndex:idx_product_attribute_value;index:idx_attribute_text"`
+	ValueNumber *float64            `json:"value_number" gorm:"index:idx_attribute_number"`
+	ValueBool   *bool               `json:"value_bool"`
+}
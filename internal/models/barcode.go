@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Kinds of additional product barcode
+const (
+	BarcodeKindVariant = "variant"
+	BarcodeKindUnit    = "unit"
+)
+
+// ProductBarcode is an extra barcode that also identifies a product: a
+// variant sold under its own barcode, or a pack holding several units.
+type ProductBarcode struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ProductID uint      `json:"product_id" gorm:"not null;index"`
+	Barcode   string    `json:"barcode" gorm:"not null;uniqueIndex;size:64"`
+	Kind      string    `json:"kind" gorm:"not null;default:'unit'"`
+	Name      string    `json:"name"`                               // e.g. "Red, XL" or "Case of 12"
+	Quantity  int       `json:"quantity" gorm:"not null;default:1"` // units of the product the barcode stands for
+	Price     *float64  `json:"price"`                              // nil sells at the product price times quantity
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// ProductImage is a picture of a product kept in the file storage, with a
+// thumbnail made on upload. One image of a product is its primary image,
+// shown in product lists.
+type ProductImage struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ProductID    uint      `json:"product_id" gorm:"not null;index"`
+	Key          string    `json:"-" gorm:"not null;size:255"` // storage key of the uploaded image
+	ThumbnailKey string    `json:"-" gorm:"not null;size:255"`
+	ContentType  string    `json:"content_type" gorm:"size:50"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Size         int64     `json:"size"` // bytes
+	IsPrimary    bool      `json:"is_primary" gorm:"default:false"`
+	SortOrder    int       `json:"sort_order" gorm:"not null;default:0"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// URLs the image and thumbnail are served from
+	URL          string `json:"url" gorm:"-"`
+	ThumbnailURL string `json:"thumbnail_url" gorm:"-"`
+}
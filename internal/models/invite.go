@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Invite lets someone create their own account with a role chosen by the
+// user who invited them. Only a hash of the invite token is kept.
+type Invite struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	TokenHash      string     `json:"-" gorm:"not null;uniqueIndex;size:64"`
+	Email          string     `json:"email" gorm:"not null;size:191;index"`
+	Role           string     `json:"role" gorm:"not null;size:50"`
+	LocationID     *uint      `json:"location_id"`
+	Location       *Location  `json:"location,omitempty"`
+	CreatedByID    uint       `json:"created_by_id" gorm:"not null"`
+	CreatedBy      *User      `json:"created_by,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+	AcceptedUserID *uint      `json:"accepted_user_id"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	Status         string     `json:"status" gorm:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// CurrentStatus returns pending, accepted, revoked or expired
+func (i *Invite) CurrentStatus(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return "accepted"
+	case i.RevokedAt != nil:
+		return "revoked"
+	case now.After(i.ExpiresAt):
+		return "expired"
+	}
+	return "pending"
+}
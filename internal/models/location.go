@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Location types
+const (
+	LocationStore     = "store"
+	LocationWarehouse = "warehouse"
+	LocationTransit   = "transit"
+)
+
+// DefaultLocationCode identifies the location created on first start, which
+// holds all stock that existed before locations were introduced.
+const DefaultLocationCode = "MAIN"
+
+// TransitLocationCode identifies the system location that holds stock
+// shipped between locations but not yet received.
+const TransitLocationCode = "TRANSIT"
+
+// Location is a store or warehouse that holds its own inventory. The product
+// catalogue and prices are shared across locations.
+type Location struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Code      string         `json:"code" gorm:"unique;not null;size:20" validate:"required"`
+	Name      string         `json:"name" gorm:"not null" validate:"required"`
+	Type      string         `json:"type" gorm:"not null;default:'store'" validate:"required,oneof=store warehouse"`
+	Address   string         `json:"address"`
+	IsActive  bool           `json:"is_active" gorm:"default:true"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// StockLevel is the quantity of a product on hand at one location.
+type StockLevel struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ProductID  uint      `json:"product_id" gorm:"not null;uniqueIndex:idx_stock_levels_product_location"`
+	LocationID uint      `json:"location_id" gorm:"not null;uniqueIndex:idx_stock_levels_product_location;index"`
+	Location   Location  `json:"location,omitempty"`
+	Quantity   int       `json:"quantity" gorm:"not null;default:0"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
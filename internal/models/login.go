@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Ways of logging in
+const (
+	LoginPassword  = "password"
+	LoginPIN       = "pin"
+	LoginTwoFactor = "two_factor" // the second step after a password
+)
+
+// Why a login attempt failed
+const (
+	LoginInvalid       = "invalid_credentials"
+	LoginAccountLocked = "account_locked"
+	LoginIPLocked      = "ip_locked"
+	LoginWrongTerminal = "wrong_terminal"
+	LoginInvalidCode   = "invalid_code"
+	LoginPINRefused    = "pin_refused" // the user signs in with two-factor
+	// The password was right and a TOTP or recovery code is needed next
+	LoginTwoFactorRequired = "two_factor_required"
+)
+
+// LoginAttempt records a login, successful or not, for audit
+type LoginAttempt struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     *uint     `json:"user_id" gorm:"index"` // nil when no user matched
+	User       *User     `json:"user,omitempty"`
+	Username   string    `json:"username" gorm:"size:191"` // as entered
+	Method     string    `json:"method" gorm:"not null;size:20"`
+	TerminalID *uint     `json:"terminal_id"`
+	IP         string    `json:"ip" gorm:"size:45;index"`
+	UserAgent  string    `json:"user_agent" gorm:"size:255"`
+	Success    bool      `json:"success" gorm:"index"`
+	Reason     string    `json:"reason" gorm:"size:30"` // why it failed
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
+
+// RateLimit holds the failed attempts of one key for the database-backed
+// rate limiter
+type RateLimit struct {
+	Key         string    `gorm:"primaryKey;size:191"`
+	Failures    int       `gorm:"not null"`
+	LastFailAt  time.Time `gorm:"not null;index"`
+	LockedUntil *time.Time
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// StockLot is a batch of a product received together, sharing a lot number
+// and expiry date. Lot-tracked products keep their stock split across lots.
+type StockLot struct {
+	ID                 uint       `json:"id" gorm:"primaryKey"`
+	ProductID          uint       `json:"product_id" gorm:"not null;index:idx_stock_lots_fefo"`
+	LocationID         uint       `json:"location_id" gorm:"not null;index:idx_stock_lots_fefo"`
+	Product            Product    `json:"product,omitempty"`
+	LotNumber          string     `json:"lot_number" gorm:"not null;index"`
+	ExpiryDate         *time.Time `json:"expiry_date" gorm:"type:date;index:idx_stock_lots_fefo"`
+	ReceivedDate       time.Time  `json:"received_date" gorm:"not null"`
+	InitialQuantity    int        `json:"initial_quantity" gorm:"not null"`
+	Quantity           int        `json:"quantity" gorm:"not null"`
+	UnitCost           float64    `json:"unit_cost"`
+	GoodsReceiptItemID *uint      `json:"goods_receipt_item_id"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// IsExpired reports whether the lot is past its expiry date on the given day.
+// A lot may still be sold on its expiry date.
+func (l StockLot) IsExpired(on time.Time) bool {
+	if l.ExpiryDate == nil {
+		return false
+	}
+	day := time.Date(on.Year(), on.Month(), on.Day(), 0, 0, 0, 0, l.ExpiryDate.Location())
+	return l.ExpiryDate.Before(day)
+}
+
+// TransactionItemLot records which lots a sold line was drawn from.
+type TransactionItemLot struct {
+	ID                uint     `json:"id" gorm:"primaryKey"`
+	TransactionItemID uint     `json:"transaction_item_id" gorm:"not null;index"`
+	StockLotID        uint     `json:"stock_lot_id" gorm:"not null;index"`
+	StockLot          StockLot `json:"stock_lot,omitempty"`
+	Quantity          int      `json:"quantity" gorm:"not null"`
+}
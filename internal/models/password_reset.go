@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PasswordReset lets a user who forgot their password set a new one. The
+// token is mailed to them, works once and expires; only its hash is kept.
+type PasswordReset struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	User      *User      `json:"user,omitempty"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex;size:64"`
+	IP        string     `json:"ip" gorm:"size:45"` // where it was asked for
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PriceList is a named set of product prices, such as retail, wholesale or
+// member prices. Products without a price on the list sell at their own
+// price.
+type PriceList struct {
+	ID          uint            `json:"id" gorm:"primaryKey"`
+	Code        string          `json:"code" gorm:"unique;not null;size:30"`
+	Name        string          `json:"name" gorm:"not null"`
+	Description string          `json:"description"`
+	IsDefault   bool            `json:"is_default" gorm:"default:false"` // used for sales with no list or customer list
+	IsActive    bool            `json:"is_active"`                       // set on create; no column default so false is kept
+	Items       []PriceListItem `json:"items,omitempty" gorm:"foreignKey:PriceListID"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt  `json:"-" gorm:"index"`
+}
+
+// PriceListItem is the price of a product on a price list from a minimum
+// quantity. Several items for one product form quantity breaks: the item
+// with the highest minimum not above the quantity sold applies.
+type PriceListItem struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	PriceListID uint      `json:"price_list_id" gorm:"not null;uniqueIndex:idx_price_list_item"`
+	ProductID   uint      `json:"product_id" gorm:"not null;uniqueIndex:idx_price_list_item;index"`
+	Product     *Product  `json:"product,omitempty"`
+	MinQuantity int       `json:"min_quantity" gorm:"not null;default:1;uniqueIndex:idx_price_list_item"`
+	Price       float64   `json:"price" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type Customer struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Code        *string        `json:"code" gorm:"uniqueIndex;size:30"` // member or account number
+	Name        string         `json:"name" gorm:"not null"`
+	Phone       string         `json:"phone"`
+	Email       string         `json:"email"`
+	Address     string         `json:"address"`
+	PriceListID *uint          `json:"price_list_id"` // the customer's tier
+	PriceList   *PriceList     `json:"price_list,omitempty"`
+	IsActive    bool           `json:"is_active"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Price change statuses
+const (
+	PriceChangeScheduled = "scheduled"
+	PriceChangeApplied   = "applied"
+	PriceChangeCancelled = "cancelled"
+)
+
+// Sources of a price history entry
+const (
+	PriceSourceManual    = "manual"
+	PriceSourceScheduled = "scheduled"
+	PriceSourceImport    = "import"
+)
+
+// PriceChange is a product price change that takes effect at a future time.
+// Changes scheduled together in bulk share a batch number so they can be
+// listed or cancelled together.
+type PriceChange struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	BatchNo     string     `json:"batch_no" gorm:"not null;index"`
+	ProductID   uint       `json:"product_id" gorm:"not null;index"`
+	Product     *Product   `json:"product,omitempty"`
+	OldPrice    float64    `json:"old_price"`                 // when scheduled, then when applied
+	NewPrice    float64    `json:"new_price" gorm:"not null"` // for a percentage change, again when applied
+	Percentage  *float64   `json:"percentage"`                // set when scheduled as a percentage change
+	EffectiveAt time.Time  `json:"effective_at" gorm:"not null;index:idx_price_changes_due"`
+	Status      string     `json:"status" gorm:"not null;size:20;index:idx_price_changes_due"`
+	Note        string     `json:"note"`
+	CreatedBy   uint       `json:"created_by"`
+	AppliedAt   *time.Time `json:"applied_at"`
+	CancelledBy *uint      `json:"cancelled_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// PriceHistory records every change to a product's price, who made it and
+// how.
+type PriceHistory struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	ProductID     uint      `json:"product_id" gorm:"not null;index"`
+	OldPrice      float64   `json:"old_price"`
+	NewPrice      float64   `json:"new_price"`
+	Source        string    `json:"source" gorm:"not null;size:20"` // manual, scheduled or import
+	PriceChangeID *uint     `json:"price_change_id"`
+	UserID        uint      `json:"user_id"` // who made or scheduled the change
+	User          *User     `json:"user,omitempty"`
+	Note          string    `json:"note"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
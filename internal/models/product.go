@@ -1,30 +1,71 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type Product struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	Name        string         `json:"name" gorm:"not null" validate:"required"`
-	Description string         `json:"description"`
-	Price       float64        `json:"price" gorm:"not null" validate:"required,gt=0"`
-	Stock       int            `json:"stock" gorm:"not null" validate:"required,gte=0"`
-	CategoryID  uint           `json:"category_id"`
-	Category    Category       `json:"category,omitempty"`
-	Barcode     string         `json:"barcode" gorm:"unique"`
-	IsActive    bool           `json:"is_active" gorm:"default:true"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID             uint               `json:"id" gorm:"primaryKey"`
+	Name           string             `json:"name" gorm:"not null" validate:"required"`
+	Description    string             `json:"description"`
+	Price          float64            `json:"price" gorm:"not null" validate:"required,gt=0"`
+	Cost           float64            `json:"cost" gorm:"not null;default:0"`
+	Stock          int                `json:"stock" gorm:"not null" validate:"required,gte=0"` // total across all locations
+	CategoryID     uint               `json:"category_id"`
+	Category       Category           `json:"category,omitempty"`
+	Barcode        *string            `json:"barcode" gorm:"size:191"` // barcode, SKU and PLU are unique among products not in the trash
+	SKU            *string            `json:"sku" gorm:"size:64"`      // nil when the product has no SKU
+	PLU            *string            `json:"plu" gorm:"size:5"`       // item code printed by scales in 2x barcodes
+	IsActive       bool               `json:"is_active" gorm:"default:true"`
+	TrackLots      bool               `json:"track_lots" gorm:"default:false"`
+	TrackSerials   bool               `json:"track_serials" gorm:"default:false"`
+	WarrantyMonths int                `json:"warranty_months" gorm:"default:0"`
+	MinStock       int                `json:"min_stock" gorm:"not null;default:0"`
+	ReorderPoint   int                `json:"reorder_point" gorm:"not null;default:10"`
+	MaxStock       int                `json:"max_stock" gorm:"not null;default:0"`
+	SupplierID     *uint              `json:"supplier_id"` // preferred supplier for reordering
+	Supplier       *Supplier          `json:"supplier,omitempty"`
+	Barcodes       []ProductBarcode   `json:"barcodes,omitempty" gorm:"foreignKey:ProductID"`
+	Images         []ProductImage     `json:"images,omitempty" gorm:"foreignKey:ProductID"`
+	Tags           []Tag              `json:"tags,omitempty" gorm:"many2many:product_tags"`
+	AttributeRows  []ProductAttribute `json:"-" gorm:"foreignKey:ProductID"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt     `json:"-" gorm:"index"`
+
+	// LocationStock is the stock at the location a request is scoped to
+	LocationStock *int `json:"location_stock,omitempty" gorm:"-"`
+
+	// ImageURL and ThumbnailURL are those of the primary image, if any
+	ImageURL     string `json:"image_url,omitempty" gorm:"-"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty" gorm:"-"`
+
+	// Attributes are the product's custom attribute values by code
+	Attributes map[string]interface{} `json:"attributes,omitempty" gorm:"-"`
 }
 
 type Category struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
 	Name      string         `json:"name" gorm:"not null" validate:"required"`
+	ParentID  *uint          `json:"parent_id" gorm:"index"`
+	Path      string         `json:"path" gorm:"size:255;index"` // IDs from the root down to this category, e.g. /1/5/9/
+	Depth     int            `json:"depth" gorm:"not null;default:0"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Children is filled in when categories are returned as a tree
+	Children []Category `json:"children,omitempty" gorm:"-"`
+}
+
+// CategoryPath returns the path of a category with the given ID under a
+// parent with the given path ("" for a top-level category).
+func CategoryPath(parentPath string, id uint) string {
+	if parentPath == "" {
+		parentPath = "/"
+	}
+	return fmt.Sprintf("%s%d/", parentPath, id)
 }
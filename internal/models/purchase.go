@@ -0,0 +1,100 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Purchase order statuses
+const (
+	POStatusDraft     = "draft"
+	POStatusOrdered   = "ordered"
+	POStatusPartial   = "partial"
+	POStatusReceived  = "received"
+	POStatusClosed    = "closed"
+	POStatusCancelled = "cancelled"
+)
+
+type Supplier struct {
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	Name         string         `json:"name" gorm:"not null" validate:"required"`
+	Contact      string         `json:"contact"`
+	Phone        string         `json:"phone"`
+	Email        string         `json:"email"`
+	Address      string         `json:"address"`
+	LeadTimeDays int            `json:"lead_time_days" gorm:"not null;default:7"` // usual delivery time
+	IsActive     bool           `json:"is_active" gorm:"default:true"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+type PurchaseOrder struct {
+	ID         uint                `json:"id" gorm:"primaryKey"`
+	PONumber   string              `json:"po_number" gorm:"unique;not null"`
+	SupplierID uint                `json:"supplier_id" gorm:"not null;index"`
+	Supplier   Supplier            `json:"supplier,omitempty"`
+	LocationID uint                `json:"location_id" gorm:"not null;index"` // deliver to
+	UserID     uint                `json:"user_id" gorm:"not null"`
+	Status     string              `json:"status" gorm:"not null;default:'draft'"`
+	Notes      string              `json:"notes"`
+	OrderedAt  *time.Time          `json:"ordered_at"`
+	ExpectedAt *time.Time          `json:"expected_at"`
+	Items      []PurchaseOrderItem `json:"items,omitempty" gorm:"foreignKey:PurchaseOrderID"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+}
+
+type PurchaseOrderItem struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	PurchaseOrderID  uint      `json:"purchase_order_id" gorm:"not null;index"`
+	ProductID        uint      `json:"product_id" gorm:"not null"`
+	Product          Product   `json:"product,omitempty"`
+	QuantityOrdered  int       `json:"quantity_ordered" gorm:"not null"`
+	QuantityReceived int       `json:"quantity_received" gorm:"not null;default:0"`
+	UnitCost         float64   `json:"unit_cost" gorm:"not null"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Outstanding returns the quantity still expected from the supplier.
+func (i PurchaseOrderItem) Outstanding() int {
+	if i.QuantityReceived >= i.QuantityOrdered {
+		return 0
+	}
+	return i.QuantityOrdered - i.QuantityReceived
+}
+
+type GoodsReceipt struct {
+	ID              uint               `json:"id" gorm:"primaryKey"`
+	ReceiptNo       string             `json:"receipt_no" gorm:"unique;not null"`
+	PurchaseOrderID *uint              `json:"purchase_order_id" gorm:"index"`
+	SupplierID      uint               `json:"supplier_id" gorm:"not null;index"`
+	Supplier        Supplier           `json:"supplier,omitempty"`
+	LocationID      uint               `json:"location_id" gorm:"not null;index"`
+	UserID          uint               `json:"user_id" gorm:"not null"`
+	SupplierRef     string             `json:"supplier_ref"`
+	AdditionalCost  float64            `json:"additional_cost"`
+	Notes           string             `json:"notes"`
+	Items           []GoodsReceiptItem `json:"items,omitempty" gorm:"foreignKey:GoodsReceiptID"`
+	CreatedAt       time.Time          `json:"created_at"`
+}
+
+type GoodsReceiptItem struct {
+	ID                  uint    `json:"id" gorm:"primaryKey"`
+	GoodsReceiptID      uint    `json:"goods_receipt_id" gorm:"not null;index"`
+	PurchaseOrderItemID *uint   `json:"purchase_order_item_id"`
+	ProductID           uint    `json:"product_id" gorm:"not null"`
+	Product             Product `json:"product,omitempty"`
+	Quantity            int     `json:"quantity" gorm:"not null"`
+	// QuantityExpected is what was still outstanding on the purchase order
+	// line; Variance is the over (+) or under (-) delivery against it.
+	QuantityExpected int            `json:"quantity_expected"`
+	Variance         int            `json:"variance"`
+	UnitCost         float64        `json:"unit_cost" gorm:"not null"`
+	LandedUnitCost   float64        `json:"landed_unit_cost" gorm:"not null"`
+	LotNumber        string         `json:"lot_number"`
+	ExpiryDate       *time.Time     `json:"expiry_date" gorm:"type:date"`
+	Serials          []SerialNumber `json:"serials,omitempty" gorm:"foreignKey:GoodsReceiptItemID"`
+}
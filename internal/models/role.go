@@ -0,0 +1,157 @@
+package models
+
+import "time"
+
+// Built-in roles. They cannot be deleted or renamed, and the admin role
+// always has every permission.
+const (
+	RoleAdmin   = "admin"
+	RoleManager = "manager"
+	RoleCashier = "cashier"
+)
+
+// Permissions a role can be given
+const (
+	PermProductView       = "product.view"
+	PermProductWrite      = "product.write"
+	PermProductImport     = "product.import"
+	PermCategoryWrite     = "category.write"
+	PermCatalogManage     = "catalog.manage"
+	PermLabelPrint        = "label.print"
+	PermSerialView        = "serial.view"
+	PermSerialReturn      = "serial.return"
+	PermTransactionView   = "transaction.view"
+	PermTransactionCreate = "transaction.create"
+	PermTransactionVoid   = "transaction.void"
+	PermPriceOverride     = "transaction.price_override"
+	PermDiscountOverLimit = "transaction.discount"
+	PermDrawerNoSale      = "drawer.no_sale"
+	PermDashboardView     = "dashboard.view"
+	PermReportView        = "report.view"
+	PermCustomerView      = "customer.view"
+	PermCustomerWrite     = "customer.write"
+	PermPricingView       = "pricing.view"
+	PermPricingManage     = "pricing.manage"
+	PermStockView         = "stock.view"
+	PermStockTransfer     = "stock.transfer"
+	PermStockAdjust       = "stock.adjust"
+	PermPurchaseView      = "purchase.view"
+	PermPurchaseWrite     = "purchase.write"
+	PermLocationView      = "location.view"
+	PermLocationAll       = "location.all"
+	PermLocationManage    = "location.manage"
+	PermTerminalManage    = "terminal.manage"
+	PermUserManage        = "user.manage"
+	PermRoleManage        = "role.manage"
+	PermTrashManage       = "trash.manage"
+)
+
+// Permission describes a permission for the role editor
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AllPermissions lists every permission in the order they are shown
+var AllPermissions = []Permission{
+	{PermProductView, "View products, categories, tags and attributes"},
+	{PermProductWrite, "Create, edit and delete products, their barcodes, images and tags"},
+	{PermProductImport, "Import and export products and generate barcodes"},
+	{PermCategoryWrite, "Create, edit and delete categories"},
+	{PermCatalogManage, "Manage tags and custom attributes"},
+	{PermLabelPrint, "Print shelf and price labels"},
+	{PermSerialView, "Look up serial numbers and warranties"},
+	{PermSerialReturn, "Take back returned serial-numbered items"},
+	{PermTransactionView, "View transactions"},
+	{PermTransactionCreate, "Ring up sales"},
+	{PermTransactionVoid, "Void transactions, or approve another user's void"},
+	{PermPriceOverride, "Override prices on a sale, or approve another user's override"},
+	{PermDiscountOverLimit, "Give discounts over the limit, or approve another user's"},
+	{PermDrawerNoSale, "Open the cash drawer without a sale, or approve another user's"},
+	{PermDashboardView, "View the dashboard"},
+	{PermReportView, "View profit, expiry and reorder reports"},
+	{PermCustomerView, "View customers"},
+	{PermCustomerWrite, "Create, edit and delete customers"},
+	{PermPricingView, "View price lists"},
+	{PermPricingManage, "Manage price lists, scheduled price changes and price history"},
+	{PermStockView, "View the stock movement ledger"},
+	{PermStockTransfer, "View, create, ship, receive and cancel stock transfers"},
+	{PermStockAdjust, "Write off lots and register serial numbers"},
+	{PermPurchaseView, "View suppliers, purchase orders and goods receipts"},
+	{PermPurchaseWrite, "Manage suppliers and purchase orders and receive goods"},
+	{PermLocationView, "View locations"},
+	{PermLocationAll, "Work at any location, not only the assigned store"},
+	{PermLocationManage, "Create, edit and delete locations"},
+	{PermTerminalManage, "Register and manage till terminals"},
+	{PermUserManage, "Manage users"},
+	{PermRoleManage, "Manage roles and their permissions"},
+	{PermTrashManage, "Restore and purge deleted records"},
+}
+
+// ValidPermission reports whether name is a known permission
+func ValidPermission(name string) bool {
+	for _, permission := range AllPermissions {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionNames returns the name of every permission
+func PermissionNames() []string {
+	names := make([]string, len(AllPermissions))
+	for i, permission := range AllPermissions {
+		names[i] = permission.Name
+	}
+	return names
+}
+
+// Role is a named set of permissions users are given
+type Role struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	Name             string    `json:"name" gorm:"uniqueIndex;not null;size:50"`
+	Description      string    `json:"description"`
+	Permissions      []string  `json:"permissions" gorm:"serializer:json"`
+	IsSystem         bool      `json:"is_system" gorm:"default:false"`                   // built in, so it cannot be deleted or renamed
+	RequireTwoFactor bool      `json:"require_two_factor" gorm:"not null;default:false"` // users with the role must log in with a TOTP code as well as their password
+	UserCount        int64     `json:"user_count" gorm:"-"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// DefaultRoles are created on first start. Their permissions can be
+// changed afterwards, except the admin role's.
+var DefaultRoles = []Role{
+	{
+		Name:        RoleAdmin,
+		Description: "Full access to everything",
+		IsSystem:    true,
+	},
+	{
+		Name:        RoleManager,
+		Description: "Runs a store: catalog, pricing, stock, purchasing and reports",
+		IsSystem:    true,
+		Permissions: []string{
+			PermProductView, PermProductWrite, PermProductImport, PermCategoryWrite, PermCatalogManage,
+			PermLabelPrint, PermSerialView, PermSerialReturn,
+			PermTransactionView, PermTransactionCreate, PermTransactionVoid,
+			PermPriceOverride, PermDiscountOverLimit, PermDrawerNoSale,
+			PermDashboardView, PermReportView, PermCustomerView, PermCustomerWrite,
+			PermPricingView, PermPricingManage,
+			PermStockView, PermStockTransfer, PermStockAdjust,
+			PermPurchaseView, PermPurchaseWrite, PermLocationView,
+		},
+	},
+	{
+		Name:        RoleCashier,
+		Description: "Rings up sales at the till",
+		IsSystem:    true,
+		Permissions: []string{
+			PermProductView, PermLabelPrint, PermSerialView, PermSerialReturn,
+			PermTransactionView, PermTransactionCreate, PermDashboardView,
+			PermCustomerView, PermCustomerWrite, PermPricingView,
+			PermLocationView,
+		},
+	},
+}
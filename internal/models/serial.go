@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Serial number statuses
+const (
+	SerialInStock   = "in_stock"
+	SerialSold      = "sold"
+	SerialDefective = "defective"
+	SerialMissing   = "missing"
+)
+
+// SerialNumber is a single unit of a serial-tracked product, identified by
+// its serial or IMEI.
+type SerialNumber struct {
+	ID                 uint       `json:"id" gorm:"primaryKey"`
+	ProductID          uint       `json:"product_id" gorm:"not null;index"`
+	Product            Product    `json:"product,omitempty"`
+	Serial             string     `json:"serial" gorm:"not null;uniqueIndex;size:100"`
+	Status             string     `json:"status" gorm:"not null;default:'in_stock';index"`
+	LocationID         uint       `json:"location_id" gorm:"not null;index"`
+	GoodsReceiptItemID *uint      `json:"goods_receipt_item_id"`
+	ReceivedAt         time.Time  `json:"received_at"`
+	SoldAt             *time.Time `json:"sold_at"`
+	ReturnedAt         *time.Time `json:"returned_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// TransactionItemSerial records the serial sold on a transaction line. It is
+// kept after a return so the full sales history of a unit stays available.
+type TransactionItemSerial struct {
+	ID                uint         `json:"id" gorm:"primaryKey"`
+	TransactionItemID uint         `json:"transaction_item_id" gorm:"not null;index"`
+	SerialNumberID    uint         `json:"serial_number_id" gorm:"not null;index"`
+	SerialNumber      SerialNumber `json:"serial_number,omitempty"`
+	ReturnedAt        *time.Time   `json:"returned_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Reasons a session was revoked
+const (
+	RevokeLogout          = "logout"
+	RevokeTokenReuse      = "token_reuse" // a refresh token was used twice
+	RevokeUserDeleted     = "user_deleted"
+	RevokeRoleChanged     = "role_changed"
+	RevokePasswordChanged = "password_changed"
+	RevokeIdle            = "idle"     // a terminal session locked after going unused
+	RevokeTerminal        = "terminal" // the terminal was deactivated or removed
+)
+
+// Session is a user's login on one device. Access tokens name their
+// session, so revoking it signs the device out right away rather than when
+// its tokens expire.
+type Session struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"not null;index"`
+	TerminalID   *uint      `json:"terminal_id" gorm:"index"` // set for PIN logins, which lock when left idle
+	UserAgent    string     `json:"user_agent" gorm:"size:255"`
+	IP           string     `json:"ip" gorm:"size:45"`
+	ExpiresAt    time.Time  `json:"expires_at"`   // when the latest refresh token expires
+	LastUsedAt   time.Time  `json:"last_used_at"` // last request made with the session
+	RevokedAt    *time.Time `json:"revoked_at"`
+	RevokeReason string     `json:"revoke_reason" gorm:"size:30"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RefreshToken is a single-use token that trades for a new access token and
+// a new refresh token. Only a hash of the token is kept.
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	SessionID uint       `json:"session_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex;size:64"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null;index"`
+	UsedAt    *time.Time `json:"used_at"` // set once traded in; a second use is token theft
+	CreatedAt time.Time  `json:"created_at"`
+}
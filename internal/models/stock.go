@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Stock movement types recorded in the stock ledger
+const (
+	MovementOpening    = "opening"
+	MovementReceipt    = "receipt"
+	MovementSale       = "sale"
+	MovementAdjustment = "adjustment"
+	MovementWriteOff   = "write_off"
+	MovementReturn     = "return"
+	MovementVoid       = "void"
+
+	MovementTransferOut      = "transfer_out"
+	MovementTransferIn       = "transfer_in"
+	MovementTransferVariance = "transfer_variance"
+)
+
+// StockMovement is a single entry in the stock ledger. Every change to a
+// product's stock is recorded here so the running balance can be audited.
+type StockMovement struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	ProductID     uint      `json:"product_id" gorm:"not null;index"`
+	Product       Product   `json:"product,omitempty"`
+	LocationID    uint      `json:"location_id" gorm:"not null;index"`
+	StockLotID    *uint     `json:"stock_lot_id" gorm:"index"`
+	Type          string    `json:"type" gorm:"not null;index"`
+	Quantity      int       `json:"quantity" gorm:"not null"`
+	BalanceAfter  int       `json:"balance_after" gorm:"not null"` // at the location
+	UnitCost      float64   `json:"unit_cost"`
+	ReferenceType string    `json:"reference_type" gorm:"index:idx_stock_movements_reference"`
+	ReferenceID   uint      `json:"reference_id" gorm:"index:idx_stock_movements_reference"`
+	UserID        uint      `json:"user_id"`
+	Note          string    `json:"note"`
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Terminal is a till registered to a location. It signs its requests with
+// a key of its own, which is what lets cashiers log in on it with a PIN.
+type Terminal struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Name       string     `json:"name" gorm:"not null;size:100"`
+	LocationID uint       `json:"location_id" gorm:"not null;index"`
+	Location   *Location  `json:"location,omitempty"`
+	KeyHash    string     `json:"-" gorm:"not null;uniqueIndex;size:64"` // sha256 of the terminal key
+	IsActive   bool       `json:"is_active" gorm:"default:true"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	LastIP     string     `json:"last_ip" gorm:"size:45"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
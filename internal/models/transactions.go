@@ -9,27 +9,40 @@ import (
 type Transaction struct {
 	ID            uint              `json:"id" gorm:"primaryKey"`
 	UserID        uint              `json:"user_id" gorm:"not null"`
+	LocationID    uint              `json:"location_id" gorm:"not null;index"`
+	CustomerID    *uint             `json:"customer_id" gorm:"index"`
+	Customer      *Customer         `json:"customer,omitempty"`
+	PriceListID   *uint             `json:"price_list_id"` // price list the line prices came from
+	PriceList     *PriceList        `json:"price_list,omitempty"`
 	TransactionNo string            `json:"transaction_no" gorm:"unique;not null" validate:"required"`
 	User          User              `json:"user,omitempty"`
 	Items         []TransactionItem `json:"items,omitempty" gorm:"foreignKey:TransactionID"`
+	Approvals     []Approval        `json:"approvals,omitempty"`
 	TotalAmount   float64           `json:"total_amount" gorm:"not null" validate:"required,gt=0"`
 	PaymentMethod string            `json:"payment_method" gorm:"not null" validate:"required,oneof=cash card transfer"`
 	PaymentAmount float64           `json:"payment_amount" gorm:"not null" validate:"required,gt=0"`
 	ChangeAmount  float64           `json:"change_amount" gorm:"not null" validate:"required,gte=0"`
-	Status        string            `json:"status" gorm:"not null;default:'completed'" validate:"required,oneof=pending completed cancelled"`
+	Status        string            `json:"status" gorm:"not null;default:'completed'" validate:"required,oneof=pending completed cancelled voided"`
+	VoidedAt      *time.Time        `json:"voided_at"`
+	VoidReason    string            `json:"void_reason"`
 	CreatedAt     time.Time         `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt     time.Time         `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt     gorm.DeletedAt    `json:"deleted_at,omitempty" gorm:"index"`
 }
 
 type TransactionItem struct {
-	ID            uint      `json:"id" gorm:"primaryKey"`
-	TransactionID uint      `json:"transaction_id"`
-	ProductID     uint      `json:"product_id"`
-	Product       Product   `json:"product,omitempty"`
-	Quantity      int       `json:"quantity" validate:"required,gt=0"`
-	Price         float64   `json:"price"`
-	Subtotal      float64   `json:"subtotal"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            uint                    `json:"id" gorm:"primaryKey"`
+	TransactionID uint                    `json:"transaction_id"`
+	ProductID     uint                    `json:"product_id"`
+	Product       Product                 `json:"product,omitempty"`
+	Quantity      int                     `json:"quantity" validate:"required,gt=0"`
+	ListPrice     float64                 `json:"list_price"` // price before any override
+	Price         float64                 `json:"price"`
+	Discount      float64                 `json:"discount"` // amount taken off the line
+	Cost          float64                 `json:"cost"`     // unit cost at the time of sale
+	Subtotal      float64                 `json:"subtotal"`
+	Lots          []TransactionItemLot    `json:"lots,omitempty" gorm:"foreignKey:TransactionItemID"`
+	Serials       []TransactionItemSerial `json:"serials,omitempty" gorm:"foreignKey:TransactionItemID"`
+	CreatedAt     time.Time               `json:"created_at"`
+	UpdatedAt     time.Time               `json:"updated_at"`
 }
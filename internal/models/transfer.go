@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// Stock transfer statuses
+const (
+	TransferRequested = "requested"
+	TransferShipped   = "shipped"
+	TransferReceived  = "received"
+	TransferCancelled = "cancelled"
+)
+
+// StockTransfer moves stock between two locations. While shipped, the goods
+// are held at the in-transit location so both sides of the ledger balance.
+type StockTransfer struct {
+	ID             uint                `json:"id" gorm:"primaryKey"`
+	TransferNo     string              `json:"transfer_no" gorm:"unique;not null"`
+	FromLocationID uint                `json:"from_location_id" gorm:"not null;index"`
+	FromLocation   Location            `json:"from_location,omitempty"`
+	ToLocationID   uint                `json:"to_location_id" gorm:"not null;index"`
+	ToLocation     Location            `json:"to_location,omitempty"`
+	Status         string              `json:"status" gorm:"not null;default:'requested';index"`
+	Notes          string              `json:"notes"`
+	RequestedBy    uint                `json:"requested_by" gorm:"not null"`
+	ShippedBy      *uint               `json:"shipped_by"`
+	ReceivedBy     *uint               `json:"received_by"`
+	ShippedAt      *time.Time          `json:"shipped_at"`
+	ReceivedAt     *time.Time          `json:"received_at"`
+	Items          []StockTransferItem `json:"items,omitempty" gorm:"foreignKey:StockTransferID"`
+	CreatedAt      time.Time           `json:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+}
+
+type StockTransferItem struct {
+	ID                uint    `json:"id" gorm:"primaryKey"`
+	StockTransferID   uint    `json:"stock_transfer_id" gorm:"not null;index"`
+	ProductID         uint    `json:"product_id" gorm:"not null"`
+	Product           Product `json:"product,omitempty"`
+	QuantityRequested int     `json:"quantity_requested" gorm:"not null"`
+	QuantityShipped   int     `json:"quantity_shipped" gorm:"not null;default:0"`
+	QuantityReceived  int     `json:"quantity_received" gorm:"not null;default:0"`
+	// Discrepancy is received minus shipped: negative for goods lost in
+	// transit, positive for extra goods found on arrival.
+	Discrepancy     int                       `json:"discrepancy" gorm:"not null;default:0"`
+	DiscrepancyNote string                    `json:"discrepancy_note"`
+	Lots            []StockTransferItemLot    `json:"lots,omitempty" gorm:"foreignKey:StockTransferItemID"`
+	Serials         []StockTransferItemSerial `json:"serials,omitempty" gorm:"foreignKey:StockTransferItemID"`
+}
+
+// StockTransferItemLot is a lot held in transit for a transfer line.
+type StockTransferItemLot struct {
+	ID                  uint     `json:"id" gorm:"primaryKey"`
+	StockTransferItemID uint     `json:"stock_transfer_item_id" gorm:"not null;index"`
+	StockLotID          uint     `json:"stock_lot_id" gorm:"not null"`
+	StockLot            StockLot `json:"stock_lot,omitempty"`
+	Quantity            int      `json:"quantity" gorm:"not null"`
+}
+
+// StockTransferItemSerial is a serial-tracked unit shipped on a transfer line.
+type StockTransferItemSerial struct {
+	ID                  uint         `json:"id" gorm:"primaryKey"`
+	StockTransferItemID uint         `json:"stock_transfer_item_id" gorm:"not null;index"`
+	SerialNumberID      uint         `json:"serial_number_id" gorm:"not null"`
+	SerialNumber        SerialNumber `json:"serial_number,omitempty"`
+	Received            bool         `json:"received" gorm:"default:false"`
+}
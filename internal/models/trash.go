@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Trash audit actions
+const (
+	TrashDeleted  = "deleted"
+	TrashRestored = "restored"
+	TrashPurged   = "purged"
+)
+
+// TrashEvent records a record being soft deleted, restored from the trash or
+// purged for good
+type TrashEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	RecordType string    `json:"record_type" gorm:"not null;size:20;index:idx_trash_events_record"` // products, categories, users or transactions
+	RecordID   uint      `json:"record_id" gorm:"not null;index:idx_trash_events_record"`
+	Label      string    `json:"label"` // name or number of the record at the time
+	Action     string    `json:"action" gorm:"not null;size:20"`
+	UserID     *uint     `json:"user_id"` // nil for the automatic purge
+	User       *User     `json:"user,omitempty"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// TwoFactor is a user's TOTP secret. It is pending until the user proves
+// their authenticator app works by entering a code, and only then asked
+// for when they log in.
+type TwoFactor struct {
+	UserID    uint       `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Secret    string     `json:"-" gorm:"not null;size:64"`
+	EnabledAt *time.Time `json:"enabled_at"` // nil while pending
+	LastStep  int64      `json:"-"`          // time step of the last code used, so none is used twice
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// RecoveryCode lets a user log in once without their authenticator app.
+// Only its hash is kept.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null;size:64;index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// LoginChallenge is handed out when a password is right but the account
+// needs a second step, and traded for tokens with a TOTP or recovery code.
+// Only a hash of its token is kept.
+type LoginChallenge struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TokenHash string    `json:"-" gorm:"not null;uniqueIndex;size:64"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Attempts  int       `json:"attempts" gorm:"not null;default:0"` // wrong codes entered
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -8,14 +8,18 @@ import (
 )
 
 type User struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Username  string         `json:"username" gorm:"unique;not null" validate:"required,min=3,max=20"`
-	Password  string         `json:"-" gorm:"not null" validate:"required,min=6,max=100"`
-	Email     string         `json:"email" gorm:"unique;not null" validate:"required,email"`
-	Role      string         `json:"role" gorm:"not null;default:'cashier'" validate:"required,oneof=admin cashier"`
-	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
-	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	ID                 uint           `json:"id" gorm:"primaryKey"`
+	Username           string         `json:"username" gorm:"not null;size:191" validate:"required,min=3,max=20"` // username and email are unique among users not in the trash
+	Password           string         `json:"-" gorm:"not null" validate:"required,min=6,max=100"`
+	Email              string         `json:"email" gorm:"not null;size:191" validate:"required,email"`
+	PINHash            string         `json:"-"`                                                                         // bcrypt hash of the supervisor PIN; empty until one is set
+	Role               string         `json:"role" gorm:"not null;size:50;default:'cashier'" validate:"required,max=50"` // name of a role
+	MustChangePassword bool           `json:"must_change_password" gorm:"not null;default:false"`                        // set to make the user change their password before doing anything else
+	LocationID         *uint          `json:"location_id"`                                                               // assigned store; nil for head office users
+	Location           *Location      `json:"location,omitempty"`
+	CreatedAt          time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt          time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt          gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 }
 
 func (u *User) HashPassword() error {
@@ -27,6 +31,24 @@ func (u *User) HashPassword() error {
 	return nil
 }
 
+// SetPIN stores a hash of the user's PIN
+func (u *User) SetPIN(pin string) error {
+	hashedPIN, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PINHash = string(hashedPIN)
+	return nil
+}
+
+// CheckPIN reports whether pin is the user's PIN
+func (u *User) CheckPIN(pin string) bool {
+	if u.PINHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.PINHash), []byte(pin)) == nil
+}
+
 func (u *User) CheckPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	return err == nil
@@ -0,0 +1,60 @@
+// Package pricing works out the price a product sells at.
+package pricing
+
+import (
+	"POS-Golang/internal/models"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ActiveList returns the price list for a sale: the one asked for, else the
+// customer's list, else the default list. It returns nil when none applies,
+// in which case products sell at their own price.
+func ActiveList(tx *gorm.DB, priceListID *uint, customer *models.Customer) (*models.PriceList, error) {
+	if priceListID == nil && customer != nil {
+		priceListID = customer.PriceListID
+	}
+
+	var list models.PriceList
+	if priceListID != nil {
+		if err := tx.First(&list, *priceListID).Error; err != nil {
+			return nil, fmt.Errorf("price list %d not found", *priceListID)
+		}
+		if !list.IsActive {
+			return nil, fmt.Errorf("price list %s is not active", list.Name)
+		}
+		return &list, nil
+	}
+
+	err := tx.Where("is_default = ? AND is_active = ?", true, true).First(&list).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// UnitPrice returns the price of one unit of the product when quantity units
+// are bought from the list: the quantity break with the highest minimum not
+// above the quantity, or the product's own price when the list has none.
+func UnitPrice(tx *gorm.DB, list *models.PriceList, product models.Product, quantity int) (float64, error) {
+	if list == nil {
+		return product.Price, nil
+	}
+
+	var item models.PriceListItem
+	err := tx.Where("price_list_id = ? AND product_id = ? AND min_quantity <= ?", list.ID, product.ID, quantity).
+		Order("min_quantity DESC").
+		First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return product.Price, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return item.Price, nil
+}
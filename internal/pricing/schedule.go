@@ -0,0 +1,174 @@
+package pricing
+
+import (
+	"POS-Golang/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PriceUpdate describes a change to a product's price for the price history
+type PriceUpdate struct {
+	Price         float64
+	Source        string // one of the models.PriceSource values
+	PriceChangeID *uint
+	UserID        uint
+	Note          string
+}
+
+// SetPrice sets the product's price and records the change in the price
+// history. It does nothing when the price is unchanged.
+func SetPrice(tx *gorm.DB, product *models.Product, update PriceUpdate) error {
+	if update.Price == product.Price {
+		return nil
+	}
+	oldPrice := product.Price
+
+	if err := tx.Model(product).UpdateColumn("price", update.Price).Error; err != nil {
+		return err
+	}
+	return RecordPrice(tx, product.ID, oldPrice, update)
+}
+
+// RecordPrice adds a price history entry for a price already written to the
+// product, as done by UpdateProduct and the product import
+func RecordPrice(tx *gorm.DB, productID uint, oldPrice float64, update PriceUpdate) error {
+	if update.Price == oldPrice {
+		return nil
+	}
+	return tx.Create(&models.PriceHistory{
+		ProductID:     productID,
+		OldPrice:      oldPrice,
+		NewPrice:      update.Price,
+		Source:        update.Source,
+		PriceChangeID: update.PriceChangeID,
+		UserID:        update.UserID,
+		Note:          update.Note,
+	}).Error
+}
+
+// Apply applies a scheduled price change. The change is locked and checked
+// again so a change cancelled or applied meanwhile is left alone; it reports
+// whether the change was applied. A percentage change is worked out from the
+// price at the time it is applied, so a price edited by hand meanwhile is
+// raised or lowered rather than overwritten.
+func Apply(tx *gorm.DB, id uint, now time.Time) (bool, error) {
+	var change models.PriceChange
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&change, id).Error; err != nil {
+		return false, err
+	}
+	if change.Status != models.PriceChangeScheduled {
+		return false, nil
+	}
+
+	var product models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, change.ProductID).Error; err != nil {
+		// A product deleted since is skipped by cancelling its change
+		return false, tx.Model(&change).Updates(map[string]interface{}{
+			"status": models.PriceChangeCancelled,
+			"note":   appendNote(change.Note, "product no longer exists"),
+		}).Error
+	}
+
+	if change.Percentage != nil {
+		newPrice := math.Round(product.Price*(1+*change.Percentage/100)*100) / 100
+		if newPrice <= 0 {
+			return false, tx.Model(&change).Updates(map[string]interface{}{
+				"status": models.PriceChangeCancelled,
+				"note":   appendNote(change.Note, "new price would not be above zero"),
+			}).Error
+		}
+		change.NewPrice = newPrice
+	}
+
+	oldPrice := product.Price
+	err := SetPrice(tx, &product, PriceUpdate{
+		Price:         change.NewPrice,
+		Source:        models.PriceSourceScheduled,
+		PriceChangeID: &change.ID,
+		UserID:        change.CreatedBy,
+		Note:          change.Note,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Model(&change).Updates(map[string]interface{}{
+		"status":     models.PriceChangeApplied,
+		"old_price":  oldPrice,
+		"new_price":  change.NewPrice,
+		"applied_at": now,
+	}).Error
+}
+
+// ApplyDue applies every scheduled price change whose effective time has
+// come, oldest first, each in its own database transaction. It returns the
+// number applied.
+func ApplyDue(db *gorm.DB, now time.Time) (int, error) {
+	var ids []uint
+	err := db.Model(&models.PriceChange{}).
+		Where("status = ? AND effective_at <= ?", models.PriceChangeScheduled, now).
+		Order("effective_at, id").
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	// A change that fails is left scheduled and retried next time, without
+	// holding up the others
+	applied := 0
+	var errs []error
+	for _, id := range ids {
+		var ok bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			ok, err = Apply(tx, id, now)
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("price change %d: %w", id, err))
+			continue
+		}
+		if ok {
+			applied++
+		}
+	}
+	return applied, errors.Join(errs...)
+}
+
+// RunScheduler applies due price changes every interval until the context is
+// cancelled. Changes that came due while the server was down are applied on
+// the first run.
+func RunScheduler(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		applied, err := ApplyDue(db, time.Now())
+		if err != nil {
+			log.Printf("price scheduler: %v", err)
+		}
+		if applied > 0 {
+			log.Printf("price scheduler: applied %d price changes", applied)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func appendNote(note, extra string) string {
+	if note == "" {
+		return extra
+	}
+	return note + "; " + extra
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"POS-Golang/internal/models"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DB counts failed attempts per key in the rate_limits table, so every
+// instance behind a load balancer sees the same counts
+type DB struct {
+	db     *gorm.DB
+	policy Policy
+}
+
+// NewDB returns a database-backed limiter
+func NewDB(db *gorm.DB, policy Policy) *DB {
+	return &DB{db: db, policy: policy}
+}
+
+func (l *DB) Blocked(key string) (time.Duration, error) {
+	var row models.RateLimit
+	err := l.db.Where("`key` = ?", key).Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && row.LockedUntil == nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return max(time.Until(*row.LockedUntil), 0), nil
+}
+
+func (l *DB) Fail(key string) (time.Duration, error) {
+	var lockout time.Duration
+	err := l.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// The count is raised by the database, so failures made at once on
+		// several instances all count. Failures that no longer count start
+		// again from one; failures is assigned first so that it still sees
+		// the previous last_fail_at.
+		err := tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "failures"}, Value: gorm.Expr("IF(last_fail_at < ?, 1, failures + 1)", now.Add(-l.policy.MaxLockout))},
+				{Column: clause.Column{Name: "last_fail_at"}, Value: now},
+			},
+		}).Create(&models.RateLimit{Key: key, Failures: 1, LastFailAt: now}).Error
+		if err != nil {
+			return err
+		}
+
+		// The upsert holds the row's lock until the transaction ends
+		var row models.RateLimit
+		if err := tx.Where("`key` = ?", key).Take(&row).Error; err != nil {
+			return err
+		}
+		lockout = l.policy.lockout(row.Failures)
+		var lockedUntil *time.Time
+		if lockout > 0 {
+			until := now.Add(lockout)
+			lockedUntil = &until
+		}
+		return tx.Model(&row).Update("locked_until", lockedUntil).Error
+	})
+	return lockout, err
+}
+
+func (l *DB) Reset(key string) error {
+	return l.db.Where("`key` = ?", key).Delete(&models.RateLimit{}).Error
+}
+
+// RunCleanup deletes the rows of keys whose failures no longer count every
+// interval until the context is cancelled
+func (l *DB) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		if err := l.db.Where("last_fail_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-l.policy.MaxLockout), now).
+			Delete(&models.RateLimit{}).Error; err != nil {
+			log.Printf("rate limit cleanup: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
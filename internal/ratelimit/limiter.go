@@ -0,0 +1,47 @@
+// Package ratelimit locks out keys, such as an account or an IP address,
+// after too many failed attempts, backing off exponentially.
+package ratelimit
+
+import "time"
+
+// Limiter tracks failed attempts per key. Memory keeps them in the
+// process; DB shares them between instances through the database.
+type Limiter interface {
+	// Blocked returns how long the key is still locked out for, or zero
+	Blocked(key string) (time.Duration, error)
+	// Fail records a failed attempt and returns how long the key is now
+	// locked out for, or zero
+	Fail(key string) (time.Duration, error)
+	// Reset clears the key's failures, after a success or an unlock
+	Reset(key string) error
+}
+
+// Policy sets how many failures a key is allowed before it is locked out.
+// The first lockout lasts Lockout, each further failure doubles it up to
+// MaxLockout, and failures are forgotten after MaxLockout without any.
+type Policy struct {
+	Attempts   int
+	Lockout    time.Duration
+	MaxLockout time.Duration
+}
+
+// lockout returns how long a key with failures failures is locked out for
+func (p Policy) lockout(failures int) time.Duration {
+	if failures < p.Attempts {
+		return 0
+	}
+	d := p.Lockout
+	for i := p.Attempts; i < failures && d < p.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > p.MaxLockout {
+		d = p.MaxLockout
+	}
+	return d
+}
+
+// forgotten reports whether failures last made at lastFailAt no longer
+// count
+func (p Policy) forgotten(lastFailAt, now time.Time) bool {
+	return now.Sub(lastFailAt) > p.MaxLockout
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Memory counts failed attempts per key in memory. Counts are lost on
+// restart and not shared between instances.
+type Memory struct {
+	mu      sync.Mutex
+	policy  Policy
+	entries map[string]*entry
+}
+
+type entry struct {
+	failures    int
+	lastFailAt  time.Time
+	lockedUntil time.Time
+}
+
+// NewMemory returns an in-memory limiter
+func NewMemory(policy Policy) *Memory {
+	return &Memory{
+		policy:  policy,
+		entries: make(map[string]*entry),
+	}
+}
+
+func (m *Memory) Blocked(key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	return max(time.Until(e.lockedUntil), 0), nil
+}
+
+func (m *Memory) Fail(key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	e, ok := m.entries[key]
+	if !ok || m.policy.forgotten(e.lastFailAt, now) {
+		if len(m.entries) > 1000 {
+			m.prune(now)
+		}
+		e = &entry{}
+		m.entries[key] = e
+	}
+
+	e.failures++
+	e.lastFailAt = now
+	lockout := m.policy.lockout(e.failures)
+	e.lockedUntil = now.Add(lockout)
+	return lockout, nil
+}
+
+func (m *Memory) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// prune drops entries whose failures no longer count
+func (m *Memory) prune(now time.Time) {
+	for key, e := range m.entries {
+		if now.After(e.lockedUntil) && m.policy.forgotten(e.lastFailAt, now) {
+			delete(m.entries, key)
+		}
+	}
+}
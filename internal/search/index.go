@@ -0,0 +1,435 @@
+// Package search is an in-memory full-text index of the product catalogue.
+// It ranks products by how well their name, codes, category and
+// description match a query, matching the last word as a prefix so results
+// come up while typing, and tolerating small typos.
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Document is the searchable text of a product
+type Document struct {
+	ID          uint
+	Name        string
+	Description string
+	Barcode     string
+	SKU         string
+	Category    string
+}
+
+// Result is a product matching a query, with its relevance score
+type Result struct {
+	ID    uint
+	Score float64
+}
+
+// How much a match in each field counts
+const (
+	weightName        = 3.0
+	weightCode        = 3.0 // barcode and SKU
+	weightCategory    = 1.5
+	weightDescription = 1.0
+)
+
+// How much each kind of match counts, relative to an exact word match
+const (
+	matchExact  = 1.0
+	matchPrefix = 0.8
+	matchTypo1  = 0.6 // one edit away
+	matchTypo2  = 0.4 // two edits away
+
+	// A query that is a product's whole barcode or SKU puts it first
+	exactCodeBonus = 100.0
+
+	// Prefixes expand to at most this many words, which keeps one-letter
+	// queries fast
+	maxPrefixTerms = 500
+
+	// Typos are only looked for when a word matches fewer products than
+	// this exactly or as a prefix
+	typoThreshold = 50
+)
+
+// Index is a full-text index safe for concurrent use
+type Index struct {
+	mu       sync.RWMutex
+	ready    bool
+	docs     map[uint]*entry
+	postings map[string]map[uint]float64 // word -> product -> best field weight
+	codes    map[string]map[uint]bool    // whole barcode or SKU -> products
+
+	// Vocabulary, sorted for prefix matching and by length for typo
+	// matching
+	terms    []string
+	byLength map[int][]word
+	bulk     bool // vocabulary is built once at the end, by Replace
+}
+
+type word struct {
+	text  string
+	runes []rune
+}
+
+type entry struct {
+	nameLength int
+	terms      []string
+	codes      []string
+}
+
+// New returns an empty index. It reports not ready until the first
+// Replace, so callers can fall back to another search meanwhile.
+func New() *Index {
+	return &Index{
+		docs:     make(map[uint]*entry),
+		postings: make(map[string]map[uint]float64),
+		codes:    make(map[string]map[uint]bool),
+		byLength: make(map[int][]word),
+	}
+}
+
+// Ready reports whether the index has been filled
+func (idx *Index) Ready() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.ready
+}
+
+// Len returns the number of products indexed
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Replace swaps the whole contents of the index for the documents given
+func (idx *Index) Replace(docs []Document) {
+	fresh := New()
+	fresh.bulk = true
+	for _, doc := range docs {
+		fresh.add(doc)
+	}
+	fresh.rebuildTerms()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.docs, idx.postings, idx.codes = fresh.docs, fresh.postings, fresh.codes
+	idx.terms, idx.byLength = fresh.terms, fresh.byLength
+	idx.ready = true
+}
+
+// Update adds or replaces the documents given and removes the products
+// listed in remove
+func (idx *Index) Update(docs []Document, remove []uint) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, id := range remove {
+		idx.remove(id)
+	}
+	for _, doc := range docs {
+		idx.remove(doc.ID)
+		idx.add(doc)
+	}
+}
+
+// Search returns the products matching every word of the query, best match
+// first, up to limit results
+func (idx *Index) Search(query string, limit int) []Result {
+	words := Tokenize(query)
+	if len(words) == 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	m := &matcher{idx: idx}
+	var scores map[uint]float64
+	for i, word := range words {
+		wordScores := m.matchWord(word, i == len(words)-1)
+		if scores == nil {
+			scores = wordScores
+			continue
+		}
+		// Every word must match
+		for id, score := range scores {
+			if extra, ok := wordScores[id]; ok {
+				scores[id] = score + extra
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	code := strings.ToLower(strings.TrimSpace(query))
+	for id := range idx.codes[code] {
+		scores[id] += exactCodeBonus
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, Result{ID: id, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		// Of equal matches, the shorter name is the closer one
+		if la, lb := idx.docs[a.ID].nameLength, idx.docs[b.ID].nameLength; la != lb {
+			return la < lb
+		}
+		return a.ID < b.ID
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// matcher looks up the words of one query, reusing its buffers
+type matcher struct {
+	idx  *Index
+	rows [3][]int
+}
+
+// matchWord scores every product containing the word, a word it is a
+// prefix of (for the last word of the query), or, when those are few, a
+// word a typo or two away
+func (m *matcher) matchWord(text string, last bool) map[uint]float64 {
+	idx := m.idx
+	scores := make(map[uint]float64)
+	collect := func(term string, match float64) {
+		for id, weight := range idx.postings[term] {
+			if score := weight * match; score > scores[id] {
+				scores[id] = score
+			}
+		}
+	}
+
+	collect(text, matchExact)
+
+	if last {
+		start := sort.SearchStrings(idx.terms, text)
+		for i, n := start, 0; i < len(idx.terms) && n < maxPrefixTerms && strings.HasPrefix(idx.terms[i], text); i++ {
+			if idx.terms[i] != text {
+				collect(idx.terms[i], matchPrefix)
+				n++
+			}
+		}
+	}
+
+	maxEdits := allowedEdits(text)
+	if maxEdits == 0 || len(scores) >= typoThreshold {
+		return scores
+	}
+
+	runes := []rune(text)
+	for length := len(runes) - maxEdits; length <= len(runes)+maxEdits; length++ {
+		for _, term := range idx.byLength[length] {
+			if edits := m.distance(runes, term.runes, maxEdits); edits > 0 && edits <= maxEdits {
+				collect(term.text, typoMatch(edits))
+			}
+		}
+	}
+
+	// The last word may be a mistyped beginning of a longer word
+	if last {
+		for length, terms := range idx.byLength {
+			if length <= len(runes) {
+				continue
+			}
+			for _, term := range terms {
+				if edits := m.distance(runes, term.runes[:len(runes)], maxEdits); edits > 0 && edits <= maxEdits {
+					collect(term.text, typoMatch(edits)*matchPrefix)
+				}
+			}
+		}
+	}
+	return scores
+}
+
+func (idx *Index) add(doc Document) {
+	e := &entry{nameLength: len(doc.Name)}
+	fields := []struct {
+		text   string
+		weight float64
+	}{
+		{doc.Name, weightName},
+		{doc.Barcode, weightCode},
+		{doc.SKU, weightCode},
+		{doc.Category, weightCategory},
+		{doc.Description, weightDescription},
+	}
+
+	weights := make(map[string]float64)
+	for _, field := range fields {
+		for _, term := range Tokenize(field.text) {
+			if field.weight > weights[term] {
+				weights[term] = field.weight
+			}
+		}
+	}
+	// Whole codes, punctuation and all, are kept for exact lookups
+	for _, code := range []string{doc.Barcode, doc.SKU} {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if code == "" {
+			continue
+		}
+		if idx.codes[code] == nil {
+			idx.codes[code] = make(map[uint]bool)
+		}
+		idx.codes[code][doc.ID] = true
+		e.codes = append(e.codes, code)
+	}
+
+	for term, weight := range weights {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[uint]float64)
+			if !idx.bulk {
+				idx.addTerm(term)
+			}
+		}
+		idx.postings[term][doc.ID] = weight
+		e.terms = append(e.terms, term)
+	}
+	idx.docs[doc.ID] = e
+}
+
+func (idx *Index) remove(id uint) {
+	e, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range e.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+			idx.removeTerm(term)
+		}
+	}
+	for _, code := range e.codes {
+		delete(idx.codes[code], id)
+		if len(idx.codes[code]) == 0 {
+			delete(idx.codes, code)
+		}
+	}
+	delete(idx.docs, id)
+}
+
+func (idx *Index) rebuildTerms() {
+	idx.terms = make([]string, 0, len(idx.postings))
+	idx.byLength = make(map[int][]word)
+	for term := range idx.postings {
+		idx.terms = append(idx.terms, term)
+		runes := []rune(term)
+		idx.byLength[len(runes)] = append(idx.byLength[len(runes)], word{term, runes})
+	}
+	sort.Strings(idx.terms)
+	idx.bulk = false
+}
+
+// addTerm adds a new word to the vocabulary
+func (idx *Index) addTerm(term string) {
+	i := sort.SearchStrings(idx.terms, term)
+	idx.terms = append(idx.terms, "")
+	copy(idx.terms[i+1:], idx.terms[i:])
+	idx.terms[i] = term
+
+	runes := []rune(term)
+	idx.byLength[len(runes)] = append(idx.byLength[len(runes)], word{term, runes})
+}
+
+// removeTerm removes a word no product uses any more from the vocabulary
+func (idx *Index) removeTerm(term string) {
+	if i := sort.SearchStrings(idx.terms, term); i < len(idx.terms) && idx.terms[i] == term {
+		idx.terms = append(idx.terms[:i], idx.terms[i+1:]...)
+	}
+
+	length := len([]rune(term))
+	bucket := idx.byLength[length]
+	for i := range bucket {
+		if bucket[i].text == term {
+			bucket[i] = bucket[len(bucket)-1]
+			idx.byLength[length] = bucket[:len(bucket)-1]
+			break
+		}
+	}
+}
+
+// Tokenize splits text into lower-case words of letters and digits
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// allowedEdits is how many typos a word may have: none in short words or
+// numbers, where a typo is as likely to be a different product
+func allowedEdits(word string) int {
+	if strings.IndexFunc(word, unicode.IsLetter) < 0 {
+		return 0
+	}
+	switch length := len([]rune(word)); {
+	case length >= 8:
+		return 2
+	case length >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func typoMatch(edits int) float64 {
+	if edits == 1 {
+		return matchTypo1
+	}
+	return matchTypo2
+}
+
+// distance returns the optimal string alignment distance between a and b:
+// the insertions, deletions, substitutions and swaps of adjacent letters
+// needed to turn one into the other. It stops early and returns max+1 once
+// the distance is known to be more than max.
+func (m *matcher) distance(a, b []rune, max int) int {
+	if diff := len(a) - len(b); diff > max || -diff > max {
+		return max + 1
+	}
+
+	for i := range m.rows {
+		if cap(m.rows[i]) < len(b)+1 {
+			m.rows[i] = make([]int, len(b)+1)
+		}
+		m.rows[i] = m.rows[i][:len(b)+1]
+	}
+	prev2, prev, cur := m.rows[0], m.rows[1], m.rows[2]
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,286 @@
+package search
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Columns of products that are indexed; writes touching only other columns,
+// such as stock and price updates, leave the index alone
+var indexedColumns = map[string]bool{
+	"name": true, "description": true, "barcode": true, "sku": true,
+	"category_id": true, "deleted_at": true,
+}
+
+// Changes are reindexed once writes have been quiet for syncDelay, so a
+// batch of writes is reindexed once and after its transaction has
+// committed, but never later than syncMaxDelay after the first
+const (
+	syncDelay    = 500 * time.Millisecond
+	syncMaxDelay = 10 * time.Second
+)
+
+// Syncer keeps an index in step with the products table. Writes to
+// products and categories made through GORM are noticed by callbacks; the
+// products they touched are reloaded shortly after, and the whole index is
+// rebuilt from time to time to catch anything else.
+type Syncer struct {
+	index *Index
+	db    *gorm.DB
+
+	mu      sync.Mutex
+	pending map[uint]bool
+	full    bool
+	wake    chan struct{}
+}
+
+// NewSyncer registers callbacks on db that queue changed products for
+// reindexing
+func NewSyncer(db *gorm.DB, index *Index) (*Syncer, error) {
+	s := &Syncer{
+		index:   index,
+		db:      db,
+		pending: make(map[uint]bool),
+		wake:    make(chan struct{}, 1),
+	}
+
+	callbacks := db.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("search:sync_create", s.noticeWrite); err != nil {
+		return nil, err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("search:sync_update", s.noticeWrite); err != nil {
+		return nil, err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("search:sync_delete", s.noticeWrite); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Run builds the index and keeps it up to date until the context is
+// cancelled, rebuilding it in full every refresh interval
+func (s *Syncer) Run(ctx context.Context, refresh time.Duration) {
+	if err := s.rebuild(); err != nil {
+		log.Printf("search index: %v", err)
+	}
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.queueFull()
+		case <-s.wake:
+		}
+
+		if !s.settle(ctx) {
+			return
+		}
+		if err := s.flush(); err != nil {
+			log.Printf("search index: %v", err)
+		}
+	}
+}
+
+// settle waits for writes to go quiet, reporting false if the context is
+// cancelled meanwhile
+func (s *Syncer) settle(ctx context.Context) bool {
+	deadline := time.After(syncMaxDelay)
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline:
+			return true
+		case <-s.wake:
+		case <-time.After(syncDelay):
+			return true
+		}
+	}
+}
+
+// noticeWrite queues the products a write touched. Writes that do not
+// name their products, and any change to categories, queue a full rebuild.
+func (s *Syncer) noticeWrite(tx *gorm.DB) {
+	if tx.Error != nil || tx.Statement.Schema == nil || tx.RowsAffected == 0 {
+		return
+	}
+
+	switch tx.Statement.Schema.Table {
+	case "categories":
+		s.queueFull()
+	case "products":
+		if !touchesIndexedColumns(tx.Statement) {
+			return
+		}
+		// Conditions given alongside a model with an ID only narrow the
+		// write further, so its ID is enough
+		if ids := statementIDs(tx.Statement); len(ids) > 0 {
+			s.queue(ids)
+		} else {
+			s.queueFull()
+		}
+	}
+}
+
+func (s *Syncer) queue(ids []uint) {
+	s.mu.Lock()
+	for _, id := range ids {
+		s.pending[id] = true
+	}
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *Syncer) queueFull() {
+	s.mu.Lock()
+	s.full = true
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *Syncer) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// flush applies the queued changes
+func (s *Syncer) flush() error {
+	s.mu.Lock()
+	full, pending := s.full, s.pending
+	s.full, s.pending = false, make(map[uint]bool)
+	s.mu.Unlock()
+
+	if full {
+		return s.rebuild()
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	docs, err := s.load(ids)
+	if err != nil {
+		// Try again with the next batch
+		s.queue(ids)
+		return err
+	}
+
+	// Products not found any more were deleted
+	found := make(map[uint]bool, len(docs))
+	for _, doc := range docs {
+		found[doc.ID] = true
+	}
+	var removed []uint
+	for _, id := range ids {
+		if !found[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	s.index.Update(docs, removed)
+	return nil
+}
+
+func (s *Syncer) rebuild() error {
+	docs, err := s.load(nil)
+	if err != nil {
+		return err
+	}
+	s.index.Replace(docs)
+	return nil
+}
+
+// load reads the searchable text of the products given, or of every
+// product
+func (s *Syncer) load(ids []uint) ([]Document, error) {
+	query := s.db.Session(&gorm.Session{NewDB: true}).Table("products").
+		Select("products.id, products.name, products.description, COALESCE(products.barcode, '') AS barcode, " +
+			"COALESCE(products.sku, '') AS sku, COALESCE(categories.name, '') AS category").
+		Joins("LEFT JOIN categories ON categories.id = products.category_id AND categories.deleted_at IS NULL").
+		Where("products.deleted_at IS NULL")
+	if ids != nil {
+		query = query.Where("products.id IN ?", ids)
+	}
+
+	var docs []Document
+	err := query.Scan(&docs).Error
+	return docs, err
+}
+
+// touchesIndexedColumns reports whether an update may change indexed text.
+// Creates, deletes and full saves always may.
+func touchesIndexedColumns(stmt *gorm.Statement) bool {
+	var columns []string
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		for column := range dest {
+			columns = append(columns, column)
+		}
+	default:
+		if len(stmt.Selects) == 0 || stmt.Selects[0] == "*" {
+			return true
+		}
+		columns = stmt.Selects
+	}
+
+	for _, column := range columns {
+		if field := stmt.Schema.LookUpField(column); field != nil {
+			column = field.DBName
+		}
+		if indexedColumns[column] {
+			return true
+		}
+	}
+	return false
+}
+
+// statementIDs returns the IDs of the products a statement was run on
+func statementIDs(stmt *gorm.Statement) []uint {
+	var ids []uint
+	value := stmt.ReflectValue
+	collect := func(v reflect.Value) {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct || stmt.Schema.PrioritizedPrimaryField == nil {
+			return
+		}
+		if id, isZero := stmt.Schema.PrioritizedPrimaryField.ValueOf(stmt.Context, v); !isZero {
+			if id, ok := id.(uint); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			collect(value.Index(i))
+		}
+	default:
+		collect(value)
+	}
+
+	// Update and UpdateColumn carry the model separately from the values
+	if len(ids) == 0 && stmt.Model != nil {
+		collect(reflect.ValueOf(stmt.Model))
+	}
+	return ids
+}
@@ -0,0 +1,48 @@
+// Package storage keeps uploaded files such as product images, on the local
+// filesystem or in an S3-compatible object store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when no object has the key asked for
+var ErrNotFound = errors.New("object not found")
+
+// Storage stores objects under slash-separated keys such as
+// "products/12/5f2c.jpg"
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get opens an object; the caller closes its Body
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes an object. Deleting one that does not exist is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Object is a stored object being read
+type Object struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// CheckKey rejects keys that are empty, absolute, or step outside the store
+// with "..", so a key taken from a URL cannot reach other files
+func CheckKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid key %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,486 @@
+// Package trash lists, restores and purges soft-deleted records, and keeps
+// an audit log of records going into and out of the trash.
+package trash
+
+import (
+	"POS-Golang/internal/models"
+	"POS-Golang/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Types of record kept in the trash
+const (
+	Products     = "products"
+	Categories   = "categories"
+	Users        = "users"
+	Transactions = "transactions"
+)
+
+// Types lists the record types in the order they are shown
+var Types = []string{Products, Categories, Users, Transactions}
+
+// ErrNotFound is returned for a record that is not in the trash
+var ErrNotFound = errors.New("record not found in the trash")
+
+// InUseError is returned when a record cannot be purged because other
+// records still refer to it
+type InUseError struct {
+	Uses []string
+}
+
+func (e *InUseError) Error() string {
+	return "still referred to by " + strings.Join(e.Uses, ", ")
+}
+
+// reference selects the rows of a table that belong to a record; every ? in
+// where is the record ID
+type reference struct {
+	table string
+	where string
+	what  string
+}
+
+type kind struct {
+	table string
+	label string // SQL naming a record in lists and the audit log
+	model func() interface{}
+
+	// uses keep a record from being purged; owned rows are purged with it
+	uses  []reference
+	owned []reference
+
+	// restore checks that a record can come back, and fixes it up
+	restore func(tx *gorm.DB, id uint) error
+}
+
+var kinds = map[string]kind{
+	Products: {
+		table: "products",
+		label: "name",
+		model: func() interface{} { return &models.Product{} },
+		uses: []reference{
+			{"transaction_items", "product_id = ?", "sales lines"},
+			{"purchase_order_items", "product_id = ?", "purchase order lines"},
+			{"goods_receipt_items", "product_id = ?", "goods receipt lines"},
+			{"stock_transfer_items", "product_id = ?", "stock transfer lines"},
+			{"stock_movements", "product_id = ?", "stock movements"},
+			{"stock_lots", "product_id = ?", "stock lots"},
+			{"serial_numbers", "product_id = ?", "serial numbers"},
+			{"stock_levels", "product_id = ? AND quantity != 0", "stock levels"},
+		},
+		owned: []reference{
+			{"stock_levels", "product_id = ?", ""},
+			{"product_barcodes", "product_id = ?", ""},
+			{"product_images", "product_id = ?", ""},
+			{"product_tags", "product_id = ?", ""},
+			{"product_attributes", "product_id = ?", ""},
+			{"price_list_items", "product_id = ?", ""},
+			{"price_changes", "product_id = ?", ""},
+			{"price_histories", "product_id = ?", ""},
+		},
+		restore: restoreProduct,
+	},
+	Categories: {
+		table: "categories",
+		label: "name",
+		model: func() interface{} { return &models.Category{} },
+		uses: []reference{
+			{"products", "category_id = ?", "products, deleted ones included"},
+			{"categories", "parent_id = ?", "subcategories, deleted ones included"},
+		},
+		restore: restoreCategory,
+	},
+	Users: {
+		table: "users",
+		label: "username",
+		model: func() interface{} { return &models.User{} },
+		uses: []reference{
+			{"transactions", "user_id = ?", "sales"},
+			{"stock_movements", "user_id = ?", "stock movements"},
+			{"purchase_orders", "user_id = ?", "purchase orders"},
+			{"goods_receipts", "user_id = ?", "goods receipts"},
+			{"stock_transfers", "requested_by = ? OR shipped_by = ? OR received_by = ?", "stock transfers"},
+			{"price_changes", "created_by = ? OR cancelled_by = ?", "price changes"},
+			{"price_histories", "user_id = ?", "price history"},
+			{"trash_events", "user_id = ?", "trash audit entries"},
+			{"approvals", "approver_id = ? OR requested_by_id = ?", "approvals"},
+			{"invites", "created_by_id = ? OR accepted_user_id = ?", "invites"},
+			{"login_attempts", "user_id = ?", "login audit entries"},
+		},
+		owned: []reference{
+			{"refresh_tokens", "session_id IN (SELECT id FROM sessions WHERE user_id = ?)", ""},
+			{"sessions", "user_id = ?", ""},
+			{"password_resets", "user_id = ?", ""},
+			{"two_factors", "user_id = ?", ""},
+			{"recovery_codes", "user_id = ?", ""},
+			{"login_challenges", "user_id = ?", ""},
+		},
+		restore: restoreUser,
+	},
+	Transactions: {
+		table: "transactions",
+		label: "transaction_no",
+		model: func() interface{} { return &models.Transaction{} },
+		owned: []reference{
+			{"transaction_item_lots", "transaction_item_id IN (SELECT id FROM transaction_items WHERE transaction_id = ?)", ""},
+			{"transaction_item_serials", "transaction_item_id IN (SELECT id FROM transaction_items WHERE transaction_id = ?)", ""},
+			{"transaction_items", "transaction_id = ?", ""},
+			{"approvals", "transaction_id = ?", ""},
+		},
+	},
+}
+
+// Item is a record in the trash
+type Item struct {
+	ID        uint       `json:"id"`
+	Label     string     `json:"label"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	DeletedBy *uint      `json:"deleted_by"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty"` // when the automatic purge is due to remove it
+}
+
+// Valid reports whether records of the type are kept in the trash
+func Valid(recordType string) bool {
+	_, ok := kinds[recordType]
+	return ok
+}
+
+// List returns a page of the records of a type in the trash, most recently
+// deleted first. Names are matched against search when given.
+func List(db *gorm.DB, recordType, search string, offset, limit int, retention time.Duration) ([]Item, int64, error) {
+	k, ok := kinds[recordType]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown record type %s", recordType)
+	}
+
+	query := db.Table(k.table).Where("deleted_at IS NOT NULL")
+	if search != "" {
+		query = query.Where(k.label+" LIKE ?", "%"+search+"%")
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var items []Item
+	err := query.Select("id, " + k.label + " AS label, deleted_at").
+		Order("deleted_at DESC, id DESC").Offset(offset).Limit(limit).Scan(&items).Error
+	if err != nil || len(items) == 0 {
+		return items, total, err
+	}
+
+	// Who deleted each record, from the audit log
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	var events []models.TrashEvent
+	db.Where("record_type = ? AND record_id IN ? AND action = ?", recordType, ids, models.TrashDeleted).
+		Order("id").Find(&events)
+	deletedBy := make(map[uint]*uint, len(events))
+	for _, event := range events {
+		deletedBy[event.RecordID] = event.UserID
+	}
+
+	for i := range items {
+		items[i].DeletedBy = deletedBy[items[i].ID]
+		if retention > 0 {
+			purgeAt := items[i].DeletedAt.Add(retention)
+			items[i].PurgeAt = &purgeAt
+		}
+	}
+	return items, total, nil
+}
+
+// Counts returns the number of records of each type in the trash
+func Counts(db *gorm.DB) (map[string]int64, error) {
+	counts := make(map[string]int64, len(kinds))
+	for recordType, k := range kinds {
+		var count int64
+		if err := db.Table(k.table).Where("deleted_at IS NOT NULL").Count(&count).Error; err != nil {
+			return nil, err
+		}
+		counts[recordType] = count
+	}
+	return counts, nil
+}
+
+// Record adds an entry to the trash audit log
+func Record(tx *gorm.DB, action, recordType string, id uint, label string, userID *uint) error {
+	return tx.Create(&models.TrashEvent{
+		RecordType: recordType,
+		RecordID:   id,
+		Label:      label,
+		Action:     action,
+		UserID:     userID,
+	}).Error
+}
+
+// Restore brings a record back out of the trash. It fails when the record
+// would clash with one created since, such as a product reusing its
+// barcode, or depends on one still in the trash.
+func Restore(tx *gorm.DB, recordType string, id uint, userID *uint) error {
+	k, ok := kinds[recordType]
+	if !ok {
+		return fmt.Errorf("unknown record type %s", recordType)
+	}
+
+	model, label, err := trashed(tx, k, id)
+	if err != nil {
+		return err
+	}
+	if k.restore != nil {
+		if err := k.restore(tx, id); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Unscoped().Model(model).Update("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	return Record(tx, models.TrashRestored, recordType, id, label, userID)
+}
+
+// Purge deletes a record in the trash for good, along with the rows that
+// only exist for it. Records that other records still refer to, such as a
+// product with sales, are kept and an *InUseError returned. The storage
+// keys of files belonging to the record are returned so they can be removed
+// once the transaction commits.
+func Purge(tx *gorm.DB, recordType string, id uint, userID *uint) ([]string, error) {
+	k, ok := kinds[recordType]
+	if !ok {
+		return nil, fmt.Errorf("unknown record type %s", recordType)
+	}
+
+	model, label, err := trashed(tx, k, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var uses []string
+	for _, ref := range k.uses {
+		var count int64
+		if err := tx.Table(ref.table).Where(ref.where, referenceArgs(ref, id)...).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			uses = append(uses, fmt.Sprintf("%d %s", count, ref.what))
+		}
+	}
+	if len(uses) > 0 {
+		return nil, &InUseError{Uses: uses}
+	}
+
+	var files []string
+	if recordType == Products {
+		var images []models.ProductImage
+		if err := tx.Where("product_id = ?", id).Find(&images).Error; err != nil {
+			return nil, err
+		}
+		for _, image := range images {
+			files = append(files, image.Key, image.ThumbnailKey)
+		}
+	}
+
+	for _, ref := range k.owned {
+		sql := fmt.Sprintf("DELETE FROM %s WHERE %s", ref.table, ref.where)
+		if err := tx.Exec(sql, referenceArgs(ref, id)...).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Unscoped().Delete(model).Error; err != nil {
+		return nil, err
+	}
+	return files, Record(tx, models.TrashPurged, recordType, id, label, userID)
+}
+
+// PurgeExpired purges every record deleted longer ago than the retention
+// period, each in its own transaction, and removes their files from store.
+// It returns the number purged and the number kept because other records
+// still refer to them.
+func PurgeExpired(db *gorm.DB, store storage.Storage, retention time.Duration, now time.Time) (purged, kept int, err error) {
+	cutoff := now.Add(-retention)
+	var errs []error
+
+	// Sales go first, so the products and users they held on to can follow
+	for _, recordType := range []string{Transactions, Products, Categories, Users} {
+		var ids []uint
+		if err := db.Table(kinds[recordType].table).Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Order("id").Pluck("id", &ids).Error; err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, id := range ids {
+			var files []string
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				files, err = Purge(tx, recordType, id, nil)
+				return err
+			})
+
+			var inUse *InUseError
+			switch {
+			case errors.As(err, &inUse):
+				kept++
+			case err != nil:
+				errs = append(errs, fmt.Errorf("%s %d: %w", recordType, id, err))
+			default:
+				purged++
+				RemoveFiles(context.Background(), store, files)
+			}
+		}
+	}
+	return purged, kept, errors.Join(errs...)
+}
+
+// RunPurger purges records past the retention period every interval until
+// the context is cancelled
+func RunPurger(ctx context.Context, db *gorm.DB, store storage.Storage, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, kept, err := PurgeExpired(db, store, retention, time.Now())
+		if err != nil {
+			log.Printf("trash purge: %v", err)
+		}
+		if purged > 0 {
+			log.Printf("trash purge: purged %d records, kept %d still in use", purged, kept)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RemoveFiles deletes files of purged records. A file left behind by a
+// storage error is only wasted space.
+func RemoveFiles(ctx context.Context, store storage.Storage, keys []string) {
+	if store == nil {
+		return
+	}
+	for _, key := range keys {
+		store.Delete(ctx, key)
+	}
+}
+
+// trashed loads and locks a record in the trash
+func trashed(tx *gorm.DB, k kind, id uint) (interface{}, string, error) {
+	model := k.model()
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("deleted_at IS NOT NULL").First(model, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	var label string
+	tx.Table(k.table).Where("id = ?", id).Select(k.label).Scan(&label)
+	return model, label, nil
+}
+
+func referenceArgs(ref reference, id uint) []interface{} {
+	args := make([]interface{}, strings.Count(ref.where, "?"))
+	for i := range args {
+		args[i] = id
+	}
+	return args
+}
+
+func restoreProduct(tx *gorm.DB, id uint) error {
+	var product models.Product
+	if err := tx.Unscoped().First(&product, id).Error; err != nil {
+		return err
+	}
+
+	if product.CategoryID != 0 {
+		var count int64
+		tx.Model(&models.Category{}).Where("id = ?", product.CategoryID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("its category is in the trash; restore the category first")
+		}
+	}
+
+	// Codes freed by the deletion may have been reused since
+	taken := func(column, value string) bool {
+		var count int64
+		tx.Model(&models.Product{}).Where(column+" = ? AND id != ?", value, id).Count(&count)
+		return count > 0
+	}
+	if product.Barcode != nil {
+		var alternates int64
+		tx.Model(&models.ProductBarcode{}).Where("barcode = ? AND product_id != ?", *product.Barcode, id).Count(&alternates)
+		if alternates > 0 || taken("barcode", *product.Barcode) {
+			return fmt.Errorf("barcode %s is now used by another product", *product.Barcode)
+		}
+	}
+	if product.SKU != nil && taken("sku", *product.SKU) {
+		return fmt.Errorf("SKU %s is now used by another product", *product.SKU)
+	}
+	if product.PLU != nil && taken("plu", *product.PLU) {
+		return fmt.Errorf("PLU %s is now used by another product", *product.PLU)
+	}
+	return nil
+}
+
+func restoreCategory(tx *gorm.DB, id uint) error {
+	var category models.Category
+	if err := tx.Unscoped().First(&category, id).Error; err != nil {
+		return err
+	}
+
+	// The parent may have moved while the category was in the trash
+	path, depth := fmt.Sprintf("/%d/", category.ID), 0
+	if category.ParentID != nil {
+		var parent models.Category
+		if err := tx.First(&parent, *category.ParentID).Error; err != nil {
+			return fmt.Errorf("its parent category is in the trash; restore the parent first")
+		}
+		path, depth = fmt.Sprintf("%s%d/", parent.Path, category.ID), parent.Depth+1
+	}
+
+	// Names are unique among siblings, as when categories are created
+	siblings := tx.Model(&models.Category{}).Where("LOWER(name) = ? AND id != ?", strings.ToLower(category.Name), id)
+	if category.ParentID == nil {
+		siblings = siblings.Where("parent_id IS NULL")
+	} else {
+		siblings = siblings.Where("parent_id = ?", *category.ParentID)
+	}
+	var count int64
+	siblings.Count(&count)
+	if count > 0 {
+		return fmt.Errorf("a category named %q now exists in its place", category.Name)
+	}
+
+	return tx.Unscoped().Model(&category).UpdateColumns(map[string]interface{}{"path": path, "depth": depth}).Error
+}
+
+func restoreUser(tx *gorm.DB, id uint) error {
+	var user models.User
+	if err := tx.Unscoped().First(&user, id).Error; err != nil {
+		return err
+	}
+
+	var count int64
+	tx.Model(&models.User{}).Where("(username = ? OR email = ?) AND id != ?", user.Username, user.Email, id).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("username or email is now used by another user")
+	}
+	return nil
+}